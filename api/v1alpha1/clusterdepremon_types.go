@@ -0,0 +1,173 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnforcementMode decides what happens to a request using a deprecated API
+// +kubebuilder:validation:Enum=Record;Warn;Deny
+type EnforcementMode string
+
+const (
+	// RecordMode only records the request into the report
+	RecordMode EnforcementMode = "Record"
+	// WarnMode records the request and returns a warning to the client
+	WarnMode EnforcementMode = "Warn"
+	// DenyMode records the request and rejects it
+	DenyMode EnforcementMode = "Deny"
+)
+
+// ResourceScope is the scope of a deprecated resource
+// +kubebuilder:validation:Enum=Namespaced;Cluster
+type ResourceScope string
+
+const (
+	NamespacedScope ResourceScope = "Namespaced"
+	ClusterScope    ResourceScope = "Cluster"
+)
+
+// DeprecatedAPI is an entry of the deprecation catalog
+type DeprecatedAPI struct {
+	// Group of the deprecated API, empty for the core group
+	Group string `json:"group"`
+	// Version of the deprecated API
+	Version string `json:"version"`
+	// Resource is the plural name of the deprecated resource
+	Resource string `json:"resource"`
+	// Scope of the resource, Namespaced or Cluster
+	Scope ResourceScope `json:"scope,omitempty"`
+	// RemovedIn is the Kubernetes version where the API is no longer served
+	RemovedIn string `json:"removedIn,omitempty"`
+	// ReplacedBy is the group version to migrate to
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	// ReplacementIntroducedIn is the Kubernetes version where ReplacedBy is
+	// first served, clients built with an older client-go can't use it
+	ReplacementIntroducedIn string `json:"replacementIntroducedIn,omitempty"`
+}
+
+// DeprecatedField is a field, an annotation or a label of the deprecation
+// catalog
+type DeprecatedField struct {
+	// Group of the objects holding the field, empty for the core group
+	Group string `json:"group"`
+	// Versions of the objects holding the field, all of them by default
+	Versions []string `json:"versions,omitempty"`
+	// Resource is the plural name of the objects holding the field
+	Resource string `json:"resource"`
+	// Path of the field from the root of the object: the fields are separated
+	// by dots, [*] matches all the items of a list, and [key] a key of a map,
+	// where a key ending with * matches a prefix, e.g.
+	// metadata.annotations[kubernetes.io/ingress.class]
+	Path string `json:"path"`
+	// Value restricts the field to a value, e.g. the key of a node selector
+	// requirement
+	Value string `json:"value,omitempty"`
+	// RemovedIn is the Kubernetes version where the field is no longer
+	// supported
+	RemovedIn string `json:"removedIn,omitempty"`
+	// ReplacedBy is the field to use instead
+	ReplacedBy string `json:"replacedBy,omitempty"`
+}
+
+// Exemption excludes requests from being recorded or enforced
+type Exemption struct {
+	// Namespaces of the objects or requesters to exempt
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Requesters to exempt, either "namespace/serviceaccount" or a user name
+	Requesters []string `json:"requesters,omitempty"`
+}
+
+// CatalogFormat is the format of an imported deprecation catalog
+// +kubebuilder:validation:Enum=Pluto;Kubepug
+type CatalogFormat string
+
+const (
+	// PlutoFormat is the versions.yaml file of pluto
+	PlutoFormat CatalogFormat = "Pluto"
+	// KubepugFormat is the swagger.json file of a Kubernetes release, which
+	// kubepug reads the deprecated APIs from
+	KubepugFormat CatalogFormat = "Kubepug"
+)
+
+// CatalogImport is a deprecation catalog maintained by another tool, read
+// from either a file or a config map
+type CatalogImport struct {
+	// Format of the catalog
+	Format CatalogFormat `json:"format"`
+	// File is the path of the catalog in the operator container, e.g. mounted
+	// from a volume
+	File string `json:"file,omitempty"`
+	// ConfigMap holds the catalog, in the operator namespace
+	ConfigMap *corev1.ConfigMapKeySelector `json:"configMap,omitempty"`
+}
+
+// ClusterDepremonSpec defines the platform-wide policy of depremon
+type ClusterDepremonSpec struct {
+	// Catalog lists deprecated APIs to monitor in addition to the built-in
+	// catalog. Entries with the same group, version and resource as a
+	// built-in one replace it.
+	Catalog []DeprecatedAPI `json:"catalog,omitempty"`
+
+	// Imports lists deprecation catalogs maintained by other tools. Their
+	// entries replace the built-in ones, and are replaced by the entries
+	// found in the cluster and by Catalog.
+	Imports []CatalogImport `json:"imports,omitempty"`
+
+	// Fields lists deprecated fields to monitor in addition to the built-in
+	// ones. Entries with the same group, resource, path and value as a
+	// built-in one replace it.
+	Fields []DeprecatedField `json:"fields,omitempty"`
+
+	// Mode is the enforcement mode for requests using deprecated APIs
+	Mode EnforcementMode `json:"mode,omitempty"`
+
+	// Exemptions apply to every namespace of the cluster
+	Exemptions []Exemption `json:"exemptions,omitempty"`
+}
+
+// ClusterDepremonStatus defines the observed state of ClusterDepremon
+type ClusterDepremonStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterDepremon is the Schema for the clusterdepremons API
+type ClusterDepremon struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterDepremonSpec   `json:"spec,omitempty"`
+	Status ClusterDepremonStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterDepremonList contains a list of ClusterDepremon
+type ClusterDepremonList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterDepremon `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterDepremon{}, &ClusterDepremonList{})
+}
@@ -17,28 +17,154 @@ limitations under the License.
 package v1alpha1
 
 import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// ReportRetentionPolicy decides what happens to the report when the Depremon
+// is deleted
+// +kubebuilder:validation:Enum=Retain;Delete
+type ReportRetentionPolicy string
+
+const (
+	// RetainReport keeps the report after the Depremon is deleted
+	RetainReport ReportRetentionPolicy = "Retain"
+	// DeleteReport deletes the report with the Depremon
+	DeleteReport ReportRetentionPolicy = "Delete"
+)
+
+// WebhookSpec configures the admission webhook recording deprecated APIs
+type WebhookSpec struct {
+	// FailurePolicy is Ignore (default) to admit requests when depremon is
+	// unavailable, or Fail to reject them
+	// +kubebuilder:validation:Enum=Ignore;Fail
+	FailurePolicy admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// TimeoutSeconds is the time the apiserver waits for depremon, 5 seconds
+	// by default
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=30
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// MatchPolicy is Exact (default) to only observe requests made with a
+	// deprecated version, or Equivalent to also observe requests converted by
+	// the apiserver from another version of the same resource
+	// +kubebuilder:validation:Enum=Exact;Equivalent
+	MatchPolicy admissionregistrationv1.MatchPolicyType `json:"matchPolicy,omitempty"`
+}
+
+// LifecycleSpec configures the transitions of the findings
+type LifecycleSpec struct {
+	// InactivityWindow is the time after which a finding not requested with
+	// the deprecated API anymore becomes Stale, 7 days by default
+	InactivityWindow *metav1.Duration `json:"inactivityWindow,omitempty"`
+
+	// ResolvedRetentionDays is the number of days a Resolved finding is kept
+	// in the report, 30 by default
+	// +kubebuilder:validation:Minimum=1
+	ResolvedRetentionDays int32 `json:"resolvedRetentionDays,omitempty"`
+}
+
+// SnapshotSpec configures the snapshots of the report
+type SnapshotSpec struct {
+	// Interval is the time between two snapshots of the report, 24 hours by
+	// default
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Keep is the number of snapshots kept, 7 by default
+	// +kubebuilder:validation:Minimum=1
+	Keep int32 `json:"keep,omitempty"`
+}
+
 // DepremonSpec defines the desired state of Depremon
 type DepremonSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
 	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Mode makes the enforcement stricter than the ClusterDepremon mode for
+	// the scope of the Depremon. A weaker mode has no effect.
+	Mode EnforcementMode `json:"mode,omitempty"`
+
+	// Exemptions narrow the ClusterDepremon policy. A Depremon outside of
+	// the operator namespace only applies to objects in its own namespace.
+	Exemptions []Exemption `json:"exemptions,omitempty"`
+
+	// ReportRetention is Retain (default) to keep the report when the
+	// Depremon is deleted, or Delete to remove it
+	ReportRetention ReportRetentionPolicy `json:"reportRetention,omitempty"`
+
+	// Webhook configures the admission webhook
+	Webhook WebhookSpec `json:"webhook,omitempty"`
+
+	// ScanInterval is the interval between two scans of the existing
+	// resources, 3 minutes by default
+	ScanInterval *metav1.Duration `json:"scanInterval,omitempty"`
+
+	// TargetVersion is the Kubernetes version the cluster is going to be
+	// upgraded to, the current version of the cluster by default
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// Discovery configures the discovery of the deprecated APIs served by
+	// the cluster
+	Discovery DiscoverySpec `json:"discovery,omitempty"`
+
+	// OwnerKeys are the annotations and labels holding the team owning a
+	// requester, looked for on its workloads, its service account and its
+	// namespace. Defaults to owner, team and app.kubernetes.io/part-of.
+	OwnerKeys []string `json:"ownerKeys,omitempty"`
+
+	// Lifecycle configures the transitions of the findings of the report
+	Lifecycle LifecycleSpec `json:"lifecycle,omitempty"`
+
+	// Snapshots configures the snapshots of the report
+	Snapshots SnapshotSpec `json:"snapshots,omitempty"`
+
+	// Notifications are the sinks the findings are sent to. They are only
+	// supported in the operator namespace.
+	Notifications []NotificationSink `json:"notifications,omitempty"`
+
+	// StorageMigration configures the migration of the custom resources
+	// stored in old versions
+	StorageMigration StorageMigrationSpec `json:"storageMigration,omitempty"`
+
+	// Rules are the conventions of the platform being retired. The rules of
+	// a Depremon outside of the operator namespace only apply to objects in
+	// its own namespace.
+	Rules []CustomRule `json:"rules,omitempty"`
 }
 
 // DepremonStatus defines the observed state of Depremon
 type DepremonStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// ObservedGeneration is the last generation of the spec reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastScanTime is the time of the last scan of the existing resources
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+
+	// Readiness is the readiness of the cluster for the target version,
+	// evaluated on each scan by the Depremon objects of the operator namespace
+	Readiness *ReadinessStatus `json:"readiness,omitempty"`
+
+	// StorageMigrations are the migrations of the custom resources, run by
+	// the first Depremon of the operator namespace
+	StorageMigrations []StorageMigrationStatus `json:"storageMigrations,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Target",type=string,JSONPath=".status.readiness.targetVersion"
+//+kubebuilder:printcolumn:name="Readiness",type=string,JSONPath=".status.readiness.verdict"
+//+kubebuilder:printcolumn:name="Blocking",type=integer,JSONPath=".status.readiness.blockingCount"
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:storageversion
 
 // Depremon is the Schema for the depremons API
 type Depremon struct {
@@ -0,0 +1,221 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/horis233/k8s-deprecation-checker/api/v1beta1"
+)
+
+var _ conversion.Convertible = &Depremon{}
+
+// ConvertTo converts this Depremon to the Hub version (v1beta1)
+func (src *Depremon) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Depremon)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec.Scope.Namespaces = src.Spec.Namespaces
+	for _, exemption := range src.Spec.Exemptions {
+		dst.Spec.Scope.Exemptions = append(dst.Spec.Scope.Exemptions, v1beta1.Exemption(exemption))
+	}
+	dst.Spec.Catalog.TargetVersion = src.Spec.TargetVersion
+	dst.Spec.Catalog.Discovery.Mode = v1beta1.DiscoveryMode(src.Spec.Discovery.Mode)
+	dst.Spec.Mode = v1beta1.EnforcementMode(src.Spec.Mode)
+	dst.Spec.Reporting.Retention = v1beta1.ReportRetentionPolicy(src.Spec.ReportRetention)
+	dst.Spec.Reporting.ScanInterval = src.Spec.ScanInterval
+	dst.Spec.Reporting.OwnerKeys = src.Spec.OwnerKeys
+	dst.Spec.Reporting.Lifecycle = v1beta1.LifecycleSpec(src.Spec.Lifecycle)
+	dst.Spec.Reporting.Snapshots = v1beta1.SnapshotSpec(src.Spec.Snapshots)
+	dst.Spec.Webhook = v1beta1.WebhookSpec(src.Spec.Webhook)
+	for _, sink := range src.Spec.Notifications {
+		dst.Spec.Notifications.Sinks = append(dst.Spec.Notifications.Sinks, convertSinkTo(sink))
+	}
+	dst.Spec.StorageMigration = v1beta1.StorageMigrationSpec(src.Spec.StorageMigration)
+	for _, rule := range src.Spec.Rules {
+		dst.Spec.Rules = append(dst.Spec.Rules, v1beta1.CustomRule{
+			Name:       rule.Name,
+			Group:      rule.Group,
+			Versions:   rule.Versions,
+			Resource:   rule.Resource,
+			Expression: rule.Expression,
+			Message:    rule.Message,
+			Severity:   v1beta1.RuleSeverity(rule.Severity),
+		})
+	}
+
+	dst.Status = v1beta1.DepremonStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+		LastScanTime:       src.Status.LastScanTime,
+	}
+	if src.Status.Readiness != nil {
+		dst.Status.Readiness = &v1beta1.ReadinessStatus{
+			TargetVersion:     src.Status.Readiness.TargetVersion,
+			Verdict:           v1beta1.ReadinessVerdict(src.Status.Readiness.Verdict),
+			BlockingCount:     src.Status.Readiness.BlockingCount,
+			UnreadableSources: src.Status.Readiness.UnreadableSources,
+			EvaluationTime:    src.Status.Readiness.EvaluationTime,
+		}
+		for _, finding := range src.Status.Readiness.BlockingFindings {
+			finding := v1beta1.BlockingFinding{
+				Source:     v1beta1.FindingSource(finding.Source),
+				Group:      finding.Group,
+				Version:    finding.Version,
+				Kind:       finding.Kind,
+				Name:       finding.Name,
+				Namespace:  finding.Namespace,
+				RemovedIn:  finding.RemovedIn,
+				ReplacedBy: finding.ReplacedBy,
+				Message:    finding.Message,
+			}
+			dst.Status.Readiness.BlockingFindings = append(dst.Status.Readiness.BlockingFindings, finding)
+		}
+	}
+	for _, migration := range src.Status.StorageMigrations {
+		dst.Status.StorageMigrations = append(dst.Status.StorageMigrations, v1beta1.StorageMigrationStatus{
+			CRD:            migration.CRD,
+			StoredVersions: migration.StoredVersions,
+			StorageVersion: migration.StorageVersion,
+			Phase:          v1beta1.MigrationPhase(migration.Phase),
+			Migrated:       migration.Migrated,
+			Continue:       migration.Continue,
+			Message:        migration.Message,
+			StartTime:      migration.StartTime,
+			CompletionTime: migration.CompletionTime,
+		})
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version
+func (dst *Depremon) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Depremon)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec.Namespaces = src.Spec.Scope.Namespaces
+	for _, exemption := range src.Spec.Scope.Exemptions {
+		dst.Spec.Exemptions = append(dst.Spec.Exemptions, Exemption(exemption))
+	}
+	dst.Spec.TargetVersion = src.Spec.Catalog.TargetVersion
+	dst.Spec.Discovery.Mode = DiscoveryMode(src.Spec.Catalog.Discovery.Mode)
+	dst.Spec.Mode = EnforcementMode(src.Spec.Mode)
+	dst.Spec.ReportRetention = ReportRetentionPolicy(src.Spec.Reporting.Retention)
+	dst.Spec.ScanInterval = src.Spec.Reporting.ScanInterval
+	dst.Spec.OwnerKeys = src.Spec.Reporting.OwnerKeys
+	dst.Spec.Lifecycle = LifecycleSpec(src.Spec.Reporting.Lifecycle)
+	dst.Spec.Snapshots = SnapshotSpec(src.Spec.Reporting.Snapshots)
+	dst.Spec.Webhook = WebhookSpec(src.Spec.Webhook)
+	for _, sink := range src.Spec.Notifications.Sinks {
+		dst.Spec.Notifications = append(dst.Spec.Notifications, convertSinkFrom(sink))
+	}
+	dst.Spec.StorageMigration = StorageMigrationSpec(src.Spec.StorageMigration)
+	for _, rule := range src.Spec.Rules {
+		dst.Spec.Rules = append(dst.Spec.Rules, CustomRule{
+			Name:       rule.Name,
+			Group:      rule.Group,
+			Versions:   rule.Versions,
+			Resource:   rule.Resource,
+			Expression: rule.Expression,
+			Message:    rule.Message,
+			Severity:   RuleSeverity(rule.Severity),
+		})
+	}
+
+	dst.Status = DepremonStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+		LastScanTime:       src.Status.LastScanTime,
+	}
+	if src.Status.Readiness != nil {
+		dst.Status.Readiness = &ReadinessStatus{
+			TargetVersion:     src.Status.Readiness.TargetVersion,
+			Verdict:           ReadinessVerdict(src.Status.Readiness.Verdict),
+			BlockingCount:     src.Status.Readiness.BlockingCount,
+			UnreadableSources: src.Status.Readiness.UnreadableSources,
+			EvaluationTime:    src.Status.Readiness.EvaluationTime,
+		}
+		for _, finding := range src.Status.Readiness.BlockingFindings {
+			finding := BlockingFinding{
+				Source:     FindingSource(finding.Source),
+				Group:      finding.Group,
+				Version:    finding.Version,
+				Kind:       finding.Kind,
+				Name:       finding.Name,
+				Namespace:  finding.Namespace,
+				RemovedIn:  finding.RemovedIn,
+				ReplacedBy: finding.ReplacedBy,
+				Message:    finding.Message,
+			}
+			dst.Status.Readiness.BlockingFindings = append(dst.Status.Readiness.BlockingFindings, finding)
+		}
+	}
+	for _, migration := range src.Status.StorageMigrations {
+		dst.Status.StorageMigrations = append(dst.Status.StorageMigrations, StorageMigrationStatus{
+			CRD:            migration.CRD,
+			StoredVersions: migration.StoredVersions,
+			StorageVersion: migration.StorageVersion,
+			Phase:          MigrationPhase(migration.Phase),
+			Migrated:       migration.Migrated,
+			Continue:       migration.Continue,
+			Message:        migration.Message,
+			StartTime:      migration.StartTime,
+			CompletionTime: migration.CompletionTime,
+		})
+	}
+	return nil
+}
+
+func convertSinkTo(src NotificationSink) v1beta1.NotificationSink {
+	dst := v1beta1.NotificationSink{
+		Name:         src.Name,
+		Type:         v1beta1.SinkType(src.Type),
+		URL:          src.URL,
+		URLSecretRef: src.URLSecretRef,
+		Owners:       src.Owners,
+		Template:     src.Template,
+		DedupWindow:  src.DedupWindow,
+		DigestHour:   src.DigestHour,
+	}
+	if src.SMTP != nil {
+		smtp := v1beta1.SMTPSpec(*src.SMTP)
+		dst.SMTP = &smtp
+	}
+	for _, event := range src.Events {
+		dst.Events = append(dst.Events, v1beta1.NotificationEvent(event))
+	}
+	return dst
+}
+
+func convertSinkFrom(src v1beta1.NotificationSink) NotificationSink {
+	dst := NotificationSink{
+		Name:         src.Name,
+		Type:         SinkType(src.Type),
+		URL:          src.URL,
+		URLSecretRef: src.URLSecretRef,
+		Owners:       src.Owners,
+		Template:     src.Template,
+		DedupWindow:  src.DedupWindow,
+		DigestHour:   src.DigestHour,
+	}
+	if src.SMTP != nil {
+		smtp := SMTPSpec(*src.SMTP)
+		dst.SMTP = &smtp
+	}
+	for _, event := range src.Events {
+		dst.Events = append(dst.Events, NotificationEvent(event))
+	}
+	return dst
+}
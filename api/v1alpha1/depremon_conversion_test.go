@@ -0,0 +1,62 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/horis233/k8s-deprecation-checker/api/v1beta1"
+)
+
+// TestConversionRoundTrip converts random Depremon objects to the hub version
+// and back, every field must survive
+func TestConversionRoundTrip(t *testing.T) {
+	f := fuzz.NewWithSeed(1).NilChance(0.2).NumElements(0, 3).Funcs(
+		// the fields of time.Time aren't exported
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+	)
+	for i := 0; i < 1000; i++ {
+		original := &Depremon{}
+		f.Fuzz(original)
+
+		hub := &v1beta1.Depremon{}
+		if err := original.DeepCopy().ConvertTo(hub); err != nil {
+			t.Fatal(err)
+		}
+		converted := &Depremon{}
+		if err := converted.ConvertFrom(hub); err != nil {
+			t.Fatal(err)
+		}
+		// the conversion webhook sets the kind of the converted objects
+		converted.TypeMeta = original.TypeMeta
+
+		if !equality.Semantic.DeepEqual(original, converted) {
+			t.Fatalf("round trip changed the Depremon:\n%+v\n%+v", original, converted)
+		}
+	}
+}
+
+func TestConvertTo(t *testing.T) {
+	src := &Depremon{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: "depremon-sample"},
+		Spec: DepremonSpec{
+			Namespaces:    []string{"shop"},
+			TargetVersion: "v1.22",
+			Mode:          WarnMode,
+			Webhook:       WebhookSpec{TimeoutSeconds: 10},
+			Rules:         []CustomRule{{Name: "tier", Resource: "pods", Expression: "true"}},
+		},
+	}
+	dst := &v1beta1.Depremon{}
+	if err := src.ConvertTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Name != "depremon-sample" || dst.Spec.Scope.Namespaces[0] != "shop" || dst.Spec.Catalog.TargetVersion != "v1.22" ||
+		dst.Spec.Mode != v1beta1.WarnMode || dst.Spec.Webhook.TimeoutSeconds != 10 || dst.Spec.Rules[0].Name != "tier" {
+		t.Errorf("unexpected conversion %+v", dst.Spec)
+	}
+}
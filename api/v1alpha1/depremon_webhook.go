@@ -0,0 +1,638 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// DefaultTimeoutSeconds is the default timeout of the admission webhook
+	DefaultTimeoutSeconds = 5
+	// DefaultScanInterval is the default interval between two scans
+	DefaultScanInterval = 3 * time.Minute
+	// minScanInterval protects the apiserver from too frequent scans
+	minScanInterval = time.Minute
+	// lastSeenResolution is the precision of the time a finding was last
+	// seen, a shorter inactivity window would make active findings stale
+	lastSeenResolution = time.Hour
+	// DefaultDedupWindow is the default time a finding isn't sent again to a
+	// sink
+	DefaultDedupWindow = time.Hour
+	// DefaultSMTPPort is the default port of the SMTP server
+	DefaultSMTPPort = 587
+	// DefaultInactivityWindow is the default time after which a finding
+	// becomes stale
+	DefaultInactivityWindow = 7 * 24 * time.Hour
+	// DefaultResolvedRetentionDays is the default number of days a resolved
+	// finding is kept
+	DefaultResolvedRetentionDays = 30
+	// DefaultSnapshotInterval is the default time between two snapshots of
+	// the report
+	DefaultSnapshotInterval = 24 * time.Hour
+	// minSnapshotInterval avoids filling the namespace with snapshots
+	minSnapshotInterval = time.Hour
+	// DefaultSnapshotKeep is the default number of snapshots kept
+	DefaultSnapshotKeep = 7
+	// DefaultMigrationQPS is the default number of custom resources written
+	// per second by the storage migration
+	DefaultMigrationQPS = 10
+)
+
+// DefaultOwnerKeys are the default annotations and labels holding the team
+// owning a requester
+var DefaultOwnerKeys = []string{"owner", "team", "app.kubernetes.io/part-of"}
+
+// log is for logging in this package.
+var depremonlog = logf.Log.WithName("depremon-resource")
+
+// DepremonWebhook defaults and validates Depremon objects. The Defaulter and
+// Validator interfaces of the object don't give access to the cluster, so the
+// webhook holds the settings and the reader it needs.
+// +kubebuilder:object:generate=false
+type DepremonWebhook struct {
+	// Reader is used to compare the settings shared by the Depremon objects
+	// of the operator namespace
+	Reader client.Reader
+	// OperatorNamespace is the namespace of the operator
+	OperatorNamespace string
+	// ClusterVersion is the default target version
+	ClusterVersion string
+}
+
+// Default defaults a Depremon
+func (w *DepremonWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*Depremon)
+	if !ok {
+		return fmt.Errorf("expected a Depremon, got %T", obj)
+	}
+	depremonlog.Info("default", "name", r.Name)
+
+	w.defaultSpec(r.Namespace, &r.Spec)
+	return nil
+}
+
+func (w *DepremonWebhook) defaultSpec(namespace string, spec *DepremonSpec) {
+	if spec.Mode == "" {
+		spec.Mode = RecordMode
+	}
+	for i := range spec.Notifications {
+		spec.Notifications[i].defaultSink()
+	}
+	for i := range spec.Rules {
+		if spec.Rules[i].Severity == "" {
+			spec.Rules[i].Severity = WarningSeverity
+		}
+	}
+
+	// The other settings are shared by the Depremon objects of the operator
+	// namespace, and ignored in the other namespaces
+	if namespace == w.OperatorNamespace {
+		spec.defaultSingletonSettings(w.ClusterVersion)
+	}
+}
+
+func (spec *DepremonSpec) defaultSingletonSettings(clusterVersion string) {
+	if spec.Webhook.FailurePolicy == "" {
+		spec.Webhook.FailurePolicy = admissionregistrationv1.Ignore
+	}
+	if spec.Webhook.TimeoutSeconds == 0 {
+		spec.Webhook.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+	if spec.Webhook.MatchPolicy == "" {
+		spec.Webhook.MatchPolicy = admissionregistrationv1.Exact
+	}
+	if spec.ReportRetention == "" {
+		spec.ReportRetention = RetainReport
+	}
+	if spec.ScanInterval == nil {
+		spec.ScanInterval = &metav1.Duration{Duration: DefaultScanInterval}
+	}
+	if spec.TargetVersion == "" {
+		spec.TargetVersion = clusterVersion
+	}
+	if spec.Discovery.Mode == "" {
+		spec.Discovery.Mode = DiscoveryDisabled
+	}
+	if len(spec.OwnerKeys) == 0 {
+		spec.OwnerKeys = append([]string{}, DefaultOwnerKeys...)
+	}
+	if spec.Lifecycle.InactivityWindow == nil {
+		spec.Lifecycle.InactivityWindow = &metav1.Duration{Duration: DefaultInactivityWindow}
+	}
+	if spec.Lifecycle.ResolvedRetentionDays == 0 {
+		spec.Lifecycle.ResolvedRetentionDays = DefaultResolvedRetentionDays
+	}
+	if spec.Snapshots.Interval == nil {
+		spec.Snapshots.Interval = &metav1.Duration{Duration: DefaultSnapshotInterval}
+	}
+	if spec.Snapshots.Keep == 0 {
+		spec.Snapshots.Keep = DefaultSnapshotKeep
+	}
+	if spec.StorageMigration.QPS == 0 {
+		spec.StorageMigration.QPS = DefaultMigrationQPS
+	}
+}
+
+func (sink *NotificationSink) defaultSink() {
+	if len(sink.Events) == 0 {
+		sink.Events = []NotificationEvent{NewFindingEvent}
+	}
+	if sink.DedupWindow == nil {
+		sink.DedupWindow = &metav1.Duration{Duration: DefaultDedupWindow}
+	}
+	if sink.SMTP != nil && sink.SMTP.Port == 0 {
+		sink.SMTP.Port = DefaultSMTPPort
+	}
+}
+
+// ValidateCreate validates a created Depremon
+func (w *DepremonWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*Depremon)
+	if !ok {
+		return fmt.Errorf("expected a Depremon, got %T", obj)
+	}
+	depremonlog.Info("validate create", "name", r.Name)
+
+	return w.validate(ctx, r, nil)
+}
+
+// ValidateUpdate validates an updated Depremon. The updates of a deleted
+// Depremon, and the updates keeping its spec, like the ones of its
+// finalizer, are always accepted: a Depremon created before the webhook or
+// conflicting with another one must still be deleted.
+func (w *DepremonWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	r, ok := newObj.(*Depremon)
+	if !ok {
+		return fmt.Errorf("expected a Depremon, got %T", newObj)
+	}
+	old, ok := oldObj.(*Depremon)
+	if !ok {
+		return fmt.Errorf("expected a Depremon, got %T", oldObj)
+	}
+	depremonlog.Info("validate update", "name", r.Name)
+
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+	// the old Depremon isn't defaulted when it predates the webhook
+	oldSpec, newSpec := old.Spec.DeepCopy(), r.Spec.DeepCopy()
+	w.defaultSpec(old.Namespace, oldSpec)
+	w.defaultSpec(r.Namespace, newSpec)
+	if equality.Semantic.DeepEqual(oldSpec, newSpec) {
+		return nil
+	}
+	return w.validate(ctx, r, old)
+}
+
+// ValidateDelete accepts the deletion of any Depremon
+func (w *DepremonWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// validate validates a Depremon, old is the previous Depremon on updates and
+// nil on creations
+func (w *DepremonWebhook) validate(ctx context.Context, r, old *Depremon) error {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	for i, ns := range r.Spec.Namespaces {
+		allErrs = append(allErrs, validateNamespace(ns, specPath.Child("namespaces").Index(i))...)
+	}
+	allErrs = append(allErrs, validateExemptions(r.Spec.Exemptions, specPath.Child("exemptions"))...)
+	allErrs = append(allErrs, validateNotifications(r.Spec.Notifications, specPath.Child("notifications"))...)
+	allErrs = append(allErrs, validateRules(r.Spec.Rules, specPath.Child("rules"))...)
+
+	if r.Spec.TargetVersion != "" {
+		if _, err := version.ParseGeneric(r.Spec.TargetVersion); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("targetVersion"), r.Spec.TargetVersion, err.Error()))
+		}
+	}
+	if window := r.Spec.Lifecycle.InactivityWindow; window != nil && window.Duration < lastSeenResolution {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("lifecycle", "inactivityWindow"), window.Duration.String(),
+			fmt.Sprintf("must be at least %s", lastSeenResolution)))
+	}
+	if interval := r.Spec.Snapshots.Interval; interval != nil && interval.Duration < minSnapshotInterval {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("snapshots", "interval"), interval.Duration.String(),
+			fmt.Sprintf("must be at least %s", minSnapshotInterval)))
+	}
+	for i, name := range r.Spec.StorageMigration.CRDs {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("storageMigration", "crds").Index(i), name, msg))
+		}
+	}
+	if r.Spec.ScanInterval != nil && r.Spec.ScanInterval.Duration < minScanInterval {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("scanInterval"), r.Spec.ScanInterval.Duration.String(),
+			fmt.Sprintf("must be at least %s", minScanInterval)))
+	}
+
+	allErrs = append(allErrs, w.validateSingletonSettings(ctx, r, old, specPath)...)
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "Depremon"}, r.Name, allErrs)
+}
+
+func validateNamespace(ns string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsDNS1123Label(ns) {
+		allErrs = append(allErrs, field.Invalid(fldPath, ns, msg))
+	}
+	return allErrs
+}
+
+// validateExemptions checks the syntax of each exemption, and rejects the
+// exemptions already covered by a previous one
+func validateExemptions(exemptions []Exemption, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, exemption := range exemptions {
+		path := fldPath.Index(i)
+		if len(exemption.Namespaces) == 0 && len(exemption.Requesters) == 0 {
+			allErrs = append(allErrs, field.Required(path, "namespaces or requesters must be set"))
+			continue
+		}
+		for j, ns := range exemption.Namespaces {
+			allErrs = append(allErrs, validateNamespace(ns, path.Child("namespaces").Index(j))...)
+		}
+		for j, requester := range exemption.Requesters {
+			allErrs = append(allErrs, validateRequester(requester, path.Child("requesters").Index(j))...)
+		}
+		for k := 0; k < i; k++ {
+			if covers(exemptions[k], exemption) || covers(exemption, exemptions[k]) {
+				allErrs = append(allErrs, field.Invalid(path, exemption, fmt.Sprintf("overlaps with %s", fldPath.Index(k))))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateRequester accepts "namespace/serviceaccount" or a user name
+func validateRequester(requester string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if strings.TrimSpace(requester) == "" {
+		return append(allErrs, field.Required(fldPath, "requester must not be empty"))
+	}
+	if !strings.Contains(requester, "/") {
+		return allErrs
+	}
+
+	parts := strings.Split(requester, "/")
+	if len(parts) != 2 {
+		return append(allErrs, field.Invalid(fldPath, requester, "must be namespace/serviceaccount or a user name"))
+	}
+	allErrs = append(allErrs, validateNamespace(parts[0], fldPath)...)
+	for _, msg := range validation.IsDNS1123Subdomain(parts[1]) {
+		allErrs = append(allErrs, field.Invalid(fldPath, requester, msg))
+	}
+	return allErrs
+}
+
+// covers tells if every request matched by inner is matched by outer
+func covers(outer, inner Exemption) bool {
+	return coversList(outer.Namespaces, inner.Namespaces) && coversList(outer.Requesters, inner.Requesters)
+}
+
+func coversList(outer, inner []string) bool {
+	if len(outer) == 0 {
+		return true
+	}
+	if len(inner) == 0 {
+		return false
+	}
+	values := make(map[string]bool)
+	for _, value := range outer {
+		values[value] = true
+	}
+	for _, value := range inner {
+		if !values[value] {
+			return false
+		}
+	}
+	return true
+}
+
+// validateNotifications checks that each sink has a unique name, the settings
+// required by its type and a valid template
+func validateNotifications(sinks []NotificationSink, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	names := make(map[string]bool)
+	for i, sink := range sinks {
+		path := fldPath.Index(i)
+		if sink.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("name"), "sink name must be set"))
+		} else if names[sink.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), sink.Name))
+		}
+		names[sink.Name] = true
+
+		switch sink.Type {
+		case SMTPSink:
+			if sink.SMTP == nil {
+				allErrs = append(allErrs, field.Required(path.Child("smtp"), "must be set for SMTP sinks"))
+				break
+			}
+			if sink.SMTP.Host == "" {
+				allErrs = append(allErrs, field.Required(path.Child("smtp", "host"), "SMTP host must be set"))
+			}
+			if sink.SMTP.From == "" {
+				allErrs = append(allErrs, field.Required(path.Child("smtp", "from"), "sender address must be set"))
+			}
+			if len(sink.SMTP.To) == 0 {
+				allErrs = append(allErrs, field.Required(path.Child("smtp", "to"), "at least one recipient must be set"))
+			}
+		default:
+			if sink.URL == "" && sink.URLSecretRef == nil {
+				allErrs = append(allErrs, field.Required(path.Child("url"), "url or urlSecretRef must be set"))
+			}
+			if sink.URL != "" {
+				if u, err := url.Parse(sink.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					allErrs = append(allErrs, field.Invalid(path.Child("url"), sink.URL, "must be an http or https URL"))
+				}
+			}
+		}
+
+		if sink.Template != "" {
+			if _, err := template.New(sink.Name).Parse(sink.Template); err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child("template"), sink.Template, err.Error()))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateRules checks that each rule has a unique name, a resource and an
+// expression compiling to a boolean
+func validateRules(rules []CustomRule, fldPath *field.Path) field.ErrorList {
+	if len(rules) == 0 {
+		return nil
+	}
+	var allErrs field.ErrorList
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("object", decls.Dyn),
+		decls.NewVar("oldObject", decls.Dyn),
+		decls.NewVar("request", decls.Dyn),
+	))
+	if err != nil {
+		return append(allErrs, field.InternalError(fldPath, err))
+	}
+
+	names := make(map[string]bool)
+	for i, rule := range rules {
+		path := fldPath.Index(i)
+		if rule.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("name"), "rule name must be set"))
+		} else if names[rule.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), rule.Name))
+		}
+		names[rule.Name] = true
+
+		if rule.Resource == "" {
+			allErrs = append(allErrs, field.Required(path.Child("resource"), "resource must be set"))
+		}
+		if rule.Expression == "" {
+			allErrs = append(allErrs, field.Required(path.Child("expression"), "expression must be set"))
+			continue
+		}
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("expression"), rule.Expression, issues.Err().Error()))
+			continue
+		}
+		if resultType := cel.FormatType(ast.ResultType()); resultType != "bool" && resultType != "dyn" {
+			allErrs = append(allErrs, field.Invalid(path.Child("expression"), rule.Expression,
+				fmt.Sprintf("must return a bool, not %s", resultType)))
+		}
+	}
+	return allErrs
+}
+
+// singletonSettings are the settings shared by the Depremon objects of the
+// operator namespace, with their defaulted value
+var singletonSettings = []struct {
+	name  string
+	value func(spec *DepremonSpec) interface{}
+}{
+	{"webhook", func(spec *DepremonSpec) interface{} { return spec.Webhook }},
+	{"reportRetention", func(spec *DepremonSpec) interface{} { return spec.ReportRetention }},
+	{"scanInterval", func(spec *DepremonSpec) interface{} { return spec.ScanInterval }},
+	{"targetVersion", func(spec *DepremonSpec) interface{} { return spec.TargetVersion }},
+	{"discovery", func(spec *DepremonSpec) interface{} { return spec.Discovery }},
+	{"ownerKeys", func(spec *DepremonSpec) interface{} { return spec.OwnerKeys }},
+	{"lifecycle", func(spec *DepremonSpec) interface{} { return spec.Lifecycle }},
+	{"snapshots", func(spec *DepremonSpec) interface{} { return spec.Snapshots }},
+	{"storageMigration", func(spec *DepremonSpec) interface{} { return spec.StorageMigration }},
+}
+
+// validateSingletonSettings rejects the settings shared by the Depremon objects
+// of the operator namespace when they are set in another namespace. They are
+// taken from the first Depremon of the operator namespace by name, which can
+// change them: the settings of the other ones must be the same, and only the
+// ones which change are compared on updates. Deleted Depremon objects are
+// ignored.
+func (w *DepremonWebhook) validateSingletonSettings(ctx context.Context, r, old *Depremon, specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if w.OperatorNamespace == "" || r.Namespace == "" {
+		return allErrs
+	}
+
+	if r.Namespace != w.OperatorNamespace {
+		detail := fmt.Sprintf("only supported in the operator namespace %s", w.OperatorNamespace)
+		if !reflect.DeepEqual(r.Spec.Webhook, WebhookSpec{}) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("webhook"), detail))
+		}
+		if r.Spec.ReportRetention != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("reportRetention"), detail))
+		}
+		if r.Spec.ScanInterval != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("scanInterval"), detail))
+		}
+		if r.Spec.TargetVersion != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("targetVersion"), detail))
+		}
+		if r.Spec.Discovery.Mode != "" {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("discovery"), detail))
+		}
+		if len(r.Spec.OwnerKeys) != 0 {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("ownerKeys"), detail))
+		}
+		if !reflect.DeepEqual(r.Spec.Lifecycle, LifecycleSpec{}) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("lifecycle"), detail))
+		}
+		if !reflect.DeepEqual(r.Spec.Snapshots, SnapshotSpec{}) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("snapshots"), detail))
+		}
+		if !reflect.DeepEqual(r.Spec.StorageMigration, StorageMigrationSpec{}) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("storageMigration"), detail))
+		}
+		if len(r.Spec.Notifications) != 0 {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("notifications"), detail))
+		}
+		return allErrs
+	}
+
+	if w.Reader == nil {
+		return allErrs
+	}
+	list := &DepremonList{}
+	if err := w.Reader.List(ctx, list, client.InNamespace(r.Namespace)); err != nil {
+		return append(allErrs, field.InternalError(specPath, err))
+	}
+
+	spec := r.Spec.DeepCopy()
+	spec.defaultSingletonSettings(w.ClusterVersion)
+	var oldSpec *DepremonSpec
+	if old != nil {
+		oldSpec = old.Spec.DeepCopy()
+		oldSpec.defaultSingletonSettings(w.ClusterVersion)
+	}
+	var first *Depremon
+	for i, other := range list.Items {
+		if other.Name != r.Name && other.DeletionTimestamp.IsZero() && (first == nil || other.Name < first.Name) {
+			first = &list.Items[i]
+		}
+	}
+	if first == nil || r.Name < first.Name {
+		return allErrs
+	}
+	firstSpec := first.Spec.DeepCopy()
+	firstSpec.defaultSingletonSettings(w.ClusterVersion)
+
+	detail := fmt.Sprintf("conflicts with Depremon %s, which holds the settings of the namespace", first.Name)
+	for _, setting := range singletonSettings {
+		value := setting.value(spec)
+		if oldSpec != nil && equality.Semantic.DeepEqual(setting.value(oldSpec), value) {
+			continue
+		}
+		if !equality.Semantic.DeepEqual(value, setting.value(firstSpec)) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child(setting.name), value, detail))
+		}
+	}
+	return allErrs
+}
+
+// DefaultingHandler returns the admission handler defaulting Depremon objects
+func (w *DepremonWebhook) DefaultingHandler() admission.Handler {
+	return &depremonDefaulter{webhook: w}
+}
+
+// ValidatingHandler returns the admission handler validating Depremon objects
+func (w *DepremonWebhook) ValidatingHandler() admission.Handler {
+	return &depremonValidator{webhook: w}
+}
+
+type depremonDefaulter struct {
+	webhook *DepremonWebhook
+	decoder *admission.Decoder
+}
+
+// InjectDecoder implements admission.DecoderInjector
+func (h *depremonDefaulter) InjectDecoder(d *admission.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+// Handle defaults the Depremon of the request, and returns the patch
+func (h *depremonDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := &Depremon{}
+	if err := h.decoder.Decode(req, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := h.webhook.Default(ctx, obj); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	marshalled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshalled)
+}
+
+type depremonValidator struct {
+	webhook *DepremonWebhook
+	decoder *admission.Decoder
+}
+
+// InjectDecoder implements admission.DecoderInjector
+func (h *depremonValidator) InjectDecoder(d *admission.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+// Handle validates the Depremon of the request
+func (h *depremonValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var err error
+	switch req.Operation {
+	case admissionv1.Create:
+		obj := &Depremon{}
+		if err := h.decoder.Decode(req, obj); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		err = h.webhook.ValidateCreate(ctx, obj)
+	case admissionv1.Update:
+		obj, oldObj := &Depremon{}, &Depremon{}
+		if err := h.decoder.DecodeRaw(req.Object, obj); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := h.decoder.DecodeRaw(req.OldObject, oldObj); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		err = h.webhook.ValidateUpdate(ctx, oldObj, obj)
+	case admissionv1.Delete:
+		// OldObject contains the object being deleted
+		obj := &Depremon{}
+		if err := h.decoder.DecodeRaw(req.OldObject, obj); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		err = h.webhook.ValidateDelete(ctx, obj)
+	}
+	if err == nil {
+		return admission.Allowed("")
+	}
+
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		status := apiStatus.Status()
+		return admission.Response{AdmissionResponse: admissionv1.AdmissionResponse{Allowed: false, Result: &status}}
+	}
+	return admission.Denied(err.Error())
+}
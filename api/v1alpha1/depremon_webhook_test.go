@@ -0,0 +1,132 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDepremonWebhookDefault(t *testing.T) {
+	w := &DepremonWebhook{OperatorNamespace: "depremon", ClusterVersion: "v1.21"}
+
+	operator := &Depremon{ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: "d"}}
+	if err := w.Default(context.Background(), operator); err != nil {
+		t.Fatal(err)
+	}
+	if operator.Spec.Mode != RecordMode || operator.Spec.TargetVersion != "v1.21" || operator.Spec.ScanInterval == nil {
+		t.Errorf("the Depremon of the operator namespace isn't defaulted: %+v", operator.Spec)
+	}
+
+	tenant := &Depremon{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "d"}}
+	if err := w.Default(context.Background(), tenant); err != nil {
+		t.Fatal(err)
+	}
+	if tenant.Spec.Mode != RecordMode || tenant.Spec.TargetVersion != "" || tenant.Spec.ScanInterval != nil {
+		t.Errorf("only the mode of a Depremon of another namespace must be defaulted: %+v", tenant.Spec)
+	}
+}
+
+func TestDepremonWebhookValidateSingletonSettings(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&Depremon{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: "first"},
+		Spec:       DepremonSpec{TargetVersion: "v1.22"},
+	}).Build()
+	w := &DepremonWebhook{Reader: reader, OperatorNamespace: "depremon", ClusterVersion: "v1.21"}
+
+	tests := []struct {
+		namespace, targetVersion string
+		valid                    bool
+	}{
+		{"depremon", "v1.22", true},
+		{"depremon", "v1.23", false},
+		{"team-a", "", true},
+		{"team-a", "v1.22", false},
+	}
+	for _, test := range tests {
+		d := &Depremon{
+			ObjectMeta: metav1.ObjectMeta{Namespace: test.namespace, Name: "second"},
+			Spec:       DepremonSpec{TargetVersion: test.targetVersion},
+		}
+		err := w.ValidateCreate(context.Background(), d)
+		if test.valid && err != nil {
+			t.Errorf("target version %q in %s rejected: %v", test.targetVersion, test.namespace, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("target version %q in %s accepted", test.targetVersion, test.namespace)
+		}
+	}
+}
+
+func TestDepremonWebhookValidateUpdate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	now := metav1.Now()
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&Depremon{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: "b"},
+			Spec:       DepremonSpec{TargetVersion: "v1.22"},
+		},
+		// deleted Depremon objects don't hold the settings anymore
+		&Depremon{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: "a", DeletionTimestamp: &now, Finalizers: []string{"finalizer"}},
+			Spec:       DepremonSpec{TargetVersion: "v1.20"},
+		},
+	).Build()
+	w := &DepremonWebhook{Reader: reader, OperatorNamespace: "depremon", ClusterVersion: "v1.21"}
+
+	depremon := func(name, targetVersion string, scanInterval time.Duration) *Depremon {
+		d := &Depremon{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: name},
+			Spec:       DepremonSpec{TargetVersion: targetVersion},
+		}
+		if scanInterval != 0 {
+			d.Spec.ScanInterval = &metav1.Duration{Duration: scanInterval}
+		}
+		return d
+	}
+	deleted := depremon("c", "v1.25", 0)
+	deleted.DeletionTimestamp = &now
+	invalid := depremon("c", "v1.25", 0)
+	invalid.Spec.Namespaces = []string{"Not A Namespace"}
+	invalidUpdated := invalid.DeepCopy()
+	invalidUpdated.Finalizers = []string{"finalizer"}
+	invalidUpdated.Spec.Mode = RecordMode
+	conflicting := depremon("c", "v1.25", 0)
+	conflictingUpdated := conflicting.DeepCopy()
+	conflictingUpdated.Finalizers = []string{"finalizer"}
+
+	tests := []struct {
+		name     string
+		old, new *Depremon
+		valid    bool
+	}{
+		{"finalizer of a conflicting Depremon", conflicting, conflictingUpdated, true},
+		{"finalizer of an invalid Depremon", invalid, invalidUpdated, true},
+		{"deleted Depremon", depremon("c", "v1.25", 0), deleted, true},
+		{"first Depremon changing the settings", depremon("b", "v1.22", 0), depremon("b", "v1.23", 0), true},
+		{"other Depremon changing the settings", depremon("c", "v1.22", 0), depremon("c", "v1.23", 0), false},
+		{"other Depremon following the first one", depremon("c", "v1.21", 0), depremon("c", "v1.22", 0), true},
+		{"unchanged conflicting setting", depremon("c", "v1.25", 0), depremon("c", "v1.25", 2*time.Hour), false},
+		{"changed setting only", depremon("c", "v1.25", time.Hour), depremon("c", "v1.25", 2*time.Hour), false},
+		{"changed setting matching", depremon("c", "v1.25", 2*time.Hour), depremon("c", "v1.25", DefaultScanInterval), true},
+	}
+	for _, test := range tests {
+		err := w.ValidateUpdate(context.Background(), test.old, test.new)
+		if test.valid && err != nil {
+			t.Errorf("%s: rejected: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: accepted", test.name)
+		}
+	}
+}
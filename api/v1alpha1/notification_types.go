@@ -0,0 +1,107 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SinkType is the kind of channel a notification is sent to
+// +kubebuilder:validation:Enum=Webhook;Slack;Teams;CloudEvents;SMTP
+type SinkType string
+
+const (
+	// WebhookSink posts a JSON payload to a generic HTTP endpoint
+	WebhookSink SinkType = "Webhook"
+	// SlackSink posts to a Slack incoming webhook
+	SlackSink SinkType = "Slack"
+	// TeamsSink posts to a Microsoft Teams incoming webhook
+	TeamsSink SinkType = "Teams"
+	// CloudEventsSink posts a CloudEvent in structured mode over HTTP
+	CloudEventsSink SinkType = "CloudEvents"
+	// SMTPSink sends an email
+	SMTPSink SinkType = "SMTP"
+)
+
+// NotificationEvent is a kind of message sent to a sink
+// +kubebuilder:validation:Enum=NewFinding;DailyDigest
+type NotificationEvent string
+
+const (
+	// NewFindingEvent is sent when a deprecated API is used by a new
+	// requester or for a new object
+	NewFindingEvent NotificationEvent = "NewFinding"
+	// DailyDigestEvent summarizes the findings of the last 24 hours
+	DailyDigestEvent NotificationEvent = "DailyDigest"
+)
+
+// SMTPSpec configures the email sent by an SMTP sink
+type SMTPSpec struct {
+	// Host of the SMTP server
+	Host string `json:"host"`
+	// Port of the SMTP server, 587 by default
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+	// From is the sender address
+	From string `json:"from"`
+	// To are the recipient addresses
+	To []string `json:"to"`
+	// CredentialsSecretRef is a secret of the operator namespace with the
+	// username and password keys, to authenticate to the server
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// NotificationSink is a channel the findings are sent to
+type NotificationSink struct {
+	// Name identifies the sink
+	Name string `json:"name"`
+
+	// Type of the sink
+	Type SinkType `json:"type"`
+
+	// URL of the HTTP sinks
+	URL string `json:"url,omitempty"`
+
+	// URLSecretRef is a key of a secret of the operator namespace holding the
+	// URL, for the webhooks with a token in their URL
+	URLSecretRef *corev1.SecretKeySelector `json:"urlSecretRef,omitempty"`
+
+	// SMTP configures the SMTP sinks
+	SMTP *SMTPSpec `json:"smtp,omitempty"`
+
+	// Owners restricts the sink to the findings of the requesters owned by
+	// these teams, all the findings are sent by default
+	Owners []string `json:"owners,omitempty"`
+
+	// Events sent to the sink, NewFinding by default
+	Events []NotificationEvent `json:"events,omitempty"`
+
+	// Template is a Go text/template rendering the message. It is executed
+	// with the Event, Title and Findings of the message.
+	Template string `json:"template,omitempty"`
+
+	// DedupWindow is the time a finding with the same requester and API is
+	// not sent again, 1 hour by default
+	DedupWindow *metav1.Duration `json:"dedupWindow,omitempty"`
+
+	// DigestHour is the hour (UTC) the daily digest is sent at
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=23
+	DigestHour int32 `json:"digestHour,omitempty"`
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReadinessVerdict tells if the cluster can be upgraded to the target version
+// +kubebuilder:validation:Enum=Ready;NotReady;Unknown
+type ReadinessVerdict string
+
+const (
+	// Ready means nothing blocks the upgrade
+	Ready ReadinessVerdict = "Ready"
+	// NotReady means some findings block the upgrade
+	NotReady ReadinessVerdict = "NotReady"
+	// Unknown means no finding blocks the upgrade, but some sources couldn't
+	// be read
+	Unknown ReadinessVerdict = "Unknown"
+)
+
+// FindingSource is where a blocking finding was found
+// +kubebuilder:validation:Enum=Report;ManagedFields;CustomResourceDefinition;WebhookConfiguration;HelmRelease
+type FindingSource string
+
+const (
+	// ReportSource is an unresolved finding of the report
+	ReportSource FindingSource = "Report"
+	// ManagedFieldsSource is an object written with a removed API, according
+	// to its managed fields
+	ManagedFieldsSource FindingSource = "ManagedFields"
+	// CRDSource is a custom resource definition storing a removed version
+	CRDSource FindingSource = "CustomResourceDefinition"
+	// WebhookSource is a webhook configuration only intercepting removed APIs
+	WebhookSource FindingSource = "WebhookConfiguration"
+	// HelmSource is a deployed Helm release rendering removed APIs
+	HelmSource FindingSource = "HelmRelease"
+)
+
+// BlockingFinding is a use of an API removed in the target version
+type BlockingFinding struct {
+	Source FindingSource `json:"source"`
+	// Group, Version and Kind of the removed API
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Name and Namespace of the object using the removed API
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// RemovedIn is the Kubernetes version where the API is no longer served
+	RemovedIn string `json:"removedIn,omitempty"`
+	// ReplacedBy is the group version to migrate to
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	// Message describes what to fix
+	Message string `json:"message,omitempty"`
+}
+
+// ReadinessStatus is the readiness of the cluster for the target version
+type ReadinessStatus struct {
+	// TargetVersion is the Kubernetes version evaluated
+	TargetVersion string `json:"targetVersion"`
+	// Verdict is Ready when nothing blocks the upgrade, NotReady when some
+	// findings do, and Unknown when some sources couldn't be read
+	Verdict ReadinessVerdict `json:"verdict"`
+	// BlockingCount is the number of blocking findings
+	BlockingCount int32 `json:"blockingCount"`
+	// BlockingFindings are the first blocking findings, run depremonctl
+	// readiness to get all of them
+	BlockingFindings []BlockingFinding `json:"blockingFindings,omitempty"`
+	// UnreadableSources are the sources the operator isn't allowed to read,
+	// which may hide blocking findings
+	UnreadableSources []string `json:"unreadableSources,omitempty"`
+	// EvaluationTime is the time of the evaluation
+	EvaluationTime metav1.Time `json:"evaluationTime"`
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// RuleSeverity is the severity of the requests matching a custom rule
+// +kubebuilder:validation:Enum=Info;Warning;Critical
+type RuleSeverity string
+
+const (
+	// InfoSeverity only records the requests matching the rule
+	InfoSeverity RuleSeverity = "Info"
+	// WarningSeverity records the requests and applies the enforcement mode
+	WarningSeverity RuleSeverity = "Warning"
+	// CriticalSeverity records the requests and applies the enforcement mode,
+	// it flags a convention about to be removed
+	CriticalSeverity RuleSeverity = "Critical"
+)
+
+// CustomRule is a convention of the platform being retired, matched by a CEL
+// expression on the admission requests
+type CustomRule struct {
+	// Name of the rule, unique in the Depremon
+	Name string `json:"name"`
+	// Group of the objects the rule applies to, empty for the core group
+	Group string `json:"group"`
+	// Versions of the objects the rule applies to, all of them by default
+	Versions []string `json:"versions,omitempty"`
+	// Resource is the plural name of the objects the rule applies to
+	Resource string `json:"resource"`
+	// Expression is a CEL expression returning true when the request uses the
+	// retired convention. It reads the object of the request as object, the
+	// previous object on updates as oldObject, and the admission request as
+	// request, e.g. has(object.metadata.labels) && 'tier' in object.metadata.labels
+	Expression string `json:"expression"`
+	// Message describes the convention to follow instead
+	Message string `json:"message,omitempty"`
+	// Severity is Info, Warning (default) or Critical
+	Severity RuleSeverity `json:"severity,omitempty"`
+}
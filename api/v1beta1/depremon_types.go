@@ -0,0 +1,225 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnforcementMode decides what happens to a request using a deprecated API
+// +kubebuilder:validation:Enum=Record;Warn;Deny
+type EnforcementMode string
+
+const (
+	// RecordMode only records the request into the report
+	RecordMode EnforcementMode = "Record"
+	// WarnMode records the request and returns a warning to the client
+	WarnMode EnforcementMode = "Warn"
+	// DenyMode records the request and rejects it
+	DenyMode EnforcementMode = "Deny"
+)
+
+// ReportRetentionPolicy decides what happens to the report when the Depremon
+// is deleted
+// +kubebuilder:validation:Enum=Retain;Delete
+type ReportRetentionPolicy string
+
+const (
+	// RetainReport keeps the report after the Depremon is deleted
+	RetainReport ReportRetentionPolicy = "Retain"
+	// DeleteReport deletes the report with the Depremon
+	DeleteReport ReportRetentionPolicy = "Delete"
+)
+
+// Exemption excludes requests from being recorded or enforced
+type Exemption struct {
+	// Namespaces of the objects or requesters to exempt
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Requesters to exempt, either "namespace/serviceaccount" or a user name
+	Requesters []string `json:"requesters,omitempty"`
+}
+
+// ScopeSpec selects the requests observed by the Depremon
+type ScopeSpec struct {
+	// Namespaces of the requesters to record, all of them by default
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Exemptions narrow the ClusterDepremon policy. A Depremon outside of
+	// the operator namespace only applies to objects in its own namespace.
+	Exemptions []Exemption `json:"exemptions,omitempty"`
+}
+
+// CatalogSpec selects the deprecated APIs to look for
+type CatalogSpec struct {
+	// TargetVersion is the Kubernetes version the cluster is going to be
+	// upgraded to, the current version of the cluster by default
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// Discovery configures the discovery of the deprecated APIs served by
+	// the cluster
+	Discovery DiscoverySpec `json:"discovery,omitempty"`
+}
+
+// LifecycleSpec configures the transitions of the findings
+type LifecycleSpec struct {
+	// InactivityWindow is the time after which a finding not requested with
+	// the deprecated API anymore becomes Stale, 7 days by default
+	InactivityWindow *metav1.Duration `json:"inactivityWindow,omitempty"`
+
+	// ResolvedRetentionDays is the number of days a Resolved finding is kept
+	// in the report, 30 by default
+	// +kubebuilder:validation:Minimum=1
+	ResolvedRetentionDays int32 `json:"resolvedRetentionDays,omitempty"`
+}
+
+// SnapshotSpec configures the snapshots of the report
+type SnapshotSpec struct {
+	// Interval is the time between two snapshots of the report, 24 hours by
+	// default
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Keep is the number of snapshots kept, 7 by default
+	// +kubebuilder:validation:Minimum=1
+	Keep int32 `json:"keep,omitempty"`
+}
+
+// ReportingSpec configures the report of the deprecated APIs
+type ReportingSpec struct {
+	// Retention is Retain (default) to keep the report when the Depremon is
+	// deleted, or Delete to remove it
+	Retention ReportRetentionPolicy `json:"retention,omitempty"`
+
+	// ScanInterval is the interval between two scans of the existing
+	// resources, 3 minutes by default
+	ScanInterval *metav1.Duration `json:"scanInterval,omitempty"`
+
+	// OwnerKeys are the annotations and labels holding the team owning a
+	// requester, looked for on its workloads, its service account and its
+	// namespace. Defaults to owner, team and app.kubernetes.io/part-of.
+	OwnerKeys []string `json:"ownerKeys,omitempty"`
+
+	// Lifecycle configures the transitions of the findings of the report
+	Lifecycle LifecycleSpec `json:"lifecycle,omitempty"`
+
+	// Snapshots configures the snapshots of the report
+	Snapshots SnapshotSpec `json:"snapshots,omitempty"`
+}
+
+// WebhookSpec configures the admission webhook recording deprecated APIs
+type WebhookSpec struct {
+	// FailurePolicy is Ignore (default) to admit requests when depremon is
+	// unavailable, or Fail to reject them
+	// +kubebuilder:validation:Enum=Ignore;Fail
+	FailurePolicy admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// TimeoutSeconds is the time the apiserver waits for depremon, 5 seconds
+	// by default
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=30
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// MatchPolicy is Exact (default) to only observe requests made with a
+	// deprecated version, or Equivalent to also observe requests converted by
+	// the apiserver from another version of the same resource
+	// +kubebuilder:validation:Enum=Exact;Equivalent
+	MatchPolicy admissionregistrationv1.MatchPolicyType `json:"matchPolicy,omitempty"`
+}
+
+// NotificationsSpec configures the notifications of the findings
+type NotificationsSpec struct {
+	// Sinks are the channels the findings are sent to. They are only
+	// supported in the operator namespace.
+	Sinks []NotificationSink `json:"sinks,omitempty"`
+}
+
+// DepremonSpec defines the desired state of Depremon
+type DepremonSpec struct {
+	// Scope selects the requests observed by the Depremon
+	Scope ScopeSpec `json:"scope,omitempty"`
+
+	// Catalog selects the deprecated APIs to look for
+	Catalog CatalogSpec `json:"catalog,omitempty"`
+
+	// Mode makes the enforcement stricter than the ClusterDepremon mode for
+	// the scope of the Depremon. A weaker mode has no effect.
+	Mode EnforcementMode `json:"mode,omitempty"`
+
+	// Reporting configures the report of the deprecated APIs
+	Reporting ReportingSpec `json:"reporting,omitempty"`
+
+	// Webhook configures the admission webhook
+	Webhook WebhookSpec `json:"webhook,omitempty"`
+
+	// Notifications configures the notifications of the findings
+	Notifications NotificationsSpec `json:"notifications,omitempty"`
+
+	// StorageMigration configures the migration of the custom resources
+	// stored in old versions
+	StorageMigration StorageMigrationSpec `json:"storageMigration,omitempty"`
+
+	// Rules are the conventions of the platform being retired. The rules of
+	// a Depremon outside of the operator namespace only apply to objects in
+	// its own namespace.
+	Rules []CustomRule `json:"rules,omitempty"`
+}
+
+// DepremonStatus defines the observed state of Depremon
+type DepremonStatus struct {
+	// ObservedGeneration is the last generation of the spec reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastScanTime is the time of the last scan of the existing resources
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+
+	// Readiness is the readiness of the cluster for the target version,
+	// evaluated on each scan by the Depremon objects of the operator namespace
+	Readiness *ReadinessStatus `json:"readiness,omitempty"`
+
+	// StorageMigrations are the migrations of the custom resources, run by
+	// the first Depremon of the operator namespace
+	StorageMigrations []StorageMigrationStatus `json:"storageMigrations,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Target",type=string,JSONPath=".status.readiness.targetVersion"
+//+kubebuilder:printcolumn:name="Readiness",type=string,JSONPath=".status.readiness.verdict"
+//+kubebuilder:printcolumn:name="Blocking",type=integer,JSONPath=".status.readiness.blockingCount"
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=".metadata.creationTimestamp"
+
+// Depremon is the Schema for the depremons API
+type Depremon struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DepremonSpec   `json:"spec,omitempty"`
+	Status DepremonStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DepremonList contains a list of Depremon
+type DepremonList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Depremon `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Depremon{}, &DepremonList{})
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// DiscoveryMode decides how the deprecations announced by the apiserver are
+// used
+// +kubebuilder:validation:Enum=Disabled;Validate;Build
+type DiscoveryMode string
+
+const (
+	// DiscoveryDisabled doesn't probe the served APIs
+	DiscoveryDisabled DiscoveryMode = "Disabled"
+	// DiscoveryValidate compares the deprecation warnings of the apiserver
+	// with the catalog
+	DiscoveryValidate DiscoveryMode = "Validate"
+	// DiscoveryBuild also adds the APIs the apiserver warns about to the
+	// catalog
+	DiscoveryBuild DiscoveryMode = "Build"
+)
+
+// DiscoverySpec configures the discovery of the deprecated APIs, by listing
+// each served resource and capturing the deprecation warnings of the
+// apiserver
+type DiscoverySpec struct {
+	// Mode is Disabled (default), Validate or Build
+	Mode DiscoveryMode `json:"mode,omitempty"`
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StorageMigrationSpec configures the migration of the custom resources
+// stored in old versions
+type StorageMigrationSpec struct {
+	// Enabled migrates the custom resources stored in a version which is
+	// deprecated or no longer served to the storage version, then removes the
+	// old versions from status.storedVersions
+	Enabled bool `json:"enabled,omitempty"`
+
+	// CRDs are the names of the custom resource definitions to migrate, all
+	// of them by default
+	CRDs []string `json:"crds,omitempty"`
+
+	// QPS is the maximum number of custom resources written per second, 10
+	// by default
+	// +kubebuilder:validation:Minimum=1
+	QPS int32 `json:"qps,omitempty"`
+}
+
+// MigrationPhase is the phase of the migration of a custom resource
+// definition
+// +kubebuilder:validation:Enum=Running;Succeeded;Failed;Forbidden
+type MigrationPhase string
+
+const (
+	// MigrationRunning means custom resources remain to be migrated
+	MigrationRunning MigrationPhase = "Running"
+	// MigrationSucceeded means the custom resources are migrated and the old
+	// versions are removed from status.storedVersions
+	MigrationSucceeded MigrationPhase = "Succeeded"
+	// MigrationFailed means the migration stopped on an error, it is resumed
+	// on the next scan
+	MigrationFailed MigrationPhase = "Failed"
+	// MigrationForbidden means the operator is not allowed to list or update
+	// the custom resources, it is resumed on the next scan
+	MigrationForbidden MigrationPhase = "Forbidden"
+)
+
+// StorageMigrationStatus is the progress of the migration of a custom
+// resource definition
+type StorageMigrationStatus struct {
+	// CRD is the name of the custom resource definition
+	CRD string `json:"crd"`
+	// StoredVersions are the versions the custom resources are migrated from
+	StoredVersions []string `json:"storedVersions,omitempty"`
+	// StorageVersion is the version the custom resources are migrated to
+	StorageVersion string         `json:"storageVersion"`
+	Phase          MigrationPhase `json:"phase"`
+	// Migrated is the number of custom resources written
+	Migrated int32 `json:"migrated"`
+	// Continue is the position of the next custom resources to migrate
+	Continue string `json:"continue,omitempty"`
+	// Message is the last error of the migration
+	Message        string       `json:"message,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
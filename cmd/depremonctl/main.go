@@ -0,0 +1,219 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// depremonctl reads the reports written by depremon
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	utilyaml "github.com/ghodss/yaml"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+	"github.com/horis233/k8s-deprecation-checker/controllers/readiness"
+	"github.com/horis233/k8s-deprecation-checker/controllers/snapshot"
+	"github.com/horis233/k8s-deprecation-checker/controllers/utils"
+)
+
+// notReadyCode is the exit code when the cluster isn't ready for the target
+// version
+const notReadyCode = 3
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1alpha1.AddToScheme(scheme))
+}
+
+const usage = `Usage: depremonctl [flags] COMMAND
+
+Commands:
+  snapshots        List the snapshots of the report
+  diff FROM [TO]   Show the diff between two snapshots, TO is the latest
+                   snapshot by default
+  readiness        Evaluate the readiness of the cluster for the target
+                   version, exit with 3 when it isn't ready
+
+Flags:
+`
+
+func main() {
+	var namespace, targetVersion string
+	flag.StringVar(&namespace, "namespace", "depremon", "The namespace of the operator.")
+	flag.StringVar(&targetVersion, "target-version", "", "The Kubernetes version to evaluate the readiness for, "+
+		"the target version of the Depremon objects by default.")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		exit(err)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		exit(err)
+	}
+
+	ctx := context.Background()
+	args := flag.Args()
+	switch args[0] {
+	case "snapshots":
+		err = listSnapshots(ctx, c, namespace)
+	case "diff":
+		if len(args) < 2 || len(args) > 3 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = diff(ctx, c, namespace, args[1:])
+	case "readiness":
+		var ready bool
+		if ready, err = evaluateReadiness(ctx, c, cfg, namespace, targetVersion); err == nil && !ready {
+			os.Exit(notReadyCode)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		exit(err)
+	}
+}
+
+func listSnapshots(ctx context.Context, c client.Client, namespace string) error {
+	snapshots, err := snapshot.List(ctx, c, namespace)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		objects := 0
+		for _, objList := range s.Report {
+			objects += len(objList.Objects)
+		}
+		fmt.Printf("%s\t%s\t%d objects\n", s.Name, s.Time.Format(time.RFC3339), objects)
+	}
+	return nil
+}
+
+func diff(ctx context.Context, c client.Client, namespace string, names []string) error {
+	from, err := snapshot.Get(ctx, c, namespace, names[0])
+	if err != nil {
+		return err
+	}
+
+	var to snapshot.Snapshot
+	if len(names) == 2 {
+		if to, err = snapshot.Get(ctx, c, namespace, names[1]); err != nil {
+			return err
+		}
+	} else {
+		snapshots, err := snapshot.List(ctx, c, namespace)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			return fmt.Errorf("no snapshot in namespace %s", namespace)
+		}
+		to = snapshots[len(snapshots)-1]
+	}
+
+	raw, err := utilyaml.Marshal(snapshot.Compare(from, to))
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(raw))
+	return nil
+}
+
+func evaluateReadiness(ctx context.Context, c client.Client, cfg *rest.Config, namespace, targetVersion string) (bool, error) {
+	if targetVersion == "" {
+		list := &operatorv1alpha1.DepremonList{}
+		if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return false, err
+		}
+		// like the operator, the settings are taken from the first Depremon
+		// by name
+		var first *operatorv1alpha1.Depremon
+		for i, depremon := range list.Items {
+			if depremon.GetDeletionTimestamp().IsZero() && (first == nil || depremon.Name < first.Name) {
+				first = &list.Items[i]
+			}
+		}
+		if first != nil {
+			targetVersion = first.Spec.TargetVersion
+		}
+	}
+	if targetVersion == "" {
+		var err error
+		if targetVersion, err = utils.GetClusterVersion(cfg); err != nil {
+			return false, err
+		}
+	}
+
+	p, err := policy.ForCluster(ctx, c, namespace, nil)
+	if err != nil {
+		return false, err
+	}
+	evaluator := &readiness.Evaluator{
+		Reader:    c,
+		Mapper:    c.RESTMapper(),
+		Namespace: namespace,
+	}
+	status, err := evaluator.Evaluate(ctx, p.Catalog, targetVersion)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("%s for %s, %d blocking findings\n", status.Verdict, status.TargetVersion, status.BlockingCount)
+	if len(status.UnreadableSources) != 0 {
+		fmt.Printf("can't read %s\n", strings.Join(status.UnreadableSources, ", "))
+	}
+	for _, finding := range status.BlockingFindings {
+		name := finding.Name
+		if finding.Namespace != "" {
+			name = finding.Namespace + "/" + name
+		}
+		fmt.Printf("%s\t%s/%s %s\t%s\tremoved in %s\t%s\n", finding.Source, finding.Group, finding.Version, finding.Kind,
+			name, finding.RemovedIn, finding.Message)
+	}
+	return status.Verdict == operatorv1alpha1.Ready, nil
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
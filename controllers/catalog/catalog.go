@@ -0,0 +1,93 @@
+package catalog
+
+import (
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/klog"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+// builtin is the catalog of deprecated APIs shipped with depremon
+var builtin = []operatorv1alpha1.DeprecatedAPI{
+	{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", Scope: operatorv1alpha1.NamespacedScope, RemovedIn: "v1.22", ReplacedBy: "networking.k8s.io/v1", ReplacementIntroducedIn: "v1.19"},
+	{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingressclasses", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "networking.k8s.io/v1", ReplacementIntroducedIn: "v1.19"},
+	{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "apiextensions.k8s.io/v1", ReplacementIntroducedIn: "v1.16"},
+	{Group: "admissionregistration.k8s.io", Version: "v1beta1", Resource: "mutatingwebhookconfigurations", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "admissionregistration.k8s.io/v1", ReplacementIntroducedIn: "v1.16"},
+	{Group: "admissionregistration.k8s.io", Version: "v1beta1", Resource: "validatingwebhookconfigurations", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "admissionregistration.k8s.io/v1", ReplacementIntroducedIn: "v1.16"},
+	{Group: "apiregistration.k8s.io", Version: "v1beta1", Resource: "apiservices", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "apiregistration.k8s.io/v1", ReplacementIntroducedIn: "v1.10"},
+	{Group: "coordination.k8s.io", Version: "v1beta1", Resource: "leases", Scope: operatorv1alpha1.NamespacedScope, RemovedIn: "v1.22", ReplacedBy: "coordination.k8s.io/v1", ReplacementIntroducedIn: "v1.14"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Resource: "roles", Scope: operatorv1alpha1.NamespacedScope, RemovedIn: "v1.22", ReplacedBy: "rbac.authorization.k8s.io/v1", ReplacementIntroducedIn: "v1.8"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Resource: "rolebindings", Scope: operatorv1alpha1.NamespacedScope, RemovedIn: "v1.22", ReplacedBy: "rbac.authorization.k8s.io/v1", ReplacementIntroducedIn: "v1.8"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Resource: "clusterroles", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "rbac.authorization.k8s.io/v1", ReplacementIntroducedIn: "v1.8"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Resource: "clusterrolebindings", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "rbac.authorization.k8s.io/v1", ReplacementIntroducedIn: "v1.8"},
+	{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.25"},
+	{Group: "scheduling.k8s.io", Version: "v1beta1", Resource: "priorityclasses", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "scheduling.k8s.io/v1", ReplacementIntroducedIn: "v1.14"},
+	{Group: "storage.k8s.io", Version: "v1beta1", Resource: "csidrivers", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "storage.k8s.io/v1", ReplacementIntroducedIn: "v1.18"},
+	{Group: "storage.k8s.io", Version: "v1beta1", Resource: "csinodes", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "storage.k8s.io/v1", ReplacementIntroducedIn: "v1.17"},
+	{Group: "storage.k8s.io", Version: "v1beta1", Resource: "storageclasses", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "storage.k8s.io/v1", ReplacementIntroducedIn: "v1.6"},
+	{Group: "storage.k8s.io", Version: "v1beta1", Resource: "volumeattachments", Scope: operatorv1alpha1.ClusterScope, RemovedIn: "v1.22", ReplacedBy: "storage.k8s.io/v1", ReplacementIntroducedIn: "v1.13"},
+}
+
+// Builtin returns a copy of the catalog shipped with depremon
+func Builtin() []operatorv1alpha1.DeprecatedAPI {
+	return append([]operatorv1alpha1.DeprecatedAPI{}, builtin...)
+}
+
+// Key identifies a catalog entry by its group, version and resource
+func Key(api operatorv1alpha1.DeprecatedAPI) string {
+	return api.Group + "/" + api.Version + "/" + api.Resource
+}
+
+// Merge adds the entries of overrides into base. Entries of overrides replace
+// the entries of base with the same key, the order of base is kept.
+func Merge(base []operatorv1alpha1.DeprecatedAPI, overrides ...[]operatorv1alpha1.DeprecatedAPI) []operatorv1alpha1.DeprecatedAPI {
+	merged := append([]operatorv1alpha1.DeprecatedAPI{}, base...)
+	index := make(map[string]int)
+	for i, api := range merged {
+		index[Key(api)] = i
+	}
+	for _, override := range overrides {
+		for _, api := range override {
+			if i, found := index[Key(api)]; found {
+				merged[i] = api
+				continue
+			}
+			index[Key(api)] = len(merged)
+			merged = append(merged, api)
+		}
+	}
+	return merged
+}
+
+// Lookup finds the catalog entry for a group, version and resource
+func Lookup(apis []operatorv1alpha1.DeprecatedAPI, group, version, resource string) (operatorv1alpha1.DeprecatedAPI, bool) {
+	for _, api := range apis {
+		if api.Group == group && api.Version == version && api.Resource == resource {
+			return api, true
+		}
+	}
+	return operatorv1alpha1.DeprecatedAPI{}, false
+}
+
+// RemovedBy returns the entries removed in the target version or before it
+func RemovedBy(apis []operatorv1alpha1.DeprecatedAPI, targetVersion string) ([]operatorv1alpha1.DeprecatedAPI, error) {
+	target, err := version.ParseGeneric(targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	var removed []operatorv1alpha1.DeprecatedAPI
+	for _, api := range apis {
+		if api.RemovedIn == "" {
+			continue
+		}
+		removedIn, err := version.ParseGeneric(api.RemovedIn)
+		if err != nil {
+			klog.Errorf("Invalid removal version %s of %s: %v", api.RemovedIn, Key(api), err)
+			continue
+		}
+		if !target.LessThan(removedIn) {
+			removed = append(removed, api)
+		}
+	}
+	return removed, nil
+}
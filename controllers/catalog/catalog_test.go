@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func TestMerge(t *testing.T) {
+	ingresses := operatorv1alpha1.DeprecatedAPI{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", RemovedIn: "v1.22"}
+	leases := operatorv1alpha1.DeprecatedAPI{Group: "coordination.k8s.io", Version: "v1beta1", Resource: "leases", RemovedIn: "v1.22"}
+	widgets := operatorv1alpha1.DeprecatedAPI{Group: "example.com", Version: "v1alpha1", Resource: "widgets"}
+	base := []operatorv1alpha1.DeprecatedAPI{ingresses, leases}
+
+	later := ingresses
+	later.RemovedIn = "v1.23"
+	latest := ingresses
+	latest.RemovedIn = "v1.25"
+	merged := Merge(base, []operatorv1alpha1.DeprecatedAPI{later, widgets}, []operatorv1alpha1.DeprecatedAPI{latest})
+	// the last override wins, in the position of the base entry
+	expected := []operatorv1alpha1.DeprecatedAPI{latest, leases, widgets}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("unexpected merged catalog %v", merged)
+	}
+	if base[0] != ingresses {
+		t.Error("the base catalog must not be modified")
+	}
+}
+
+func TestRemovedBy(t *testing.T) {
+	apis := []operatorv1alpha1.DeprecatedAPI{
+		{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", RemovedIn: "v1.22"},
+		{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies", RemovedIn: "v1.25"},
+		{Group: "example.com", Version: "v1alpha1", Resource: "widgets"},
+		{Group: "example.com", Version: "v1alpha1", Resource: "gadgets", RemovedIn: "next"},
+	}
+	tests := []struct {
+		target  string
+		removed int
+	}{
+		{"v1.21", 0},
+		{"v1.22", 1},
+		{"v1.22.3", 1},
+		{"1.25", 2},
+	}
+	for _, test := range tests {
+		removed, err := RemovedBy(apis, test.target)
+		if err != nil {
+			t.Errorf("%s: %v", test.target, err)
+			continue
+		}
+		if len(removed) != test.removed {
+			t.Errorf("%s: removed %v, expected %d entries", test.target, removed, test.removed)
+		}
+	}
+	if _, err := RemovedBy(apis, "latest"); err == nil {
+		t.Error("an invalid target version must fail")
+	}
+}
@@ -0,0 +1,63 @@
+package catalog
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+// FromCRDs returns the entries of the versions served and marked as
+// deprecated by the custom resource definitions. They are replaced by the
+// storage version, or by the first served version which isn't deprecated.
+func FromCRDs(crds []apiextensionsv1.CustomResourceDefinition) []operatorv1alpha1.DeprecatedAPI {
+	var apis []operatorv1alpha1.DeprecatedAPI
+	for _, crd := range crds {
+		replacement := ReplacementVersion(&crd)
+		for _, v := range crd.Spec.Versions {
+			if !v.Served || !v.Deprecated {
+				continue
+			}
+			api := operatorv1alpha1.DeprecatedAPI{
+				Group:    crd.Spec.Group,
+				Version:  v.Name,
+				Resource: crd.Spec.Names.Plural,
+				Scope:    operatorv1alpha1.ResourceScope(crd.Spec.Scope),
+			}
+			if replacement != "" && replacement != v.Name {
+				api.ReplacedBy = crd.Spec.Group + "/" + replacement
+			}
+			apis = append(apis, api)
+		}
+	}
+	return apis
+}
+
+// ReplacementVersion returns the version to migrate the deprecated versions of
+// a custom resource definition to: the storage version if it is served and
+// not deprecated, or the first such version
+func ReplacementVersion(crd *apiextensionsv1.CustomResourceDefinition) string {
+	replacement := ""
+	for _, v := range crd.Spec.Versions {
+		if !v.Served || v.Deprecated {
+			continue
+		}
+		if v.Storage {
+			return v.Name
+		}
+		if replacement == "" {
+			replacement = v.Name
+		}
+	}
+	return replacement
+}
+
+// HasDeprecatedVersion tells if a custom resource definition serves a
+// deprecated version
+func HasDeprecatedVersion(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	for _, v := range crd.Spec.Versions {
+		if v.Served && v.Deprecated {
+			return true
+		}
+	}
+	return false
+}
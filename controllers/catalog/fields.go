@@ -0,0 +1,253 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+// podTemplates are the resources embedding a pod, with the path of the pod
+var podTemplates = []struct {
+	group, resource, prefix string
+}{
+	{"", "pods", ""},
+	{"", "replicationcontrollers", "spec.template."},
+	{"apps", "deployments", "spec.template."},
+	{"apps", "replicasets", "spec.template."},
+	{"apps", "statefulsets", "spec.template."},
+	{"apps", "daemonsets", "spec.template."},
+	{"batch", "jobs", "spec.template."},
+	{"batch", "cronjobs", "spec.jobTemplate.spec.template."},
+}
+
+// podField returns the entries of a deprecated field of the pods, for the
+// pods and the resources embedding a pod
+func podField(field operatorv1alpha1.DeprecatedField) []operatorv1alpha1.DeprecatedField {
+	var fields []operatorv1alpha1.DeprecatedField
+	for _, template := range podTemplates {
+		f := field
+		f.Group = template.group
+		f.Resource = template.resource
+		f.Path = template.prefix + field.Path
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// nodeAffinityKeys are the paths of the keys of the node affinity terms
+var nodeAffinityKeys = []string{
+	"spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[*].matchExpressions[*].key",
+	"spec.affinity.nodeAffinity.preferredDuringSchedulingIgnoredDuringExecution[*].preference.matchExpressions[*].key",
+}
+
+// betaNodeLabels are the deprecated labels of the nodes and their
+// replacements
+var betaNodeLabels = []struct {
+	label, replacedBy string
+}{
+	{"beta.kubernetes.io/os", "kubernetes.io/os"},
+	{"beta.kubernetes.io/arch", "kubernetes.io/arch"},
+	{"failure-domain.beta.kubernetes.io/zone", "topology.kubernetes.io/zone"},
+	{"failure-domain.beta.kubernetes.io/region", "topology.kubernetes.io/region"},
+}
+
+// builtinFields is the catalog of deprecated fields shipped with depremon
+var builtinFields = func() []operatorv1alpha1.DeprecatedField {
+	fields := []operatorv1alpha1.DeprecatedField{
+		{Group: "networking.k8s.io", Resource: "ingresses", Path: "metadata.annotations[kubernetes.io/ingress.class]", ReplacedBy: "spec.ingressClassName"},
+		{Group: "rbac.authorization.k8s.io", Resource: "roles", Path: "rules[*].resources[*]", Value: "podsecuritypolicies", RemovedIn: "v1.25"},
+		{Group: "rbac.authorization.k8s.io", Resource: "clusterroles", Path: "rules[*].resources[*]", Value: "podsecuritypolicies", RemovedIn: "v1.25"},
+	}
+	fields = append(fields, podField(operatorv1alpha1.DeprecatedField{Path: "metadata.annotations[seccomp.security.alpha.kubernetes.io/pod]", ReplacedBy: "spec.securityContext.seccompProfile"})...)
+	fields = append(fields, podField(operatorv1alpha1.DeprecatedField{Path: "metadata.annotations[container.seccomp.security.alpha.kubernetes.io/*]", ReplacedBy: "spec.containers[*].securityContext.seccompProfile"})...)
+	fields = append(fields, podField(operatorv1alpha1.DeprecatedField{Path: "metadata.annotations[scheduler.alpha.kubernetes.io/critical-pod]", RemovedIn: "v1.16", ReplacedBy: "spec.priorityClassName"})...)
+	fields = append(fields, podField(operatorv1alpha1.DeprecatedField{Path: "spec.serviceAccount", ReplacedBy: "spec.serviceAccountName"})...)
+	for _, label := range betaNodeLabels {
+		fields = append(fields, podField(operatorv1alpha1.DeprecatedField{Path: "spec.nodeSelector[" + label.label + "]", ReplacedBy: label.replacedBy})...)
+		for _, path := range nodeAffinityKeys {
+			fields = append(fields, podField(operatorv1alpha1.DeprecatedField{Path: path, Value: label.label, ReplacedBy: label.replacedBy})...)
+		}
+	}
+	return fields
+}()
+
+// BuiltinFields returns a copy of the deprecated fields shipped with depremon
+func BuiltinFields() []operatorv1alpha1.DeprecatedField {
+	return append([]operatorv1alpha1.DeprecatedField{}, builtinFields...)
+}
+
+// FieldKey identifies a deprecated field by its group, resource, path and
+// value
+func FieldKey(field operatorv1alpha1.DeprecatedField) string {
+	return field.Group + "/" + field.Resource + "/" + field.Path + "=" + field.Value
+}
+
+// MergeFields adds the fields of overrides into base, like Merge
+func MergeFields(base []operatorv1alpha1.DeprecatedField, overrides ...[]operatorv1alpha1.DeprecatedField) []operatorv1alpha1.DeprecatedField {
+	merged := append([]operatorv1alpha1.DeprecatedField{}, base...)
+	index := make(map[string]int)
+	for i, field := range merged {
+		index[FieldKey(field)] = i
+	}
+	for _, override := range overrides {
+		for _, field := range override {
+			if i, found := index[FieldKey(field)]; found {
+				merged[i] = field
+				continue
+			}
+			index[FieldKey(field)] = len(merged)
+			merged = append(merged, field)
+		}
+	}
+	return merged
+}
+
+// FieldsFor returns the deprecated fields of a group, version and resource
+func FieldsFor(fields []operatorv1alpha1.DeprecatedField, group, version, resource string) []operatorv1alpha1.DeprecatedField {
+	var matching []operatorv1alpha1.DeprecatedField
+	for _, field := range fields {
+		if field.Group != group || field.Resource != resource {
+			continue
+		}
+		if len(field.Versions) != 0 && !contains(field.Versions, version) {
+			continue
+		}
+		matching = append(matching, field)
+	}
+	return matching
+}
+
+// FieldUse is a deprecated field set in an object
+type FieldUse struct {
+	Field operatorv1alpha1.DeprecatedField
+	// Path of the field in the object, with the indexes of the items and the
+	// keys of the maps, e.g. spec.containers[0].image
+	Path string
+}
+
+// Message describes the use of the field
+func (u FieldUse) Message() string {
+	message := fmt.Sprintf("%s is deprecated", u.Path)
+	if u.Field.Value != "" {
+		message = fmt.Sprintf("%s %s is deprecated", u.Path, u.Field.Value)
+	}
+	if u.Field.RemovedIn != "" {
+		message += fmt.Sprintf(" and removed in %s", u.Field.RemovedIn)
+	}
+	if u.Field.ReplacedBy != "" {
+		message += fmt.Sprintf(", use %s instead", u.Field.ReplacedBy)
+	}
+	return message
+}
+
+// FindFields returns the deprecated fields set in an object decoded from JSON
+func FindFields(fields []operatorv1alpha1.DeprecatedField, obj map[string]interface{}) []FieldUse {
+	var uses []FieldUse
+	for _, field := range fields {
+		segments, err := parsePath(field.Path)
+		if err != nil {
+			continue
+		}
+		for _, path := range find(obj, segments, "", field.Value) {
+			uses = append(uses, FieldUse{Field: field, Path: path})
+		}
+	}
+	return uses
+}
+
+// segment is a part of the path of a field: a field name, or a key of a map
+// or [*] when key is set
+type segment struct {
+	name string
+	key  bool
+}
+
+// parsePath splits a path like spec.containers[*].env[FOO] into segments
+func parsePath(path string) ([]segment, error) {
+	var segments []segment
+	for path != "" {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in %s", path)
+			}
+			segments = append(segments, segment{name: path[1:end], key: true})
+			path = path[end+1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			segments = append(segments, segment{name: path[:end]})
+			path = path[end:]
+		}
+	}
+	return segments, nil
+}
+
+// find returns the concrete paths of the values matching the segments
+func find(value interface{}, segments []segment, path, expected string) []string {
+	if len(segments) == 0 {
+		if value == nil || (expected != "" && fmt.Sprint(value) != expected) {
+			return nil
+		}
+		return []string{path}
+	}
+
+	current := segments[0]
+	var paths []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if !current.key {
+			if child, found := v[current.name]; found {
+				childPath := current.name
+				if path != "" {
+					childPath = path + "." + current.name
+				}
+				paths = append(paths, find(child, segments[1:], childPath, expected)...)
+			}
+			break
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			if matchesKey(current.name, key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			paths = append(paths, find(v[key], segments[1:], path+"["+key+"]", expected)...)
+		}
+	case []interface{}:
+		if !current.key || current.name != "*" {
+			break
+		}
+		for i, item := range v {
+			paths = append(paths, find(item, segments[1:], fmt.Sprintf("%s[%d]", path, i), expected)...)
+		}
+	}
+	return paths
+}
+
+// matchesKey tells if a key of a map matches a pattern, which can end with *
+// to match a prefix
+func matchesKey(pattern, key string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(key, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
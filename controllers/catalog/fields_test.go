@@ -0,0 +1,163 @@
+package catalog
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []segment
+		invalid  bool
+	}{
+		{path: "spec.serviceAccount", expected: []segment{{name: "spec"}, {name: "serviceAccount"}}},
+		{path: "spec.containers[*].env[FOO]", expected: []segment{
+			{name: "spec"}, {name: "containers"}, {name: "*", key: true}, {name: "env"}, {name: "FOO", key: true},
+		}},
+		{path: "metadata.annotations[kubernetes.io/ingress.class]", expected: []segment{
+			{name: "metadata"}, {name: "annotations"}, {name: "kubernetes.io/ingress.class", key: true},
+		}},
+		{path: "metadata.annotations[container.seccomp.security.alpha.kubernetes.io/*]", expected: []segment{
+			{name: "metadata"}, {name: "annotations"}, {name: "container.seccomp.security.alpha.kubernetes.io/*", key: true},
+		}},
+		{path: "spec.nodeSelector[beta.kubernetes.io/os", invalid: true},
+	}
+	for _, test := range tests {
+		segments, err := parsePath(test.path)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("parsePath(%q) succeeded, expected an error", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePath(%q) failed: %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(segments, test.expected) {
+			t.Errorf("parsePath(%q) = %v, expected %v", test.path, segments, test.expected)
+		}
+	}
+}
+
+const pod = `{
+	"metadata": {
+		"annotations": {
+			"container.seccomp.security.alpha.kubernetes.io/app": "runtime/default",
+			"container.seccomp.security.alpha.kubernetes.io/sidecar": "unconfined",
+			"other": "value"
+		}
+	},
+	"spec": {
+		"serviceAccount": "builder",
+		"nodeSelector": {"beta.kubernetes.io/os": "linux"},
+		"affinity": {
+			"nodeAffinity": {
+				"requiredDuringSchedulingIgnoredDuringExecution": {
+					"nodeSelectorTerms": [
+						{"matchExpressions": [{"key": "kubernetes.io/os"}, {"key": "beta.kubernetes.io/arch"}]},
+						{"matchExpressions": [{"key": "beta.kubernetes.io/arch"}]}
+					]
+				}
+			}
+		}
+	}
+}`
+
+func decode(t *testing.T, raw string) map[string]interface{} {
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestFind(t *testing.T) {
+	obj := decode(t, pod)
+	tests := []struct {
+		path, value string
+		expected    []string
+	}{
+		{path: "spec.serviceAccount", expected: []string{"spec.serviceAccount"}},
+		{path: "spec.serviceAccountName"},
+		{path: "spec.nodeSelector[beta.kubernetes.io/os]", expected: []string{"spec.nodeSelector[beta.kubernetes.io/os]"}},
+		{path: "metadata.annotations[container.seccomp.security.alpha.kubernetes.io/*]", expected: []string{
+			"metadata.annotations[container.seccomp.security.alpha.kubernetes.io/app]",
+			"metadata.annotations[container.seccomp.security.alpha.kubernetes.io/sidecar]",
+		}},
+		{path: "metadata.annotations[*]", expected: []string{
+			"metadata.annotations[container.seccomp.security.alpha.kubernetes.io/app]",
+			"metadata.annotations[container.seccomp.security.alpha.kubernetes.io/sidecar]",
+			"metadata.annotations[other]",
+		}},
+		{
+			path:  "spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[*].matchExpressions[*].key",
+			value: "beta.kubernetes.io/arch",
+			expected: []string{
+				"spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[0].matchExpressions[1].key",
+				"spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[1].matchExpressions[0].key",
+			},
+		},
+		{
+			path:  "spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[*].matchExpressions[*].key",
+			value: "beta.kubernetes.io/os",
+		},
+		// a list only matches [*], and a map doesn't match an index
+		{path: "spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[0]"},
+		{path: "spec.nodeSelector.beta"},
+	}
+	for _, test := range tests {
+		segments, err := parsePath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := find(obj, segments, "", test.value)
+		if !reflect.DeepEqual(paths, test.expected) {
+			t.Errorf("find(%q, %q) = %v, expected %v", test.path, test.value, paths, test.expected)
+		}
+	}
+}
+
+func TestFindFields(t *testing.T) {
+	fields := FieldsFor(BuiltinFields(), "", "v1", "pods")
+	uses := FindFields(fields, decode(t, pod))
+
+	var paths []string
+	for _, use := range uses {
+		paths = append(paths, use.Path)
+	}
+	expected := []string{
+		"metadata.annotations[container.seccomp.security.alpha.kubernetes.io/app]",
+		"metadata.annotations[container.seccomp.security.alpha.kubernetes.io/sidecar]",
+		"spec.serviceAccount",
+		"spec.nodeSelector[beta.kubernetes.io/os]",
+		"spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[0].matchExpressions[1].key",
+		"spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[1].matchExpressions[0].key",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("FindFields() = %v, expected %v", paths, expected)
+	}
+
+	message := uses[len(uses)-1].Message()
+	if message != "spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[1].matchExpressions[0].key "+
+		"beta.kubernetes.io/arch is deprecated, use kubernetes.io/arch instead" {
+		t.Errorf("unexpected message %q", message)
+	}
+}
+
+func TestFindFieldsInTemplates(t *testing.T) {
+	deployment := decode(t, `{"spec": {"template": {"spec": {"serviceAccount": "builder"}}}}`)
+	uses := FindFields(FieldsFor(BuiltinFields(), "apps", "v1", "deployments"), deployment)
+	if len(uses) != 1 || uses[0].Path != "spec.template.spec.serviceAccount" {
+		t.Errorf("FindFields() = %v, expected spec.template.spec.serviceAccount", uses)
+	}
+
+	fields := []operatorv1alpha1.DeprecatedField{{Group: "apps", Versions: []string{"v1beta2"}, Resource: "deployments", Path: "spec.template.spec.serviceAccount"}}
+	if matching := FieldsFor(fields, "apps", "v1", "deployments"); len(matching) != 0 {
+		t.Errorf("FieldsFor() = %v, expected no field for another version", matching)
+	}
+}
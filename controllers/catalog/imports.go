@@ -0,0 +1,120 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	utilyaml "github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+// plutoVersions is the part of the versions.yaml file of pluto used to build
+// the catalog
+type plutoVersions struct {
+	DeprecatedVersions []struct {
+		Version                string `json:"version"`
+		Kind                   string `json:"kind"`
+		DeprecatedIn           string `json:"deprecated-in"`
+		RemovedIn              string `json:"removed-in"`
+		ReplacementAPI         string `json:"replacement-api"`
+		ReplacementAvailableIn string `json:"replacement-available-in"`
+	} `json:"deprecated-versions"`
+}
+
+// FromPluto returns the entries of a versions.yaml file of pluto. Pluto lists
+// kinds, their resources are guessed from the kinds.
+func FromPluto(data []byte) ([]operatorv1alpha1.DeprecatedAPI, error) {
+	versions := &plutoVersions{}
+	if err := utilyaml.Unmarshal(data, versions); err != nil {
+		return nil, err
+	}
+
+	var apis []operatorv1alpha1.DeprecatedAPI
+	for _, v := range versions.DeprecatedVersions {
+		gv, err := schema.ParseGroupVersion(v.Version)
+		if err != nil || gv.Version == "" || v.Kind == "" {
+			return nil, fmt.Errorf("invalid pluto entry %s %s", v.Version, v.Kind)
+		}
+		api := operatorv1alpha1.DeprecatedAPI{
+			Group:                   gv.Group,
+			Version:                 gv.Version,
+			Resource:                resourceFor(gv.WithKind(v.Kind)),
+			RemovedIn:               minorVersion(v.RemovedIn),
+			ReplacementIntroducedIn: minorVersion(v.ReplacementAvailableIn),
+		}
+		if replacement, err := schema.ParseGroupVersion(v.ReplacementAPI); err == nil && v.ReplacementAPI != "" {
+			api.ReplacedBy = replacement.String()
+		}
+		apis = append(apis, api)
+	}
+	return apis, nil
+}
+
+// swagger is the part of the swagger.json file of a Kubernetes release used
+// by kubepug to find the deprecated APIs
+type swagger struct {
+	Definitions map[string]struct {
+		Description string                    `json:"description"`
+		GVKs        []schema.GroupVersionKind `json:"x-kubernetes-group-version-kind"`
+	} `json:"definitions"`
+}
+
+var (
+	// deprecatedDescription matches the descriptions of the deprecated
+	// definitions, as kubepug does
+	deprecatedDescription = regexp.MustCompile(`(?i)\bdeprecated\b`)
+	// replacementDescription captures the group version to migrate to, e.g.
+	// "deprecated by apps/v1/Deployment" or "use networking.k8s.io/v1 Ingress"
+	replacementDescription = regexp.MustCompile(`(?i)(?:deprecated by|deprecated in favor of|use) ([a-z0-9.-]+/v[0-9]+(?:(?:alpha|beta)[0-9]+)?)\b`)
+)
+
+// FromKubepug returns the entries of the definitions marked as deprecated in
+// their description by a swagger.json file, the data kubepug is built on.
+// The swagger doesn't tell when an API is removed.
+func FromKubepug(data []byte) ([]operatorv1alpha1.DeprecatedAPI, error) {
+	spec := &swagger{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+
+	var apis []operatorv1alpha1.DeprecatedAPI
+	for _, definition := range spec.Definitions {
+		if len(definition.GVKs) != 1 || !deprecatedDescription.MatchString(definition.Description) {
+			continue
+		}
+		gvk := definition.GVKs[0]
+		api := operatorv1alpha1.DeprecatedAPI{
+			Group:    gvk.Group,
+			Version:  gvk.Version,
+			Resource: resourceFor(gvk),
+		}
+		if match := replacementDescription.FindStringSubmatch(definition.Description); match != nil &&
+			match[1] != gvk.GroupVersion().String() {
+			api.ReplacedBy = match[1]
+		}
+		apis = append(apis, api)
+	}
+	sort.Slice(apis, func(i, j int) bool { return Key(apis[i]) < Key(apis[j]) })
+	return apis, nil
+}
+
+func resourceFor(gvk schema.GroupVersionKind) string {
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return plural.Resource
+}
+
+// minorVersion returns a Kubernetes version as vMAJOR.MINOR like the built-in
+// catalog, e.g. v1.16 for v1.16.0
+func minorVersion(v string) string {
+	parsed, err := version.ParseGeneric(v)
+	if err != nil {
+		return v
+	}
+	return fmt.Sprintf("v%d.%d", parsed.Major(), parsed.Minor())
+}
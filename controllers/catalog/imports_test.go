@@ -0,0 +1,62 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func TestFromPluto(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/pluto-versions.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apis, err := FromPluto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []operatorv1alpha1.DeprecatedAPI{
+		{Group: "extensions", Version: "v1beta1", Resource: "ingresses", RemovedIn: "v1.22",
+			ReplacedBy: "networking.k8s.io/v1", ReplacementIntroducedIn: "v1.19"},
+		{Group: "batch", Version: "v1beta1", Resource: "cronjobs", RemovedIn: "v1.25",
+			ReplacedBy: "batch/v1", ReplacementIntroducedIn: "v1.21"},
+		{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies", RemovedIn: "v1.25"},
+		{Group: "", Version: "v1", Resource: "componentstatuses"},
+	}
+	if !reflect.DeepEqual(apis, expected) {
+		t.Errorf("FromPluto returned %+v, expected %+v", apis, expected)
+	}
+
+	if _, err := FromPluto([]byte("deprecated-versions:\n- version: extensions/v1beta1\n")); err == nil {
+		t.Error("an entry without kind must fail")
+	}
+	if _, err := FromPluto([]byte("deprecated-versions: [")); err == nil {
+		t.Error("invalid YAML must fail")
+	}
+}
+
+func TestFromKubepug(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/kubepug-swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apis, err := FromKubepug(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the definitions with several kinds, like the options, are skipped
+	expected := []operatorv1alpha1.DeprecatedAPI{
+		{Group: "", Version: "v1", Resource: "componentstatuses"},
+		{Group: "extensions", Version: "v1beta1", Resource: "ingresses", ReplacedBy: "networking.k8s.io/v1beta1"},
+		{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", ReplacedBy: "networking.k8s.io/v1"},
+	}
+	if !reflect.DeepEqual(apis, expected) {
+		t.Errorf("FromKubepug returned %+v, expected %+v", apis, expected)
+	}
+
+	if _, err := FromKubepug([]byte("{")); err == nil {
+		t.Error("invalid JSON must fail")
+	}
+}
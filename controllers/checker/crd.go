@@ -0,0 +1,213 @@
+package checker
+
+import (
+	"context"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+const (
+	// CRDReportName is the name of the config map holding the report of the
+	// custom resource definition versions
+	CRDReportName = "deprecated-api-crd-report"
+	// CRDReportKey is the key of the report in the config map
+	CRDReportKey = "deprecated-api-crd-report.yaml"
+)
+
+// CRDVersion is a version of a custom resource definition which is deprecated
+// and still served or stored, or which is stored but no longer served
+type CRDVersion struct {
+	CRD     string `json:"crd"`
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+
+	Deprecated         bool   `json:"deprecated"`
+	DeprecationWarning string `json:"deprecationWarning,omitempty"`
+	Served             bool   `json:"served"`
+	// Storage tells if the new objects are stored in the version
+	Storage bool `json:"storage"`
+	// Stored tells if the version is listed in status.storedVersions, so the
+	// version can't be removed from the custom resource definition
+	Stored bool `json:"stored"`
+	// Objects is the number of custom resources which may still be stored in
+	// the version: all of them while it is stored, until they are migrated.
+	// It is unset when the custom resources can't be listed.
+	Objects *int `json:"objects,omitempty"`
+
+	// ReplacedBy is the version to migrate to
+	ReplacedBy string `json:"replacedBy,omitempty"`
+}
+
+// CRDChecks writes the report of the custom resource definition versions to
+// the given namespace. The custom resources are counted with reader.
+func CRDChecks(ctx context.Context, c client.Client, reader client.Reader, namespace string) error {
+	list := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := c.List(ctx, list); err != nil {
+		return err
+	}
+
+	var versions []CRDVersion
+	for i := range list.Items {
+		crdVersions, err := scanCRD(ctx, reader, &list.Items[i])
+		if err != nil {
+			return err
+		}
+		versions = append(versions, crdVersions...)
+	}
+
+	return writeReport(ctx, c, namespace, CRDReportName, CRDReportKey, versions, len(versions) == 0)
+}
+
+// writeReport writes data to the key of a config map, or deletes the config
+// map when empty is set
+func writeReport(ctx context.Context, c client.Client, namespace, name, key string, data interface{}, empty bool) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	if empty {
+		if err := c.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	rawData, err := utilyaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, c, cm, func() error {
+		cm.Data = map[string]string{key: string(rawData)}
+		return nil
+	})
+	return err
+}
+
+// DeleteReports deletes the reports written by the scans
+func DeleteReports(ctx context.Context, c client.Client, namespace string) error {
+	for _, name := range []string{CRDReportName, ReviewReportName, PSPReportName, DiscoveryReportName, RemovedReportName} {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+		}
+		if err := c.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanCRD(ctx context.Context, reader client.Reader, crd *apiextensionsv1.CustomResourceDefinition) ([]CRDVersion, error) {
+	stored := make(map[string]bool)
+	for _, v := range crd.Status.StoredVersions {
+		stored[v] = true
+	}
+	replacement := catalog.ReplacementVersion(crd)
+
+	var versions []CRDVersion
+	listed := make(map[string]bool)
+	for _, v := range crd.Spec.Versions {
+		listed[v.Name] = true
+		if !(v.Deprecated && (v.Served || stored[v.Name])) && !(stored[v.Name] && !v.Served) {
+			continue
+		}
+		version := CRDVersion{
+			CRD:        crd.Name,
+			Group:      crd.Spec.Group,
+			Version:    v.Name,
+			Kind:       crd.Spec.Names.Kind,
+			Deprecated: v.Deprecated,
+			Served:     v.Served,
+			Storage:    v.Storage,
+			Stored:     stored[v.Name],
+		}
+		if v.DeprecationWarning != nil {
+			version.DeprecationWarning = *v.DeprecationWarning
+		}
+		if replacement != v.Name {
+			version.ReplacedBy = replacement
+		}
+		versions = append(versions, version)
+	}
+	// Versions removed from the spec can still be stored
+	for _, v := range crd.Status.StoredVersions {
+		if listed[v] {
+			continue
+		}
+		versions = append(versions, CRDVersion{
+			CRD:        crd.Name,
+			Group:      crd.Spec.Group,
+			Version:    v,
+			Kind:       crd.Spec.Names.Kind,
+			Stored:     true,
+			ReplacedBy: replacement,
+		})
+	}
+
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	objects, err := countObjects(ctx, reader, crd)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].Stored {
+			versions[i].Objects = objects
+		}
+	}
+	return versions, nil
+}
+
+// countObjects counts the custom resources of a custom resource definition,
+// read with its replacement version. It returns nil when they can't be read.
+func countObjects(ctx context.Context, reader client.Reader, crd *apiextensionsv1.CustomResourceDefinition) (*int, error) {
+	version := catalog.ReplacementVersion(crd)
+	if version == "" {
+		for _, v := range crd.Spec.Versions {
+			if v.Served {
+				version = v.Name
+				break
+			}
+		}
+	}
+	if version == "" {
+		return nil, nil
+	}
+
+	count := 0
+	list := &metav1.PartialObjectMetadataList{}
+	listKind := crd.Spec.Names.ListKind
+	if listKind == "" {
+		listKind = crd.Spec.Names.Kind + "List"
+	}
+	list.SetGroupVersionKind(schema.GroupVersionKind{Group: crd.Spec.Group, Version: version, Kind: listKind})
+	for {
+		if err := reader.List(ctx, list, client.Limit(500), client.Continue(list.Continue)); err != nil {
+			if errors.IsForbidden(err) {
+				klog.Infof("Can't list %s: %v", crd.Name, err)
+				return nil, nil
+			}
+			return nil, err
+		}
+		count += len(list.Items)
+		if list.Continue == "" {
+			return &count, nil
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// objectsReader lists a number of custom resources, pageSize per page, and
+// records the version they are listed with
+type objectsReader struct {
+	client.Reader
+	objects   int
+	pageSize  int
+	forbidden bool
+	listed    string
+}
+
+func (r *objectsReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk := list.GetObjectKind().GroupVersionKind()
+	r.listed = gvk.Version
+	if r.forbidden {
+		return errors.NewForbidden(schema.GroupResource{Group: gvk.Group, Resource: "widgets"}, "", fmt.Errorf("denied"))
+	}
+	options := &client.ListOptions{}
+	options.ApplyOptions(opts)
+	start := 0
+	if options.Continue != "" {
+		start, _ = strconv.Atoi(options.Continue)
+	}
+	end := start + r.pageSize
+	metadata := list.(*metav1.PartialObjectMetadataList)
+	metadata.Items = nil
+	metadata.Continue = ""
+	for i := start; i < end && i < r.objects; i++ {
+		metadata.Items = append(metadata.Items, metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(i)}})
+	}
+	if end < r.objects {
+		metadata.Continue = strconv.Itoa(end)
+	}
+	return nil
+}
+
+func widgetCRD(stored []string, versions ...apiextensionsv1.CustomResourceDefinitionVersion) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    "example.com",
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Kind: "Widget"},
+			Versions: versions,
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: stored},
+	}
+}
+
+func TestScanCRD(t *testing.T) {
+	v1 := apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1", Served: true, Storage: true}
+	v1beta1 := apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1beta1", Served: true, Deprecated: true}
+	unserved := apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1beta1"}
+
+	tests := []struct {
+		name      string
+		crd       *apiextensionsv1.CustomResourceDefinition
+		forbidden bool
+		expected  []string
+		objects   map[string]int
+	}{
+		{
+			name: "no deprecated version",
+			crd:  widgetCRD([]string{"v1"}, v1),
+		},
+		{
+			name:     "deprecated version migrated",
+			crd:      widgetCRD([]string{"v1"}, v1, v1beta1),
+			expected: []string{"v1beta1"},
+		},
+		{
+			name:     "deprecated version stored",
+			crd:      widgetCRD([]string{"v1beta1", "v1"}, v1, v1beta1),
+			expected: []string{"v1beta1"},
+			objects:  map[string]int{"v1beta1": 1200},
+		},
+		{
+			name:     "stored version no longer served",
+			crd:      widgetCRD([]string{"v1beta1", "v1"}, v1, unserved),
+			expected: []string{"v1beta1"},
+			objects:  map[string]int{"v1beta1": 1200},
+		},
+		{
+			name:     "stored version removed from the spec",
+			crd:      widgetCRD([]string{"v1alpha1", "v1"}, v1),
+			expected: []string{"v1alpha1"},
+			objects:  map[string]int{"v1alpha1": 1200},
+		},
+		{
+			name:      "custom resources not readable",
+			crd:       widgetCRD([]string{"v1beta1", "v1"}, v1, v1beta1),
+			forbidden: true,
+			expected:  []string{"v1beta1"},
+		},
+	}
+	for _, test := range tests {
+		reader := &objectsReader{objects: 1200, pageSize: 500, forbidden: test.forbidden}
+		versions, err := scanCRD(context.Background(), reader, test.crd)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(versions) != len(test.expected) {
+			t.Errorf("%s: unexpected versions %v", test.name, versions)
+			continue
+		}
+		for i, version := range versions {
+			if version.Version != test.expected[i] || version.ReplacedBy != "v1" {
+				t.Errorf("%s: unexpected version %s replaced by %q", test.name, version.Version, version.ReplacedBy)
+			}
+			count, counted := test.objects[version.Version]
+			if !counted && version.Objects != nil {
+				t.Errorf("%s: %d objects counted in %s", test.name, *version.Objects, version.Version)
+			}
+			if counted && (version.Objects == nil || *version.Objects != count) {
+				t.Errorf("%s: objects of %s not counted, expected %d", test.name, version.Version, count)
+			}
+		}
+		if len(test.objects) != 0 && reader.listed != "v1" {
+			t.Errorf("%s: custom resources listed with %q, expected the replacement version", test.name, reader.listed)
+		}
+	}
+}
+
+func TestCountObjectsWithoutServedVersion(t *testing.T) {
+	crd := widgetCRD([]string{"v1"}, apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1", Storage: true})
+	count, err := countObjects(context.Background(), &objectsReader{objects: 3, pageSize: 500}, crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != nil {
+		t.Errorf("%d objects counted without a served version", *count)
+	}
+}
@@ -0,0 +1,118 @@
+package checker
+
+import (
+	"context"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+	"github.com/horis233/k8s-deprecation-checker/controllers/probe"
+)
+
+const (
+	// DiscoveryReportName is the name of the config map holding the
+	// comparison of the deprecation warnings of the apiserver with the
+	// catalog
+	DiscoveryReportName = "deprecated-api-discovery-report"
+	// DiscoveryReportKey is the key of the report in the config map
+	DiscoveryReportKey = "deprecated-api-discovery-report.yaml"
+)
+
+// DiscoveryReport compares the APIs the apiserver warns about with the
+// catalog
+type DiscoveryReport struct {
+	// ProbeTime is the time the served APIs were probed
+	ProbeTime metav1.Time `json:"probeTime"`
+	// Discovered are the served APIs the apiserver warns about
+	Discovered []operatorv1alpha1.DeprecatedAPI `json:"discovered,omitempty"`
+	// Missing are the discovered APIs missing from the catalog
+	Missing []string `json:"missing,omitempty"`
+	// Mismatched are the discovered APIs removed in another version than
+	// the one of the catalog
+	Mismatched []DiscoveryMismatch `json:"mismatched,omitempty"`
+	// Unconfirmed are the APIs of the catalog served without a deprecation
+	// warning
+	Unconfirmed []string `json:"unconfirmed,omitempty"`
+	// Skipped are the resources which couldn't be listed
+	Skipped []string `json:"skipped,omitempty"`
+	// Forbidden are the resources the operator isn't allowed to list, their
+	// deprecation is unknown
+	Forbidden []string `json:"forbidden,omitempty"`
+}
+
+// DiscoveryMismatch is an API removed in another version than the one of the
+// catalog
+type DiscoveryMismatch struct {
+	API              string `json:"api"`
+	CatalogRemovedIn string `json:"catalogRemovedIn,omitempty"`
+	ClusterRemovedIn string `json:"clusterRemovedIn"`
+}
+
+// DiscoveryChecks probes the served APIs and writes the comparison of the
+// deprecation warnings with the catalog configured by the built-in entries,
+// the imported catalogs, the custom resource definitions and the
+// ClusterDepremon objects. In the Build mode, the discovered APIs are also
+// added to the catalog of prober.
+func DiscoveryChecks(ctx context.Context, c client.Client, reader client.Reader, prober *probe.Prober, namespace string, mode operatorv1alpha1.DiscoveryMode) error {
+	if mode != operatorv1alpha1.DiscoveryValidate && mode != operatorv1alpha1.DiscoveryBuild {
+		prober.Disable()
+		return writeReport(ctx, c, namespace, DiscoveryReportName, DiscoveryReportKey, nil, true)
+	}
+
+	result, err := prober.Run(ctx, mode == operatorv1alpha1.DiscoveryBuild)
+	if err != nil {
+		return err
+	}
+
+	configured, err := policy.Configured(ctx, reader, namespace)
+	if err != nil {
+		return err
+	}
+
+	report := DiscoveryReport{
+		ProbeTime:  metav1.NewTime(result.Time),
+		Discovered: result.APIs,
+		Skipped:    result.Skipped,
+		Forbidden:  result.Forbidden,
+	}
+	warned := make(map[string]bool)
+	for _, api := range result.APIs {
+		warned[catalog.Key(api)] = true
+		entry, found := catalog.Lookup(configured, api.Group, api.Version, api.Resource)
+		if !found {
+			report.Missing = append(report.Missing, catalog.Key(api))
+			continue
+		}
+		if api.RemovedIn != "" && api.RemovedIn != entry.RemovedIn {
+			report.Mismatched = append(report.Mismatched, DiscoveryMismatch{
+				API:              catalog.Key(api),
+				CatalogRemovedIn: entry.RemovedIn,
+				ClusterRemovedIn: api.RemovedIn,
+			})
+		}
+	}
+	skipped := make(map[string]bool)
+	for _, key := range result.Skipped {
+		skipped[key] = true
+	}
+	for _, key := range result.Forbidden {
+		skipped[key] = true
+	}
+	for _, api := range configured {
+		key := catalog.Key(api)
+		if result.Served.Serves(api) && !warned[key] && !skipped[key] {
+			report.Unconfirmed = append(report.Unconfirmed, key)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Unconfirmed)
+
+	klog.Infof("The apiserver warns about %d APIs, %d are missing from the catalog, %d resources can't be listed",
+		len(report.Discovered), len(report.Missing), len(report.Forbidden))
+	return writeReport(ctx, c, namespace, DiscoveryReportName, DiscoveryReportKey, report, false)
+}
@@ -0,0 +1,533 @@
+package checker
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/horis233/k8s-deprecation-checker/controllers/workload"
+)
+
+const (
+	// PSPReportName is the name of the config map holding the readiness of
+	// the cluster for the removal of PodSecurityPolicy
+	PSPReportName = "deprecated-api-psp-report"
+	// PSPReportKey is the key of the report in the config map
+	PSPReportKey = "deprecated-api-psp-report.yaml"
+
+	// pspAnnotation is set on the pods by the PodSecurityPolicy admission
+	// plugin, with the name of the policy admitting them
+	pspAnnotation = "kubernetes.io/psp"
+	// enforceLabel sets the level enforced by Pod Security Admission on a
+	// namespace
+	enforceLabel = "pod-security.kubernetes.io/enforce"
+	// seccompProfilesAnnotation lists the seccomp profiles allowed by a
+	// PodSecurityPolicy
+	seccompProfilesAnnotation = "seccomp.security.alpha.kubernetes.io/allowedProfileNames"
+	// appArmorProfilesAnnotation lists the AppArmor profiles allowed by a
+	// PodSecurityPolicy, any profile is allowed without it
+	appArmorProfilesAnnotation = "apparmor.security.beta.kubernetes.io/allowedProfileNames"
+	// podPageSize is the number of pods listed at once
+	podPageSize = 500
+)
+
+// PodSecurityLevel is a level of the Pod Security Standards
+type PodSecurityLevel string
+
+const (
+	PrivilegedLevel PodSecurityLevel = "privileged"
+	BaselineLevel   PodSecurityLevel = "baseline"
+	RestrictedLevel PodSecurityLevel = "restricted"
+)
+
+// levelStrictness orders the levels, the least strict level keeps allowing
+// the pods of all the policies
+var levelStrictness = map[PodSecurityLevel]int{
+	PrivilegedLevel: 0,
+	BaselineLevel:   1,
+	RestrictedLevel: 2,
+}
+
+// PSPReport is the readiness of the cluster for the removal of
+// PodSecurityPolicy
+type PSPReport struct {
+	PodSecurityPolicies []PSPFinding   `json:"podSecurityPolicies"`
+	Namespaces          []PSPNamespace `json:"namespaces,omitempty"`
+}
+
+// PSPFinding is a PodSecurityPolicy, with the bindings granting its use
+type PSPFinding struct {
+	Name string `json:"name"`
+	// Level is the least strict level of the Pod Security Standards allowing
+	// all the pods the policy allows
+	Level    PodSecurityLevel `json:"level"`
+	Bindings []PSPBinding     `json:"bindings,omitempty"`
+	// Namespaces of the pods admitted by the policy
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// PSPBinding is a binding granting the use of PodSecurityPolicies
+type PSPBinding struct {
+	// Kind is RoleBinding or ClusterRoleBinding
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Role is the kind and the name of the role granting the use
+	Role     string   `json:"role"`
+	Subjects []string `json:"subjects"`
+}
+
+// PSPNamespace is a namespace depending on PodSecurityPolicies, with the Pod
+// Security Admission level suggested to replace them
+type PSPNamespace struct {
+	Name string `json:"name"`
+	// PodSecurityPolicies admitting the pods of the namespace
+	PodSecurityPolicies []string `json:"podSecurityPolicies,omitempty"`
+	// Granted are the PodSecurityPolicies the bindings grant to the
+	// namespace
+	Granted   []string      `json:"granted,omitempty"`
+	Workloads []PSPWorkload `json:"workloads,omitempty"`
+	// Level is the least strict level of the policies admitting the pods,
+	// or of the granted ones when no pod was admitted by a policy
+	Level PodSecurityLevel `json:"level"`
+	// Labels are the Pod Security Admission labels to set on the namespace
+	Labels map[string]string `json:"labels"`
+}
+
+// PSPWorkload is a workload whose pods were admitted by a PodSecurityPolicy
+type PSPWorkload struct {
+	// Description reads like "operator foo:v1.2.3 in ns bar"
+	Description       string `json:"description"`
+	PodSecurityPolicy string `json:"podSecurityPolicy"`
+}
+
+// grant is the use of PodSecurityPolicies granted by a binding. Empty names
+// grant all of them.
+type grant struct {
+	binding PSPBinding
+	names   []string
+	// namespace restricts a RoleBinding to the pods of its namespace
+	namespace string
+	subjects  []rbacv1.Subject
+}
+
+// PSPChecks writes the report of the PodSecurityPolicies, of the bindings
+// granting their use and of the namespaces depending on them. The report is
+// removed once PodSecurityPolicy isn't served anymore. The cluster is read
+// with reader.
+func PSPChecks(ctx context.Context, c client.Client, reader client.Reader, namespace string) error {
+	psps := &policyv1beta1.PodSecurityPolicyList{}
+	if err := reader.List(ctx, psps); err != nil {
+		if meta.IsNoMatchError(err) {
+			return writeReport(ctx, c, namespace, PSPReportName, PSPReportKey, nil, true)
+		}
+		return err
+	}
+	if len(psps.Items) == 0 {
+		return writeReport(ctx, c, namespace, PSPReportName, PSPReportKey, nil, true)
+	}
+
+	grants, err := pspGrants(ctx, reader)
+	if err != nil {
+		return err
+	}
+	levels := make(map[string]PodSecurityLevel)
+	report := PSPReport{}
+	for _, psp := range psps.Items {
+		levels[psp.Name] = levelOf(&psp)
+		finding := PSPFinding{Name: psp.Name, Level: levels[psp.Name]}
+		for _, g := range grants {
+			if len(g.names) == 0 || contains(g.names, psp.Name) {
+				finding.Bindings = append(finding.Bindings, g.binding)
+			}
+		}
+		report.PodSecurityPolicies = append(report.PodSecurityPolicies, finding)
+	}
+
+	// pods of each namespace, by the policy which admitted them
+	admitted, err := admittedPods(ctx, reader)
+	if err != nil {
+		return err
+	}
+	namespaces := make(map[string]bool)
+	for ns := range admitted {
+		namespaces[ns] = true
+	}
+	for _, g := range grants {
+		for _, ns := range grantedNamespaces(g) {
+			namespaces[ns] = true
+		}
+	}
+
+	for ns := range namespaces {
+		entry := PSPNamespace{Name: ns}
+		for name, pods := range admitted[ns] {
+			entry.PodSecurityPolicies = append(entry.PodSecurityPolicies, name)
+			workloads, err := workload.ForPods(ctx, reader, ns, pods)
+			if err != nil {
+				return err
+			}
+			for _, w := range workloads {
+				entry.Workloads = append(entry.Workloads, PSPWorkload{Description: w.String(), PodSecurityPolicy: name})
+			}
+		}
+		entry.Granted = grantedTo(grants, psps.Items, ns)
+
+		policies := entry.PodSecurityPolicies
+		if len(policies) == 0 {
+			policies = entry.Granted
+		}
+		entry.Level = RestrictedLevel
+		for _, name := range policies {
+			if level, found := levels[name]; found && levelStrictness[level] < levelStrictness[entry.Level] {
+				entry.Level = level
+			}
+		}
+		entry.Labels = map[string]string{enforceLabel: string(entry.Level)}
+
+		sort.Strings(entry.PodSecurityPolicies)
+		sort.Slice(entry.Workloads, func(i, j int) bool {
+			return entry.Workloads[i].Description < entry.Workloads[j].Description
+		})
+		report.Namespaces = append(report.Namespaces, entry)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Name < report.Namespaces[j].Name
+	})
+	for i := range report.PodSecurityPolicies {
+		finding := &report.PodSecurityPolicies[i]
+		for _, entry := range report.Namespaces {
+			if contains(entry.PodSecurityPolicies, finding.Name) {
+				finding.Namespaces = append(finding.Namespaces, entry.Name)
+			}
+		}
+	}
+
+	klog.Infof("%d PodSecurityPolicies are used by %d namespaces", len(report.PodSecurityPolicies), len(report.Namespaces))
+	return writeReport(ctx, c, namespace, PSPReportName, PSPReportKey, report, false)
+}
+
+// pspGrants returns the bindings of the roles granting the use of
+// PodSecurityPolicies
+func pspGrants(ctx context.Context, reader client.Reader) ([]grant, error) {
+	clusterRoles := &rbacv1.ClusterRoleList{}
+	if err := reader.List(ctx, clusterRoles); err != nil {
+		return nil, err
+	}
+	granting := make(map[string][]string)
+	for _, role := range clusterRoles.Items {
+		if names, uses := usesPSP(role.Rules); uses {
+			granting["ClusterRole/"+role.Name] = names
+		}
+	}
+	roles := &rbacv1.RoleList{}
+	if err := reader.List(ctx, roles); err != nil {
+		return nil, err
+	}
+	for _, role := range roles.Items {
+		if names, uses := usesPSP(role.Rules); uses {
+			granting[role.Namespace+"/Role/"+role.Name] = names
+		}
+	}
+
+	var grants []grant
+	clusterBindings := &rbacv1.ClusterRoleBindingList{}
+	if err := reader.List(ctx, clusterBindings); err != nil {
+		return nil, err
+	}
+	for _, binding := range clusterBindings.Items {
+		role := binding.RoleRef.Kind + "/" + binding.RoleRef.Name
+		names, found := granting[role]
+		if !found {
+			continue
+		}
+		grants = append(grants, grant{
+			binding:  PSPBinding{Kind: "ClusterRoleBinding", Name: binding.Name, Role: role, Subjects: subjectNames(binding.Subjects)},
+			names:    names,
+			subjects: binding.Subjects,
+		})
+	}
+	bindings := &rbacv1.RoleBindingList{}
+	if err := reader.List(ctx, bindings); err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings.Items {
+		role := binding.RoleRef.Kind + "/" + binding.RoleRef.Name
+		key := role
+		if binding.RoleRef.Kind == "Role" {
+			key = binding.Namespace + "/" + role
+		}
+		names, found := granting[key]
+		if !found {
+			continue
+		}
+		grants = append(grants, grant{
+			binding:   PSPBinding{Kind: "RoleBinding", Name: binding.Name, Namespace: binding.Namespace, Role: role, Subjects: subjectNames(binding.Subjects)},
+			names:     names,
+			namespace: binding.Namespace,
+			subjects:  binding.Subjects,
+		})
+	}
+	return grants, nil
+}
+
+// usesPSP tells if the rules grant the use of PodSecurityPolicies, and
+// returns their names, empty for all of them
+func usesPSP(rules []rbacv1.PolicyRule) ([]string, bool) {
+	var names []string
+	uses := false
+	for _, rule := range rules {
+		if !(contains(rule.APIGroups, "policy") || contains(rule.APIGroups, "extensions") || contains(rule.APIGroups, "*")) ||
+			!(contains(rule.Resources, "podsecuritypolicies") || contains(rule.Resources, "*")) ||
+			!(contains(rule.Verbs, "use") || contains(rule.Verbs, "*")) {
+			continue
+		}
+		if len(rule.ResourceNames) == 0 {
+			return nil, true
+		}
+		uses = true
+		names = append(names, rule.ResourceNames...)
+	}
+	return names, uses
+}
+
+// grantedNamespaces returns the namespaces a binding grants policies to: the
+// namespace of a RoleBinding, or the namespaces of its service account
+// subjects
+func grantedNamespaces(g grant) []string {
+	if g.namespace != "" {
+		return []string{g.namespace}
+	}
+	var namespaces []string
+	for _, subject := range g.subjects {
+		switch {
+		case subject.Kind == rbacv1.ServiceAccountKind:
+			namespaces = append(namespaces, subject.Namespace)
+		case subject.Kind == rbacv1.GroupKind && strings.HasPrefix(subject.Name, "system:serviceaccounts:"):
+			namespaces = append(namespaces, strings.TrimPrefix(subject.Name, "system:serviceaccounts:"))
+		}
+	}
+	return namespaces
+}
+
+// grantedTo returns the policies the bindings grant to the service accounts
+// of a namespace
+func grantedTo(grants []grant, psps []policyv1beta1.PodSecurityPolicy, namespace string) []string {
+	granted := make(map[string]bool)
+	for _, g := range grants {
+		if g.namespace != "" && g.namespace != namespace {
+			continue
+		}
+		if !grantsNamespace(g.subjects, namespace) {
+			continue
+		}
+		if len(g.names) == 0 {
+			for _, psp := range psps {
+				granted[psp.Name] = true
+			}
+			continue
+		}
+		for _, name := range g.names {
+			granted[name] = true
+		}
+	}
+	var names []string
+	for name := range granted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// grantsNamespace tells if the subjects include the service accounts of a
+// namespace
+func grantsNamespace(subjects []rbacv1.Subject, namespace string) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			if subject.Namespace == namespace {
+				return true
+			}
+		case rbacv1.GroupKind:
+			switch subject.Name {
+			case "system:serviceaccounts", "system:authenticated", "system:serviceaccounts:" + namespace:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subjectNames describes the subjects of a binding
+func subjectNames(subjects []rbacv1.Subject) []string {
+	var names []string
+	for _, subject := range subjects {
+		name := subject.Name
+		if subject.Kind == rbacv1.ServiceAccountKind {
+			name = subject.Namespace + "/" + subject.Name
+		}
+		names = append(names, subject.Kind+" "+name)
+	}
+	return names
+}
+
+// admittedPods returns the pods admitted by a PodSecurityPolicy, by
+// namespace and by policy
+func admittedPods(ctx context.Context, reader client.Reader) (map[string]map[string][]*corev1.Pod, error) {
+	admitted := make(map[string]map[string][]*corev1.Pod)
+	continueToken := ""
+	for {
+		pods := &corev1.PodList{}
+		if err := reader.List(ctx, pods, client.Limit(podPageSize), client.Continue(continueToken)); err != nil {
+			return nil, err
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			name := pod.Annotations[pspAnnotation]
+			if name == "" {
+				continue
+			}
+			if admitted[pod.Namespace] == nil {
+				admitted[pod.Namespace] = make(map[string][]*corev1.Pod)
+			}
+			admitted[pod.Namespace][name] = append(admitted[pod.Namespace][name], pod)
+		}
+		continueToken = pods.Continue
+		if continueToken == "" {
+			return admitted, nil
+		}
+	}
+}
+
+// baselineCapabilities are the capabilities the baseline level allows to add
+var baselineCapabilities = []string{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD", "NET_BIND_SERVICE",
+	"SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// restrictedVolumes are the volume types the restricted level allows
+var restrictedVolumes = []policyv1beta1.FSType{
+	policyv1beta1.ConfigMap, policyv1beta1.CSI, policyv1beta1.DownwardAPI, policyv1beta1.EmptyDir,
+	policyv1beta1.Ephemeral, policyv1beta1.PersistentVolumeClaim, policyv1beta1.Projected, policyv1beta1.Secret,
+}
+
+// levelOf returns the least strict level of the Pod Security Standards
+// allowing all the pods a PodSecurityPolicy allows
+func levelOf(psp *policyv1beta1.PodSecurityPolicy) PodSecurityLevel {
+	spec := psp.Spec
+	if spec.Privileged || spec.HostPID || spec.HostIPC || spec.HostNetwork || len(spec.HostPorts) != 0 ||
+		len(spec.AllowedUnsafeSysctls) != 0 {
+		return PrivilegedLevel
+	}
+	for _, volume := range spec.Volumes {
+		if volume == policyv1beta1.HostPath || volume == policyv1beta1.All {
+			return PrivilegedLevel
+		}
+	}
+	for _, capability := range append(spec.AllowedCapabilities, spec.DefaultAddCapabilities...) {
+		if !contains(baselineCapabilities, string(capability)) {
+			return PrivilegedLevel
+		}
+	}
+	for _, procMount := range spec.AllowedProcMountTypes {
+		if procMount == corev1.UnmaskedProcMount {
+			return PrivilegedLevel
+		}
+	}
+	// The baseline level forbids the unconfined seccomp and AppArmor profiles
+	if allowsProfile(psp.Annotations[seccompProfilesAnnotation], "*", "unconfined") {
+		return PrivilegedLevel
+	}
+	if appArmorProfiles, found := psp.Annotations[appArmorProfilesAnnotation]; !found ||
+		allowsProfile(appArmorProfiles, "*", "unconfined") {
+		return PrivilegedLevel
+	}
+
+	if spec.AllowPrivilegeEscalation == nil || *spec.AllowPrivilegeEscalation {
+		return BaselineLevel
+	}
+	if !runsAsNonRoot(spec.RunAsUser) {
+		return BaselineLevel
+	}
+	for _, volume := range spec.Volumes {
+		if !containsVolume(restrictedVolumes, volume) {
+			return BaselineLevel
+		}
+	}
+	dropsAll := false
+	for _, capability := range spec.RequiredDropCapabilities {
+		dropsAll = dropsAll || capability == "ALL"
+	}
+	if !dropsAll {
+		return BaselineLevel
+	}
+	for _, capability := range append(spec.AllowedCapabilities, spec.DefaultAddCapabilities...) {
+		if capability != "NET_BIND_SERVICE" {
+			return BaselineLevel
+		}
+	}
+	// Without allowed profiles the pods can't set a seccomp profile, and the
+	// restricted level requires one
+	if psp.Annotations[seccompProfilesAnnotation] == "" {
+		return BaselineLevel
+	}
+	return RestrictedLevel
+}
+
+// allowsProfile tells if the comma separated profiles of a PodSecurityPolicy
+// annotation include one of profiles
+func allowsProfile(annotation string, profiles ...string) bool {
+	if annotation == "" {
+		return false
+	}
+	for _, profile := range strings.Split(annotation, ",") {
+		if contains(profiles, strings.TrimSpace(profile)) {
+			return true
+		}
+	}
+	return false
+}
+
+// runsAsNonRoot tells if the strategy forbids running as root
+func runsAsNonRoot(strategy policyv1beta1.RunAsUserStrategyOptions) bool {
+	switch strategy.Rule {
+	case policyv1beta1.RunAsUserStrategyMustRunAsNonRoot:
+		return true
+	case policyv1beta1.RunAsUserStrategyMustRunAs:
+		if len(strategy.Ranges) == 0 {
+			return false
+		}
+		for _, r := range strategy.Ranges {
+			if r.Min == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func containsVolume(volumes []policyv1beta1.FSType, volume policyv1beta1.FSType) bool {
+	for _, v := range volumes {
+		if v == volume {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package checker
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func restrictedPSP() *policyv1beta1.PodSecurityPolicy {
+	allowPrivilegeEscalation := false
+	return &policyv1beta1.PodSecurityPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "restricted",
+			Annotations: map[string]string{
+				seccompProfilesAnnotation:  "runtime/default",
+				appArmorProfilesAnnotation: "runtime/default",
+			},
+		},
+		Spec: policyv1beta1.PodSecurityPolicySpec{
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			RequiredDropCapabilities: []corev1.Capability{"ALL"},
+			RunAsUser:                policyv1beta1.RunAsUserStrategyOptions{Rule: policyv1beta1.RunAsUserStrategyMustRunAsNonRoot},
+			Volumes:                  []policyv1beta1.FSType{policyv1beta1.ConfigMap, policyv1beta1.Secret, policyv1beta1.EmptyDir},
+		},
+	}
+}
+
+func TestLevelOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(psp *policyv1beta1.PodSecurityPolicy)
+		level  PodSecurityLevel
+	}{
+		{"restricted", func(*policyv1beta1.PodSecurityPolicy) {}, RestrictedLevel},
+		{"privileged", func(psp *policyv1beta1.PodSecurityPolicy) { psp.Spec.Privileged = true }, PrivilegedLevel},
+		{"host network", func(psp *policyv1beta1.PodSecurityPolicy) { psp.Spec.HostNetwork = true }, PrivilegedLevel},
+		{"host path", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.Volumes = append(psp.Spec.Volumes, policyv1beta1.HostPath)
+		}, PrivilegedLevel},
+		{"all volumes", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.Volumes = []policyv1beta1.FSType{policyv1beta1.All}
+		}, PrivilegedLevel},
+		{"SYS_ADMIN", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.AllowedCapabilities = []corev1.Capability{"SYS_ADMIN"}
+		}, PrivilegedLevel},
+		{"unmasked proc mount", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.AllowedProcMountTypes = []corev1.ProcMountType{corev1.UnmaskedProcMount}
+		}, PrivilegedLevel},
+		{"privilege escalation", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.AllowPrivilegeEscalation = nil
+		}, BaselineLevel},
+		{"run as any user", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.RunAsUser = policyv1beta1.RunAsUserStrategyOptions{Rule: policyv1beta1.RunAsUserStrategyRunAsAny}
+		}, BaselineLevel},
+		{"run as root in range", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.RunAsUser = policyv1beta1.RunAsUserStrategyOptions{
+				Rule:   policyv1beta1.RunAsUserStrategyMustRunAs,
+				Ranges: []policyv1beta1.IDRange{{Min: 0, Max: 65535}},
+			}
+		}, BaselineLevel},
+		{"run as non root range", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.RunAsUser = policyv1beta1.RunAsUserStrategyOptions{
+				Rule:   policyv1beta1.RunAsUserStrategyMustRunAs,
+				Ranges: []policyv1beta1.IDRange{{Min: 1000, Max: 65535}},
+			}
+		}, RestrictedLevel},
+		{"nfs volume", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.Volumes = append(psp.Spec.Volumes, policyv1beta1.NFS)
+		}, BaselineLevel},
+		{"capabilities kept", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.RequiredDropCapabilities = nil
+		}, BaselineLevel},
+		{"baseline capability", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.AllowedCapabilities = []corev1.Capability{"CHOWN"}
+		}, BaselineLevel},
+		{"NET_BIND_SERVICE", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Spec.AllowedCapabilities = []corev1.Capability{"NET_BIND_SERVICE"}
+		}, RestrictedLevel},
+		{"no seccomp profile", func(psp *policyv1beta1.PodSecurityPolicy) {
+			delete(psp.Annotations, seccompProfilesAnnotation)
+		}, BaselineLevel},
+		{"unconfined seccomp profile", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Annotations[seccompProfilesAnnotation] = "runtime/default, unconfined"
+		}, PrivilegedLevel},
+		{"any seccomp profile", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Annotations[seccompProfilesAnnotation] = "*"
+		}, PrivilegedLevel},
+		{"unconfined AppArmor profile", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Annotations[appArmorProfilesAnnotation] = "runtime/default,unconfined"
+		}, PrivilegedLevel},
+		{"any AppArmor profile", func(psp *policyv1beta1.PodSecurityPolicy) {
+			delete(psp.Annotations, appArmorProfilesAnnotation)
+		}, PrivilegedLevel},
+		{"localhost AppArmor profile", func(psp *policyv1beta1.PodSecurityPolicy) {
+			psp.Annotations[appArmorProfilesAnnotation] = "runtime/default,localhost/k8s-nginx"
+		}, RestrictedLevel},
+	}
+	for _, test := range tests {
+		psp := restrictedPSP()
+		test.modify(psp)
+		if level := levelOf(psp); level != test.level {
+			t.Errorf("%s: level %s, expected %s", test.name, level, test.level)
+		}
+	}
+}
+
+func TestUsesPSP(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []rbacv1.PolicyRule
+		names []string
+		uses  bool
+	}{
+		{"no rules", nil, nil, false},
+		{"other resource", []rbacv1.PolicyRule{
+			{APIGroups: []string{"policy"}, Resources: []string{"poddisruptionbudgets"}, Verbs: []string{"use"}},
+		}, nil, false},
+		{"other verb", []rbacv1.PolicyRule{
+			{APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies"}, Verbs: []string{"get", "list"}},
+		}, nil, false},
+		{"other group", []rbacv1.PolicyRule{
+			{APIGroups: []string{"apps"}, Resources: []string{"podsecuritypolicies"}, Verbs: []string{"use"}},
+		}, nil, false},
+		{"named", []rbacv1.PolicyRule{
+			{APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies"}, Verbs: []string{"use"}, ResourceNames: []string{"restricted"}},
+			{APIGroups: []string{"extensions"}, Resources: []string{"podsecuritypolicies"}, Verbs: []string{"use"}, ResourceNames: []string{"baseline"}},
+		}, []string{"restricted", "baseline"}, true},
+		{"all policies", []rbacv1.PolicyRule{
+			{APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies"}, Verbs: []string{"use"}, ResourceNames: []string{"restricted"}},
+			{APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies"}, Verbs: []string{"use"}},
+		}, nil, true},
+		{"wildcards", []rbacv1.PolicyRule{
+			{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+		}, nil, true},
+	}
+	for _, test := range tests {
+		names, uses := usesPSP(test.rules)
+		if uses != test.uses || !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: returned %v %v, expected %v %v", test.name, names, uses, test.names, test.uses)
+		}
+	}
+}
+
+func TestGrantedTo(t *testing.T) {
+	psps := []policyv1beta1.PodSecurityPolicy{
+		{ObjectMeta: metav1.ObjectMeta{Name: "baseline"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "privileged"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "restricted"}},
+	}
+	grants := []grant{
+		// ClusterRoleBinding to all the authenticated users
+		{names: []string{"restricted"}, subjects: []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:authenticated"}}},
+		// ClusterRoleBinding to a service account, granting all the policies
+		{subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Namespace: "kube-system", Name: "admin"}}},
+		// RoleBinding only granting in its namespace
+		{names: []string{"baseline"}, namespace: "shop", subjects: []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts"}}},
+		// RoleBinding of another namespace to the service accounts of shop
+		{names: []string{"privileged"}, namespace: "other", subjects: []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:shop"}}},
+		// users aren't service accounts
+		{names: []string{"privileged"}, subjects: []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}}},
+	}
+	tests := []struct {
+		namespace string
+		granted   []string
+	}{
+		{"kube-system", []string{"baseline", "privileged", "restricted"}},
+		{"shop", []string{"baseline", "restricted"}},
+		{"other", []string{"restricted"}},
+	}
+	for _, test := range tests {
+		if granted := grantedTo(grants, psps, test.namespace); !reflect.DeepEqual(granted, test.granted) {
+			t.Errorf("%s is granted %v, expected %v", test.namespace, granted, test.granted)
+		}
+	}
+}
+
+func TestGrantedNamespaces(t *testing.T) {
+	g := grant{subjects: []rbacv1.Subject{
+		{Kind: rbacv1.ServiceAccountKind, Namespace: "shop", Name: "default"},
+		{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:billing"},
+		{Kind: rbacv1.UserKind, Name: "alice"},
+	}}
+	if namespaces := grantedNamespaces(g); !reflect.DeepEqual(namespaces, []string{"shop", "billing"}) {
+		t.Errorf("unexpected namespaces %v", namespaces)
+	}
+	g.namespace = "shop"
+	if namespaces := grantedNamespaces(g); !reflect.DeepEqual(namespaces, []string{"shop"}) {
+		t.Errorf("unexpected namespaces %v", namespaces)
+	}
+}
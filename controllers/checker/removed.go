@@ -0,0 +1,29 @@
+package checker
+
+import (
+	"context"
+
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+const (
+	// RemovedReportName is the name of the config map holding the entries of
+	// the catalog the cluster doesn't serve anymore
+	RemovedReportName = "deprecated-api-removed-report"
+	// RemovedReportKey is the key of the report in the config map
+	RemovedReportKey = "deprecated-api-removed-report.yaml"
+)
+
+// RemovedChecks writes the report of the entries of the catalog already
+// removed from the cluster. The manifests still using them are broken, and
+// the webhook has no rule for them.
+func RemovedChecks(ctx context.Context, c client.Client, namespace string, removed []operatorv1alpha1.DeprecatedAPI) error {
+	for _, api := range removed {
+		klog.Infof("%s is not served by the cluster anymore", catalog.Key(api))
+	}
+	return writeReport(ctx, c, namespace, RemovedReportName, RemovedReportKey, removed, len(removed) == 0)
+}
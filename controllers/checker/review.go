@@ -0,0 +1,146 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/horis233/k8s-deprecation-checker/controllers/workload"
+)
+
+const (
+	// ReviewReportName is the name of the config map holding the report of
+	// the webhooks only accepting v1beta1 reviews
+	ReviewReportName = "deprecated-api-review-report"
+	// ReviewReportKey is the key of the report in the config map
+	ReviewReportKey = "deprecated-api-review-report.yaml"
+)
+
+// ReviewFinding is a webhook which doesn't accept the v1 AdmissionReview or
+// ConversionReview, it breaks once the apiserver stops sending v1beta1
+type ReviewFinding struct {
+	// Kind and Name of the webhook configuration or of the custom resource
+	// definition
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Webhook is the name of the webhook in the configuration
+	Webhook string `json:"webhook,omitempty"`
+	// ReviewVersions are the review versions accepted by the webhook
+	ReviewVersions []string `json:"reviewVersions"`
+	// Service or URL called by the apiserver
+	Service string `json:"service,omitempty"`
+	URL     string `json:"url,omitempty"`
+	// Owners are the components serving the webhook
+	Owners []string `json:"owners,omitempty"`
+}
+
+// ReviewVersionChecks writes the report of the webhooks of the webhook
+// configurations and of the conversion webhooks of the custom resource
+// definitions which only accept v1beta1 reviews. The components serving them
+// are read with reader.
+func ReviewVersionChecks(ctx context.Context, c client.Client, reader client.Reader, namespace string) error {
+	var findings []ReviewFinding
+
+	mutating := &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	if err := c.List(ctx, mutating); err != nil {
+		return err
+	}
+	for _, configuration := range mutating.Items {
+		for _, webhook := range configuration.Webhooks {
+			if acceptsV1(webhook.AdmissionReviewVersions) {
+				continue
+			}
+			findings = append(findings, newReviewFinding(ctx, reader, "MutatingWebhookConfiguration", configuration.Name,
+				webhook.Name, webhook.AdmissionReviewVersions, webhook.ClientConfig.Service, webhook.ClientConfig.URL))
+		}
+	}
+
+	validating := &admissionregistrationv1.ValidatingWebhookConfigurationList{}
+	if err := c.List(ctx, validating); err != nil {
+		return err
+	}
+	for _, configuration := range validating.Items {
+		for _, webhook := range configuration.Webhooks {
+			if acceptsV1(webhook.AdmissionReviewVersions) {
+				continue
+			}
+			findings = append(findings, newReviewFinding(ctx, reader, "ValidatingWebhookConfiguration", configuration.Name,
+				webhook.Name, webhook.AdmissionReviewVersions, webhook.ClientConfig.Service, webhook.ClientConfig.URL))
+		}
+	}
+
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := c.List(ctx, crds); err != nil {
+		return err
+	}
+	for _, crd := range crds.Items {
+		conversion := crd.Spec.Conversion
+		if conversion == nil || conversion.Strategy != apiextensionsv1.WebhookConverter || conversion.Webhook == nil ||
+			acceptsV1(conversion.Webhook.ConversionReviewVersions) {
+			continue
+		}
+		var service *admissionregistrationv1.ServiceReference
+		var url *string
+		if clientConfig := conversion.Webhook.ClientConfig; clientConfig != nil {
+			url = clientConfig.URL
+			if clientConfig.Service != nil {
+				service = &admissionregistrationv1.ServiceReference{
+					Namespace: clientConfig.Service.Namespace,
+					Name:      clientConfig.Service.Name,
+				}
+			}
+		}
+		findings = append(findings, newReviewFinding(ctx, reader, "CustomResourceDefinition", crd.Name,
+			"", conversion.Webhook.ConversionReviewVersions, service, url))
+	}
+
+	return writeReport(ctx, c, namespace, ReviewReportName, ReviewReportKey, findings, len(findings) == 0)
+}
+
+// newReviewFinding describes a webhook, with the workloads behind its service
+func newReviewFinding(ctx context.Context, reader client.Reader, kind, name, webhook string, versions []string, service *admissionregistrationv1.ServiceReference, url *string) ReviewFinding {
+	klog.Infof("%s %s only accepts %v reviews", kind, name, versions)
+	finding := ReviewFinding{
+		Kind:           kind,
+		Name:           name,
+		Webhook:        webhook,
+		ReviewVersions: versions,
+	}
+	if url != nil {
+		finding.URL = *url
+		finding.Owners = []string{"external server " + *url}
+	}
+	if service == nil {
+		return finding
+	}
+
+	finding.Service = service.Namespace + "/" + service.Name
+	workloads, err := workload.ForService(ctx, reader, service.Namespace, service.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf("Can't find the workloads of service %s: %v", finding.Service, err)
+		}
+		finding.Owners = []string{fmt.Sprintf("service %s", finding.Service)}
+		return finding
+	}
+	for _, w := range workloads {
+		finding.Owners = append(finding.Owners, w.String())
+	}
+	return finding
+}
+
+// acceptsV1 tells if v1 is in the review versions, the apiserver then sends
+// v1 reviews once it stops sending v1beta1 ones
+func acceptsV1(versions []string) bool {
+	for _, v := range versions {
+		if v == "v1" {
+			return true
+		}
+	}
+	return false
+}
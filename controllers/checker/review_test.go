@@ -0,0 +1,123 @@
+package checker
+
+import (
+	"context"
+	"testing"
+
+	utilyaml "github.com/ghodss/yaml"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReviewVersionChecks(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := admissionregistrationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	url := "https://hooks.example.com/mutate"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "policies"},
+			Webhooks: []admissionregistrationv1.ValidatingWebhook{
+				{
+					Name:                    "old.policies.example.com",
+					AdmissionReviewVersions: []string{"v1beta1"},
+					ClientConfig:            admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Namespace: "policies", Name: "webhook"}},
+				},
+				{
+					Name:                    "new.policies.example.com",
+					AdmissionReviewVersions: []string{"v1", "v1beta1"},
+					ClientConfig:            admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Namespace: "policies", Name: "webhook"}},
+				},
+			},
+		},
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaults"},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{{
+				Name:                    "defaults.example.com",
+				AdmissionReviewVersions: []string{"v1beta1"},
+				ClientConfig:            admissionregistrationv1.WebhookClientConfig{URL: &url},
+			}},
+		},
+		&apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com"},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Group: "example.com",
+				Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Kind: "Widget"},
+				Conversion: &apiextensionsv1.CustomResourceConversion{
+					Strategy: apiextensionsv1.WebhookConverter,
+					Webhook: &apiextensionsv1.WebhookConversion{
+						ConversionReviewVersions: []string{"v1beta1"},
+						ClientConfig:             &apiextensionsv1.WebhookClientConfig{Service: &apiextensionsv1.ServiceReference{Namespace: "widgets", Name: "converter"}},
+					},
+				},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "policies", Name: "webhook"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "policies"}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "policies", Name: "policies", Labels: map[string]string{"app": "policies"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "webhook", Image: "policies:v1"}}},
+		},
+	).Build()
+	ctx := context.Background()
+
+	if err := ReviewVersionChecks(ctx, c, c, "depremon"); err != nil {
+		t.Fatal(err)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "depremon", Name: ReviewReportName}, cm); err != nil {
+		t.Fatal(err)
+	}
+	var findings []ReviewFinding
+	if err := utilyaml.Unmarshal([]byte(cm.Data[ReviewReportKey]), &findings); err != nil {
+		t.Fatal(err)
+	}
+	expected := []ReviewFinding{
+		{Kind: "MutatingWebhookConfiguration", Name: "defaults", Webhook: "defaults.example.com", URL: url, Owners: []string{"external server " + url}},
+		{Kind: "ValidatingWebhookConfiguration", Name: "policies", Webhook: "old.policies.example.com", Service: "policies/webhook", Owners: []string{"pod policies (policies:v1) in ns policies"}},
+		// the service of the conversion webhook doesn't exist
+		{Kind: "CustomResourceDefinition", Name: "widgets.example.com", Service: "widgets/converter", Owners: []string{"service widgets/converter"}},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+	for i, finding := range findings {
+		e := expected[i]
+		if finding.Kind != e.Kind || finding.Name != e.Name || finding.Webhook != e.Webhook || finding.Service != e.Service || finding.URL != e.URL ||
+			len(finding.Owners) != 1 || finding.Owners[0] != e.Owners[0] {
+			t.Errorf("unexpected finding %+v, expected %+v", finding, e)
+		}
+	}
+
+	// the report is deleted once the webhooks accept v1
+	if err := c.DeleteAllOf(ctx, &admissionregistrationv1.MutatingWebhookConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteAllOf(ctx, &admissionregistrationv1.ValidatingWebhookConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteAllOf(ctx, &apiextensionsv1.CustomResourceDefinition{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReviewVersionChecks(ctx, c, c, "depremon"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "depremon", Name: ReviewReportName}, cm); !errors.IsNotFound(err) {
+		t.Errorf("report not deleted: %v", err)
+	}
+}
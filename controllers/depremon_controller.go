@@ -18,44 +18,140 @@ package controllers
 
 import (
 	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	crhandler "sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+	"github.com/horis233/k8s-deprecation-checker/controllers/checker"
 	"github.com/horis233/k8s-deprecation-checker/controllers/handler"
+	"github.com/horis233/k8s-deprecation-checker/controllers/migration"
+	"github.com/horis233/k8s-deprecation-checker/controllers/notifier"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+	"github.com/horis233/k8s-deprecation-checker/controllers/probe"
+	"github.com/horis233/k8s-deprecation-checker/controllers/readiness"
 	"github.com/horis233/k8s-deprecation-checker/controllers/utils"
 	"github.com/horis233/k8s-deprecation-checker/controllers/webhooks"
 )
 
+const (
+	// cleanupFinalizer makes sure the webhook configurations, which can't be
+	// owned by a namespaced Depremon, are removed with it
+	cleanupFinalizer = "operator.horis233.com/cleanup"
+
+	// recordWebhookName is the name of the webhook configuration recording
+	// the deprecated APIs
+	recordWebhookName = "deprcated-api-record"
+
+	// tenantRulesWebhookName is the name of the webhook configuration
+	// recording the requests matching the rules of the Depremon objects
+	// outside of the operator namespace
+	tenantRulesWebhookName = "deprecated-api-tenant-rules"
+
+	// namespaceNameLabel is set by the apiserver on every namespace to its
+	// name, since Kubernetes 1.21
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+
+	// depremonWebhookName is the name of the webhook configurations
+	// defaulting and validating Depremon objects
+	depremonWebhookName = "depremon-webhook"
+
+	// depremonCRDName is the name of the CRD converted by the webhook server
+	depremonCRDName = "depremons.operator.horis233.com"
+)
+
 // DepremonReconciler reconciles a Depremon object
 type DepremonReconciler struct {
 	client.Client
-	Scheme  *runtime.Scheme
-	Manager *manager.Manager
+	Scheme   *runtime.Scheme
+	Config   *rest.Config
+	Recorder record.EventRecorder
+	Notifier *notifier.Notifier
+	// Reader reads the objects of the whole cluster to evaluate the upgrade
+	// readiness
+	Reader client.Reader
+	// Migrator migrates the custom resources stored in old versions
+	Migrator *migration.Migrator
+	// Discovery tells which versions of the catalog are served, it is
+	// invalidated on each scan
+	Discovery discovery.CachedDiscoveryInterface
+	// Prober probes the APIs the apiserver warns about, in the Build mode
+	// they are added to the catalog
+	Prober *probe.Prober
+	// Policy is the policy of the cluster shared with the webhook, it is
+	// rebuilt on each reconciliation
+	Policy *policy.Shared
+	// Depremons caches the Depremon objects of all the namespaces, the
+	// webhook narrows the policy with them
+	Depremons cache.Cache
 }
 
 //+kubebuilder:rbac:groups=operator.horis233.com,resources=depremons,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=operator.horis233.com,resources=depremons/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=operator.horis233.com,resources=depremons/finalizers,verbs=update
+//+kubebuilder:rbac:groups=operator.horis233.com,resources=clusterdepremons,verbs=get;list;watch
+//+kubebuilder:rbac:groups=operator.horis233.com,resources=clusterdepremons/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups="",resources=configmaps;services;secrets,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations;validatingwebhookconfigurations,verbs=get;list;watch;create;update;patch
-
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the Depremon object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=serviceaccounts;pods;namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=replicasets;deployments;statefulsets;daemonsets,verbs=get
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list
+//+kubebuilder:rbac:groups=extensions,resources=ingresses,verbs=list
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=list
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=list
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=list
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=list
+//+kubebuilder:rbac:groups=node.k8s.io,resources=runtimeclasses,verbs=list
+//+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=list
+//+kubebuilder:rbac:groups=flowcontrol.apiserver.k8s.io,resources=flowschemas;prioritylevelconfigurations,verbs=list
+//+kubebuilder:rbac:groups=operators.coreos.com,resources=clusterserviceversions,verbs=get
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations;validatingwebhookconfigurations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;ingressclasses,verbs=list
+//+kubebuilder:rbac:groups=apiregistration.k8s.io,resources=apiservices,verbs=list
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=list
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings;clusterroles;clusterrolebindings,verbs=list
+//+kubebuilder:rbac:groups=scheduling.k8s.io,resources=priorityclasses,verbs=list
+//+kubebuilder:rbac:groups=policy,resources=podsecuritypolicies,verbs=list
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=csidrivers;csinodes;storageclasses;volumeattachments,verbs=list
+
+// Reconcile cleans up the webhooks once the last Depremon is deleted, and
+// adds the cleanup finalizer otherwise. It then builds the policy of the
+// cluster shared with the webhook, configures and restores the webhooks for
+// the served APIs of the catalog, and runs the scans when the scan interval
+// has elapsed. The scans of the operator namespace also evaluate the
+// readiness for the target version. The first Depremon of the operator
+// namespace migrates a batch of the custom resources stored in old versions,
+// and is requeued after a delay until they are all migrated.
 func (r *DepremonReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
@@ -64,7 +160,8 @@ func (r *DepremonReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Owned objects are automatically garbage collected, the others are
+			// cleaned up before removing the finalizer.
 			// Return and don't requeue
 			return ctrl.Result{}, nil
 		}
@@ -77,112 +174,562 @@ func (r *DepremonReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	if err := r.setupWebhooks(namespace, instance.Spec.Namespaces); err != nil {
-		klog.Error(err, "Error setting up webhook server")
+	if !instance.GetDeletionTimestamp().IsZero() {
+		if controllerutil.ContainsFinalizer(instance, cleanupFinalizer) {
+			if err := r.cleanup(ctx, instance, namespace); err != nil {
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(instance, cleanupFinalizer)
+			if err := r.Client.Update(ctx, instance); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(instance, cleanupFinalizer) {
+		controllerutil.AddFinalizer(instance, cleanupFinalizer)
+		if err := r.Client.Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	p, err := policy.ForCluster(ctx, r.Client, namespace, r.Prober.Catalog())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	r.Policy.Store(p)
+
+	// Scan the existing resources when the interval has elapsed
+	scanInterval := operatorv1alpha1.DefaultScanInterval
+	if instance.Spec.ScanInterval != nil {
+		scanInterval = instance.Spec.ScanInterval.Duration
+	}
+	lastScanTime := instance.Status.LastScanTime
+	scanned := lastScanTime == nil || time.Since(lastScanTime.Time) >= scanInterval
+
+	// Only the served versions of the catalog get a webhook rule
+	if scanned {
+		r.Discovery.Invalidate()
+	}
+	servedAPIs, err := probe.Discover(r.Discovery)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	served, removed := servedAPIs.Split(p.Catalog)
+
+	clusterRules, tenantRules, err := r.customRules(ctx, namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// The webhook settings are taken from the first Depremon of the operator
+	// namespace, whichever Depremon is reconciled
+	first, err := firstDepremon(ctx, r.Client, namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	webhookSpec := operatorv1alpha1.WebhookSpec{}
+	if first != nil {
+		webhookSpec = first.Spec.Webhook
+	}
+	if err := r.configureWebhooks(served, p.Fields, clusterRules, tenantRules, webhookSpec); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.configureNotifier(ctx, namespace); err != nil {
+		return ctrl.Result{}, err
 	}
 
 	// Reconcile the webhooks
-	if err := webhooks.Config.Reconcile(ctx, r.Client, instance); err != nil {
+	changes, err := webhooks.Config.Reconcile(ctx, r.Client, instance)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Changes on a generation that was already reconciled are made by someone
+	// else, report them on the Depremon
+	if instance.Status.ObservedGeneration == instance.Generation && len(changes) != 0 {
+		klog.Infof("Restored drifted resources %s", strings.Join(changes, ", "))
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, "DriftCorrected",
+			"Restored %s", strings.Join(changes, ", "))
+	}
+
+	if scanned {
+		klog.Info("checking webhook configuration apiversion")
+		if err := checker.WebhookConfigurationChecks(r.Client, r.Config); err != nil {
+			return ctrl.Result{}, err
+		}
+		if instance.Namespace == namespace {
+			klog.Info("checking custom resource definition versions")
+			if err := checker.CRDChecks(ctx, r.Client, r.Reader, namespace); err != nil {
+				return ctrl.Result{}, err
+			}
+			klog.Info("checking webhook review versions")
+			if err := checker.ReviewVersionChecks(ctx, r.Client, r.Reader, namespace); err != nil {
+				return ctrl.Result{}, err
+			}
+			klog.Info("checking pod security policies")
+			if err := checker.PSPChecks(ctx, r.Client, r.Reader, namespace); err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := checker.RemovedChecks(ctx, r.Client, namespace, removed); err != nil {
+				return ctrl.Result{}, err
+			}
+			klog.Info("probing the served APIs")
+			if err := checker.DiscoveryChecks(ctx, r.Client, r.Reader, r.Prober, namespace, instance.Spec.Discovery.Mode); err != nil {
+				return ctrl.Result{}, err
+			}
+			readiness, err := r.evaluateReadiness(ctx, p.Catalog, instance.Spec.TargetVersion, namespace)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			instance.Status.Readiness = readiness
+		}
+		lastScanTime = &metav1.Time{Time: time.Now()}
+	}
+
+	// Migrate a batch of custom resources stored in old versions, the
+	// migrations are run by the first Depremon of the operator namespace
+	migrationChanged, migrating := false, false
+	if instance.Namespace == namespace && instance.Spec.StorageMigration.Enabled && r.Migrator != nil {
+		if first != nil && first.Name == instance.Name {
+			var migrations []operatorv1alpha1.StorageMigrationStatus
+			migrations, migrating, err = r.Migrator.Migrate(ctx, instance.Spec.StorageMigration, instance.Status.StorageMigrations, scanned)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			migrationChanged = !reflect.DeepEqual(migrations, instance.Status.StorageMigrations)
+			instance.Status.StorageMigrations = migrations
+		}
+	}
+
+	if instance.Status.ObservedGeneration != instance.Generation || instance.Status.LastScanTime != lastScanTime || migrationChanged {
+		instance.Status.ObservedGeneration = instance.Generation
+		instance.Status.LastScanTime = lastScanTime
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The next batch is migrated after a fixed delay, a requeue would be rate
+	// limited with an exponential backoff growing with each batch
+	if migrating {
+		return ctrl.Result{RequeueAfter: migration.BatchDelay}, nil
+	}
+	return ctrl.Result{RequeueAfter: scanInterval - time.Since(lastScanTime.Time)}, nil
+}
+
+// firstDepremon returns the first Depremon of the operator namespace by name
+// which isn't being deleted, or nil. Its spec holds the settings shared by the
+// Depremon objects of the operator namespace.
+func firstDepremon(ctx context.Context, reader client.Reader, namespace string) (*operatorv1alpha1.Depremon, error) {
+	list := &operatorv1alpha1.DepremonList{}
+	if err := reader.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var first *operatorv1alpha1.Depremon
+	for i, depremon := range list.Items {
+		if depremon.GetDeletionTimestamp().IsZero() && (first == nil || depremon.Name < first.Name) {
+			first = &list.Items[i]
+		}
+	}
+	return first, nil
+}
+
+// evaluateReadiness evaluates the readiness of the cluster for the target
+// version, keeping the first blocking findings
+func (r *DepremonReconciler) evaluateReadiness(ctx context.Context, apis []operatorv1alpha1.DeprecatedAPI, targetVersion, namespace string) (*operatorv1alpha1.ReadinessStatus, error) {
+	if targetVersion == "" {
+		clusterVersion, err := utils.GetClusterVersion(r.Config)
+		if err != nil {
+			return nil, err
+		}
+		targetVersion = clusterVersion
+	}
+
+	evaluator := &readiness.Evaluator{
+		Reader:    r.Reader,
+		Mapper:    r.Client.RESTMapper(),
+		Namespace: namespace,
+	}
+	status, err := evaluator.Evaluate(ctx, apis, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Cluster is %s for %s with %d blocking findings and %d unreadable sources", status.Verdict, targetVersion,
+		status.BlockingCount, len(status.UnreadableSources))
+	if len(status.BlockingFindings) > readiness.MaxStatusFindings {
+		status.BlockingFindings = status.BlockingFindings[:readiness.MaxStatusFindings]
+	}
+	return status, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DepremonReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&operatorv1alpha1.Depremon{}).
+		// The manager only caches the operator namespace, the rules of the
+		// other namespaces are watched with the cache of all the Depremons
+		Watches(source.NewKindWithCache(&operatorv1alpha1.Depremon{}, r.Depremons),
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}, predicate.NewPredicateFuncs(outsideOperatorNamespace))).
+		Watches(&source.Kind{Type: &operatorv1alpha1.ClusterDepremon{}},
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace)).
+		Watches(&source.Kind{Type: &admissionregistrationv1.ValidatingWebhookConfiguration{}},
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace),
+			builder.WithPredicates(managed)).
+		Watches(&source.Kind{Type: &admissionregistrationv1.MutatingWebhookConfiguration{}},
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace),
+			builder.WithPredicates(managed)).
+		Watches(&source.Kind{Type: &corev1.Service{}},
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace),
+			builder.WithPredicates(managed)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}},
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace),
+			builder.WithPredicates(predicate.Or(managed, predicate.NewPredicateFuncs(r.importedCatalog)))).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace),
+			builder.WithPredicates(managed)).
+		Watches(&source.Kind{Type: &apiextensionsv1.CustomResourceDefinition{}},
+			crhandler.EnqueueRequestsFromMapFunc(r.depremonsInOperatorNamespace),
+			builder.WithPredicates(predicate.Or(managed, deprecatedVersions))).
 		Complete(r)
 }
 
-func (r *DepremonReconciler) setupWebhooks(namespace string, namespaces []string) error {
+// cleanup removes the webhook configurations, the service and the CA config
+// map once the last Depremon of the operator namespace is deleted. The report
+// is removed too if the retention policy asks for it.
+func (r *DepremonReconciler) cleanup(ctx context.Context, instance *operatorv1alpha1.Depremon, namespace string) error {
+	list := &operatorv1alpha1.DepremonList{}
+	if err := r.Client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	for _, item := range list.Items {
+		if item.UID != instance.UID && item.GetDeletionTimestamp().IsZero() {
+			klog.Infof("Depremon %s/%s is still in use, skipping cleanup", item.Namespace, item.Name)
+			return nil
+		}
+	}
+
+	klog.Info("Cleaning up deprcated api checker webhook")
+	if err := webhooks.Config.Cleanup(ctx, r.Client, namespace); err != nil {
+		return err
+	}
 
+	if instance.Spec.ReportRetention == operatorv1alpha1.DeleteReport {
+		klog.Info("Deleting deprecated api report")
+		if err := checker.DeleteReports(ctx, r.Client, namespace); err != nil {
+			return err
+		}
+		return handler.DeleteReport(ctx, r.Client)
+	}
+	return nil
+}
+
+// SetupWebhookServer registers the webhooks into the webhook server of mgr.
+// It must be called once, before starting the manager, the webhooks are then
+// configured on each reconciliation.
+func (r *DepremonReconciler) SetupWebhookServer(mgr manager.Manager, namespace string) error {
 	klog.Info("Creating deprcated api checker webhook configuration")
+	recorder := &handler.Recorder{
+		Client:        r.Client,
+		Reader:        mgr.GetAPIReader(),
+		Policy:        r.Policy,
+		Depremons:     r.Depremons,
+		EventRecorder: r.Recorder,
+		Notifier:      r.Notifier,
+	}
+	tenantRecorder := &handler.Recorder{
+		Client:        r.Client,
+		Reader:        mgr.GetAPIReader(),
+		Policy:        r.Policy,
+		Depremons:     r.Depremons,
+		EventRecorder: r.Recorder,
+		Notifier:      r.Notifier,
+		TenantRules:   true,
+	}
+	// The recorders look up the new findings in the background
+	for _, runnable := range []*handler.Recorder{recorder, tenantRecorder} {
+		if err := mgr.Add(runnable); err != nil {
+			return err
+		}
+	}
 	webhooks.Config.AddWebhook(webhooks.CSWebhook{
-		Name:        "deprcated-api-record",
+		Name:        recordWebhookName,
 		WebhookName: "deprecateapi.operator.horis233.com",
+		Register: webhooks.AdmissionWebhookRegister{
+			Type: webhooks.ValidatingType,
+			Path: "/deprecate-api-check",
+			Hook: &admission.Webhook{Handler: recorder},
+		},
+	})
+	webhooks.Config.AddWebhook(webhooks.CSWebhook{
+		Name:        tenantRulesWebhookName,
+		WebhookName: "tenantrules.operator.horis233.com",
+		Register: webhooks.AdmissionWebhookRegister{
+			Type: webhooks.ValidatingType,
+			Path: "/deprecate-api-tenant-rules",
+			Hook: &admission.Webhook{Handler: tenantRecorder},
+		},
+	})
+
+	// The target version of the Depremon objects defaults to the version of
+	// the cluster
+	clusterVersion, err := utils.GetClusterVersion(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	depremonWebhook := &operatorv1alpha1.DepremonWebhook{
+		Reader:            mgr.GetAPIReader(),
+		OperatorNamespace: namespace,
+		ClusterVersion:    clusterVersion,
+	}
+	webhooks.Config.AddWebhook(webhooks.CSWebhook{
+		Name:        depremonWebhookName,
+		WebhookName: "depremon.operator.horis233.com",
 		Rules: []webhooks.RuleWithOperations{
 			webhooks.NewRule().
-				OneResource("networking.k8s.io", "v1beta1", "ingresses").
+				OneResource(operatorv1alpha1.GroupVersion.Group, operatorv1alpha1.GroupVersion.Version, "depremons").
 				ForCreate().
+				ForUpdate().
 				NamespacedScope(),
-			webhooks.NewRule().
-				OneResource("networking.k8s.io", "v1beta1", "ingressclasses").
-				ForCreate().
-				NamespacedScope(),
-			webhooks.NewRule().
-				OneResource("apiextensions.k8s.io", "v1beta1", "customresourcedefinitions").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("admissionregistration.k8s.io", "v1beta1", "mutatingwebhookconfigurations").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("admissionregistration.k8s.io", "v1beta1", "validatingwebhookconfigurations").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("apiregistration.k8s.io", "v1beta1", "apiservices").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("coordination.k8s.io", "v1beta1", "leases").
-				ForCreate().
-				NamespacedScope(),
-			webhooks.NewRule().
-				OneResource("rbac.authorization.k8s.io", "v1beta1", "roles").
-				ForCreate().
-				NamespacedScope(),
-			webhooks.NewRule().
-				OneResource("rbac.authorization.k8s.io", "v1beta1", "rolebindings").
-				ForCreate().
-				NamespacedScope(),
-			webhooks.NewRule().
-				OneResource("rbac.authorization.k8s.io", "v1beta1", "clusterroles").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("rbac.authorization.k8s.io", "v1beta1", "clusterrolebindings").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("scheduling.k8s.io", "v1beta1", "priorityclasses").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("storage.k8s.io", "v1beta1", "csidrivers").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("storage.k8s.io", "v1beta1", "csinodes").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("storage.k8s.io", "v1beta1", "storageclasses").
-				ForCreate().
-				ClusterScope(),
-			webhooks.NewRule().
-				OneResource("storage.k8s.io", "v1beta1", "volumeattachments").
-				ForCreate().
-				ClusterScope(),
 		},
-		Register: webhooks.AdmissionWebhookRegister{
-			Type: webhooks.ValidatingType,
-			Path: "/deprecate-api-check",
-			Hook: &admission.Webhook{
-				Handler: &handler.Recorder{
-					Client:     r.Client,
-					Namespaces: namespaces,
-				},
-			},
+		Register: webhooks.HandlerWebhookRegister{
+			Object:     &operatorv1alpha1.Depremon{},
+			Defaulting: depremonWebhook.DefaultingHandler(),
+			Validating: depremonWebhook.ValidatingHandler(),
+		},
+		// Depremon objects of the other versions are converted to v1alpha1
+		// before being defaulted and validated
+		Policy: webhooks.WebhookPolicy{
+			MatchPolicy: admissionregistrationv1.Equivalent,
 		},
 	})
+	webhooks.Config.AddConversion(depremonCRDName)
 
 	klog.Info("setting up webhook server")
-	if err := webhooks.Config.SetupServer(*r.Manager, namespace); err != nil {
+	return webhooks.Config.SetupServer(mgr, namespace)
+}
+
+// configureWebhooks updates the rules and the policy of the webhooks from the
+// catalog, the deprecated fields, the custom rules and the Depremon spec. The
+// tenant rules are only observed in their namespaces, by their own webhook.
+func (r *DepremonReconciler) configureWebhooks(apis []operatorv1alpha1.DeprecatedAPI, fields []operatorv1alpha1.DeprecatedField,
+	clusterRules []operatorv1alpha1.CustomRule, tenantRules map[string][]operatorv1alpha1.CustomRule, spec operatorv1alpha1.WebhookSpec) error {
+	policy := webhooks.WebhookPolicy{
+		FailurePolicy:  spec.FailurePolicy,
+		MatchPolicy:    spec.MatchPolicy,
+		TimeoutSeconds: spec.TimeoutSeconds,
+	}
+	if err := webhooks.Config.ConfigureWebhook(recordWebhookName, rulesFor(apis, fields, clusterRules), metav1.LabelSelector{}, policy); err != nil {
 		return err
 	}
-	return nil
+
+	var namespaces []string
+	for ns := range tenantRules {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	var rules []operatorv1alpha1.CustomRule
+	for _, ns := range namespaces {
+		rules = append(rules, tenantRules[ns]...)
+	}
+	nsSelector := metav1.LabelSelector{}
+	if len(namespaces) != 0 {
+		nsSelector.MatchExpressions = []metav1.LabelSelectorRequirement{{
+			Key:      namespaceNameLabel,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   namespaces,
+		}}
+	}
+	return webhooks.Config.ConfigureWebhook(tenantRulesWebhookName, rulesFor(nil, nil, rules), nsSelector, policy)
+}
+
+// customRules returns the custom rules of the Depremon objects of the operator
+// namespace, which apply to the whole cluster, and the rules of the other
+// Depremon objects by namespace. The Depremon objects of all the namespaces
+// are read from their cache, and watched.
+func (r *DepremonReconciler) customRules(ctx context.Context, namespace string) ([]operatorv1alpha1.CustomRule, map[string][]operatorv1alpha1.CustomRule, error) {
+	list := &operatorv1alpha1.DepremonList{}
+	if err := r.Depremons.List(ctx, list); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Name < list.Items[j].Name
+	})
+
+	var clusterRules []operatorv1alpha1.CustomRule
+	tenantRules := make(map[string][]operatorv1alpha1.CustomRule)
+	for _, depremon := range list.Items {
+		if !depremon.GetDeletionTimestamp().IsZero() || len(depremon.Spec.Rules) == 0 {
+			continue
+		}
+		if depremon.Namespace == namespace {
+			clusterRules = append(clusterRules, depremon.Spec.Rules...)
+		} else {
+			tenantRules[depremon.Namespace] = append(tenantRules[depremon.Namespace], depremon.Spec.Rules...)
+		}
+	}
+	return clusterRules, tenantRules, nil
+}
+
+// configureNotifier sets the sinks of the notifier from the Depremon objects
+// of the operator namespace
+func (r *DepremonReconciler) configureNotifier(ctx context.Context, namespace string) error {
+	if r.Notifier == nil {
+		return nil
+	}
+	list := &operatorv1alpha1.DepremonList{}
+	if err := r.Client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Name < list.Items[j].Name
+	})
+
+	var sinks []operatorv1alpha1.NotificationSink
+	for _, depremon := range list.Items {
+		if !depremon.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		sinks = append(sinks, depremon.Spec.Notifications...)
+	}
+	return r.Notifier.Configure(sinks)
+}
+
+// rulesFor creates a webhook rule for each API of the catalog, and for each
+// resource holding deprecated fields or matched by custom rules
+func rulesFor(apis []operatorv1alpha1.DeprecatedAPI, fields []operatorv1alpha1.DeprecatedField, customRules []operatorv1alpha1.CustomRule) []webhooks.RuleWithOperations {
+	var rules []webhooks.RuleWithOperations
+	for _, api := range apis {
+		rule := webhooks.NewRule().
+			OneResource(api.Group, api.Version, api.Resource).
+			ForCreate()
+		switch api.Scope {
+		case operatorv1alpha1.NamespacedScope:
+			rule = rule.NamespacedScope()
+		case operatorv1alpha1.ClusterScope:
+			rule = rule.ClusterScope()
+		default:
+			rule = rule.AllScope()
+		}
+		rules = append(rules, rule)
+	}
+
+	// the fields and the custom rules apply on create and on update, in any
+	// version unless they are restricted to some of them
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		rules = appendUpdateRules(rules, seen, field.Group, field.Versions, field.Resource)
+	}
+	for _, rule := range customRules {
+		rules = appendUpdateRules(rules, seen, rule.Group, rule.Versions, rule.Resource)
+	}
+	return rules
+}
+
+// appendUpdateRules adds the rules observing the creations and the updates of
+// a resource, skipping the versions already seen
+func appendUpdateRules(rules []webhooks.RuleWithOperations, seen map[string]bool, group string, versions []string, resource string) []webhooks.RuleWithOperations {
+	if len(versions) == 0 {
+		versions = []string{"*"}
+	}
+	for _, version := range versions {
+		key := group + "/" + version + "/" + resource
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		rules = append(rules, webhooks.NewRule().
+			OneResource(group, version, resource).
+			ForCreate().
+			ForUpdate().
+			AllScope())
+	}
+	return rules
+}
+
+// managed filters the events of the resources reconciled for the webhook, so
+// they are restored when they drift
+var managed = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	return webhooks.Config.IsManaged(obj)
+})
+
+// deprecatedVersions filters the events of the custom resource definitions
+// serving deprecated versions, so the webhook rules follow them
+var deprecatedVersions = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return hasDeprecatedVersion(e.Object)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return hasDeprecatedVersion(e.ObjectOld) || hasDeprecatedVersion(e.ObjectNew)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return hasDeprecatedVersion(e.Object)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return hasDeprecatedVersion(e.Object)
+	},
+}
+
+// importedCatalog filters the events of the config maps holding the catalogs
+// imported by the ClusterDepremon objects, so the policy follows them
+func (r *DepremonReconciler) importedCatalog(obj client.Object) bool {
+	list := &operatorv1alpha1.ClusterDepremonList{}
+	if err := r.Client.List(context.TODO(), list); err != nil {
+		klog.Error(err)
+		return false
+	}
+	for _, cluster := range list.Items {
+		for _, source := range cluster.Spec.Imports {
+			if source.ConfigMap != nil && source.ConfigMap.Name == obj.GetName() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// outsideOperatorNamespace filters the events of the Depremon objects of the
+// other namespaces, so the tenant rules of the webhook follow them
+func outsideOperatorNamespace(obj client.Object) bool {
+	namespace, err := utils.GetOperatorNamespace()
+	if err != nil {
+		klog.Error(err)
+		return false
+	}
+	return obj.GetNamespace() != namespace
+}
+
+func hasDeprecatedVersion(obj client.Object) bool {
+	crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+	return ok && catalog.HasDeprecatedVersion(crd)
+}
+
+// depremonsInOperatorNamespace enqueues the Depremon objects of the operator
+// namespace, when a ClusterDepremon, an imported catalog or the deprecated
+// versions of a custom resource definition change so the policy and the
+// webhook rules follow the catalog, when the rules of a Depremon of another
+// namespace change, or when a resource reconciled for the webhook changes
+func (r *DepremonReconciler) depremonsInOperatorNamespace(_ client.Object) []reconcile.Request {
+	namespace, err := utils.GetOperatorNamespace()
+	if err != nil {
+		klog.Error(err)
+		return nil
+	}
+
+	list := &operatorv1alpha1.DepremonList{}
+	if err := r.Client.List(context.TODO(), list, client.InNamespace(namespace)); err != nil {
+		klog.Error(err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, instance := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: instance.Namespace,
+			Name:      instance.Name,
+		}})
+	}
+	return requests
 }
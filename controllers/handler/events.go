@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/workload"
+)
+
+const (
+	// DeprecatedAPIUsedReason is the reason of the events recorded when a
+	// deprecated API is used by a new requester or for a new object
+	DeprecatedAPIUsedReason = "DeprecatedAPIUsed"
+
+	// eventInterval is the minimum interval between two events for the same
+	// requester on the same object
+	eventInterval = 10 * time.Minute
+	// findingTimeout bounds the lookup of the workloads of a new finding
+	findingTimeout = 30 * time.Second
+	// findingQueueSize is the number of new findings waiting for their
+	// workloads to be looked up. New findings are dropped when the queue is
+	// full, so the webhook is never blocked.
+	findingQueueSize = 100
+	// findingWorkers is the number of new findings looked up at once
+	findingWorkers = 4
+)
+
+// pendingFinding is a new finding waiting for its workloads to be looked up
+type pendingFinding struct {
+	operatorNs     string
+	requesterNs    string
+	requesterName  string
+	apiFromRequest DeprecatedObjectList
+	message        string
+}
+
+// queue returns the queue of the new findings, created on first use as the
+// recorders are built as struct literals
+func (r *Recorder) queue() chan pendingFinding {
+	r.queueOnce.Do(func() {
+		r.findings = make(chan pendingFinding, findingQueueSize)
+	})
+	return r.findings
+}
+
+// queueFinding queues a new finding. It doesn't block, the finding is dropped
+// when the queue is full: it is in the report already, only its workloads,
+// owners, events and notifications are missing.
+func (r *Recorder) queueFinding(finding pendingFinding) {
+	select {
+	case r.queue() <- finding:
+	default:
+		klog.Warningf("New finding queue is full, dropping the details of %s", finding.message)
+	}
+}
+
+// Start looks up the queued findings with findingWorkers workers until ctx is
+// done
+func (r *Recorder) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < findingWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case f := <-r.queue():
+					r.newFinding(f.operatorNs, f.requesterNs, f.requesterName, f.apiFromRequest, f.message)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// NeedLeaderElection is false, the webhook records findings on every replica
+func (r *Recorder) NeedLeaderElection() bool {
+	return false
+}
+
+// eventLimiter remembers when an event was last recorded on an object
+type eventLimiter struct {
+	lock sync.Mutex
+	last map[string]time.Time
+}
+
+// allow tells if the event can be recorded now, and remembers it
+func (limiter *eventLimiter) allow(key string, now time.Time) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if limiter.last == nil {
+		limiter.last = make(map[string]time.Time)
+	}
+	// forget the expired entries, so the map doesn't grow forever
+	for k, t := range limiter.last {
+		if now.Sub(t) >= eventInterval {
+			delete(limiter.last, k)
+		}
+	}
+	if _, found := limiter.last[key]; found {
+		return false
+	}
+	limiter.last[key] = now
+	return true
+}
+
+// recordEvents records a Warning event on the Depremon objects of the
+// operator namespace and, when the requester is a service account, on the
+// ServiceAccount and on the workloads running with it. The events are rate
+// limited by object and requester, whatever their message.
+func (r *Recorder) recordEvents(ctx context.Context, operatorNs, requester string, sa *corev1.ServiceAccount, workloads []workload.Workload, message string) {
+	if r.EventRecorder == nil {
+		return
+	}
+
+	var objects []client.Object
+	depremons := &operatorv1alpha1.DepremonList{}
+	if err := r.Client.List(ctx, depremons, client.InNamespace(operatorNs)); err != nil {
+		klog.Error(err)
+	}
+	for i := range depremons.Items {
+		depremons.Items[i].SetGroupVersionKind(operatorv1alpha1.GroupVersion.WithKind("Depremon"))
+		objects = append(objects, &depremons.Items[i])
+	}
+
+	if sa != nil {
+		objects = append(objects, sa)
+	}
+	for _, w := range workloads {
+		objects = append(objects, w.Object)
+	}
+
+	now := time.Now()
+	for _, obj := range objects {
+		key := fmt.Sprintf("%s/%s/%s/%s/%s", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetNamespace(), obj.GetName(),
+			DeprecatedAPIUsedReason, requester)
+		if !r.limiter.allow(key, now) {
+			continue
+		}
+		r.EventRecorder.Event(obj, corev1.EventTypeWarning, DeprecatedAPIUsedReason, message)
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func TestRecordEventsRateLimit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := operatorv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	r := &Recorder{
+		Client:        fake.NewClientBuilder().WithScheme(scheme).Build(),
+		EventRecorder: recorder,
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "deployer"}}
+	sa.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ServiceAccount"))
+	ctx := context.Background()
+
+	r.recordEvents(ctx, "depremon", "shop/deployer", sa, nil, "networking.k8s.io/v1beta1 Ingress used by shop/deployer for shop/web")
+	// the messages differ by object, the requester is the same
+	r.recordEvents(ctx, "depremon", "shop/deployer", sa, nil, "networking.k8s.io/v1beta1 Ingress used by shop/deployer for shop/cart")
+	r.recordEvents(ctx, "depremon", "kubernetes-admin", sa, nil, "networking.k8s.io/v1beta1 Ingress used by kubernetes-admin for shop/web")
+
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected an event per requester, got %d", len(recorder.Events))
+	}
+}
+
+func TestQueueFindingDropsWhenFull(t *testing.T) {
+	r := &Recorder{}
+	for i := 0; i < findingQueueSize+10; i++ {
+		// never blocks the webhook
+		r.queueFinding(pendingFinding{requesterName: "deployer"})
+	}
+	if len(r.queue()) != findingQueueSize {
+		t.Errorf("expected %d queued findings, got %d", findingQueueSize, len(r.queue()))
+	}
+}
@@ -2,24 +2,61 @@ package handler
 
 import (
 	"context"
-	"net/http"
+	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	utilyaml "github.com/ghodss/yaml"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+	"github.com/horis233/k8s-deprecation-checker/controllers/notifier"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+	"github.com/horis233/k8s-deprecation-checker/controllers/rules"
+	"github.com/horis233/k8s-deprecation-checker/controllers/useragent"
 	"github.com/horis233/k8s-deprecation-checker/controllers/utils"
+	"github.com/horis233/k8s-deprecation-checker/controllers/workload"
+)
+
+const (
+	// ReportName is the name of the config map holding the report
+	ReportName = "deprecated-api-report"
+	// ReportKey is the key of the report in the config map
+	ReportKey = "deprecated-api-report.yaml"
 )
 
 type Recorder struct {
-	Client     client.Client
-	Namespaces []string
-	decoder    *admission.Decoder
+	Client client.Client
+	// Reader reads the objects of the whole cluster
+	Reader client.Reader
+	// Policy is the policy of the cluster, built by the reconciler
+	Policy *policy.Shared
+	// Depremons reads the Depremon objects of all the namespaces from a cache
+	Depremons client.Reader
+	// EventRecorder records events for the new requesters and objects
+	EventRecorder record.EventRecorder
+	// Notifier sends the new requesters and objects to the sinks
+	Notifier *notifier.Notifier
+	// TenantRules makes the recorder only evaluate the rules of the Depremon
+	// objects of the namespace of the object, for the webhook restricted to
+	// the namespaces with such rules
+	TenantRules bool
+	decoder     *admission.Decoder
+	limiter     eventLimiter
+	rules       rules.Evaluator
+	findings    chan pendingFinding
+	queueOnce   sync.Once
 }
 
 type DeprecatedObjectList struct {
@@ -32,28 +69,113 @@ type DeprecatedObject struct {
 	Name          string   `json:"name"`
 	Namespace     string   `json:"namespace,omitempty"`
 	RequesterList []string `json:"requesterList"`
+	// Workloads running with the service accounts of the requesters
+	Workloads []RequesterWorkload `json:"workloads,omitempty"`
+	// Clients used by the requesters
+	Clients []RequesterClient `json:"clients,omitempty"`
+	// Owners are the teams owning the requesters
+	Owners []RequesterOwner `json:"owners,omitempty"`
+	// Fields are the deprecated fields set by the requesters
+	Fields []RequesterField `json:"fields,omitempty"`
+	// Rules are the custom rules matched by the requests of the requesters
+	Rules []RequesterRule `json:"rules,omitempty"`
+
+	// State of the finding, see FindingState
+	State FindingState `json:"state,omitempty"`
+	// FirstSeen and LastSeen are the times the object was first and last
+	// requested with the deprecated API
+	FirstSeen *metav1.Time `json:"firstSeen,omitempty"`
+	LastSeen  *metav1.Time `json:"lastSeen,omitempty"`
+	// ResolvedAt is the time the finding was resolved
+	ResolvedAt *metav1.Time `json:"resolvedAt,omitempty"`
+}
+
+// RequesterClient is the client used by a requester
+type RequesterClient struct {
+	Requester string `json:"requester"`
+	useragent.Client
+}
+
+// RequesterField is a deprecated field set by a requester
+type RequesterField struct {
+	Requester string `json:"requester"`
+	// Path of the field in the object, e.g. spec.nodeSelector[beta.kubernetes.io/os]
+	Path       string `json:"path"`
+	RemovedIn  string `json:"removedIn,omitempty"`
+	ReplacedBy string `json:"replacedBy,omitempty"`
+}
+
+// RequesterRule is a custom rule matched by a request of a requester
+type RequesterRule struct {
+	Requester string                        `json:"requester"`
+	Rule      string                        `json:"rule"`
+	Severity  operatorv1alpha1.RuleSeverity `json:"severity,omitempty"`
+	Message   string                        `json:"message,omitempty"`
+}
+
+// RequesterWorkload is a workload running with the service account of a
+// requester
+type RequesterWorkload struct {
+	Requester string `json:"requester"`
+	// Description reads like "operator foo:v1.2.3 in ns bar"
+	Description string `json:"description"`
+	workload.Workload
 }
 
 // Handle will record deprecated resources
 func (r *Recorder) Handle(ctx context.Context, req admission.Request) admission.Response {
 	klog.Infof("Webhook is invoked by resource %s/%s, created by %s", req.AdmissionRequest.Namespace, req.AdmissionRequest.Name, req.UserInfo.Username)
 
-	requesterNs := strings.Split(req.UserInfo.Username, ":")[2]
-	requesterName := strings.Split(req.UserInfo.Username, ":")[3]
+	requesterNs, requesterName := RequesterFor(req.UserInfo.Username)
+	requester := requesterName
+	if requesterNs != "" {
+		requester = requesterNs + "/" + requesterName
+	}
 
-	if len(r.Namespaces) != 0 {
-		var find bool
-		// r.Namespaces = append(r.Namespaces, "openshift-operator-lifecycle-manager")
-		for _, ns := range r.Namespaces {
-			if requesterNs == ns {
-				find = true
-				break
-			}
+	// The failures of depremon never reject a request, only its policy does:
+	// an errored response denies the request, whatever the failure policy
+	operatorNs, err := utils.GetOperatorNamespace()
+	if err != nil {
+		klog.Error(err)
+		return admission.Allowed("")
+	}
+	p, err := r.policy(ctx, operatorNs, req.Namespace)
+	if err != nil {
+		klog.Error(err)
+		return admission.Allowed("")
+	}
+
+	if !p.Records(requesterNs) {
+		klog.Infof("Requester %s is filtered", requester)
+		return admission.Allowed("")
+	}
+	if p.Exempted(req.Namespace, requesterNs, requester) {
+		klog.Infof("Requester %s is exempted", requester)
+		return admission.Allowed("")
+	}
+
+	// Each rule is evaluated by a single webhook, the deprecated APIs and
+	// fields are recorded by the webhook of the cluster rules
+	kind, resource := requested(req)
+	deprecatedAPI := false
+	var uses []catalog.FieldUse
+	customRules := p.Rules
+	if r.TenantRules {
+		customRules = p.TenantRules
+	} else {
+		_, deprecatedAPI = catalog.Lookup(p.Catalog, resource.Group, resource.Version, resource.Resource)
+		if !deprecatedAPI {
+			_, deprecatedAPI = catalog.Lookup(p.Catalog, req.Resource.Group, req.Resource.Version, req.Resource.Resource)
 		}
-		if !find {
-			klog.Infof("Requester %s/%s is filtered", requesterNs, requesterName)
-			return admission.Allowed("")
+		if deprecatedAPI && resource != req.Resource && isStable(resource.Version) {
+			klog.Infof("Request converted from %s/%s is filtered", resource.Group, resource.Version)
+			deprecatedAPI = false
 		}
+		uses = deprecatedFields(p, req)
+	}
+	matched := r.rules.Matching(rules.For(customRules, req.Resource.Group, req.Resource.Version, req.Resource.Resource), req)
+	if !deprecatedAPI && len(uses) == 0 && len(matched) == 0 {
+		return admission.Allowed("")
 	}
 
 	var obj DeprecatedObject
@@ -61,7 +183,7 @@ func (r *Recorder) Handle(ctx context.Context, req admission.Request) admission.
 		obj = DeprecatedObject{
 			Name: req.Name,
 			RequesterList: []string{
-				requesterNs + "/" + requesterName,
+				requester,
 			},
 		}
 	} else {
@@ -69,27 +191,309 @@ func (r *Recorder) Handle(ctx context.Context, req admission.Request) admission.
 			Name:      req.Name,
 			Namespace: req.Namespace,
 			RequesterList: []string{
-				requesterNs + "/" + requesterName,
+				requester,
 			},
 		}
 	}
 
+	if requesterClient, found := clientFor(req, kind); found {
+		obj.Clients = []RequesterClient{{Requester: requester, Client: requesterClient}}
+	}
+	var messages []string
+	if deprecatedAPI {
+		messages = append(messages, deprecationMessage(p, req))
+	}
+	for _, use := range uses {
+		obj.Fields = append(obj.Fields, RequesterField{
+			Requester:  requester,
+			Path:       use.Path,
+			RemovedIn:  use.Field.RemovedIn,
+			ReplacedBy: use.Field.ReplacedBy,
+		})
+		messages = append(messages, use.Message())
+	}
+	// Info rules are recorded without warning nor denying the request
+	enforced := append([]string{}, messages...)
+	for _, rule := range matched {
+		obj.Rules = append(obj.Rules, RequesterRule{
+			Requester: requester,
+			Rule:      rule.Name,
+			Severity:  rule.Severity,
+			Message:   rule.Message,
+		})
+		messages = append(messages, ruleMessage(rule))
+		if rule.Severity != operatorv1alpha1.InfoSeverity {
+			enforced = append(enforced, ruleMessage(rule))
+		}
+	}
+
 	apiFromRequest := DeprecatedObjectList{
-		Group:   req.Kind.Group,
-		Version: req.Kind.Version,
-		Kind:    req.Kind.Kind,
+		Group:   kind.Group,
+		Version: kind.Version,
+		Kind:    kind.Kind,
 		Objects: []DeprecatedObject{
 			obj,
 		},
 	}
 
-	err := UpdateConfigmap(ctx, r.Client, apiFromRequest)
+	// A report which can't be written must not reject the request, the
+	// finding is recorded on its next request
+	added, err := UpdateConfigmap(ctx, r.Client, apiFromRequest)
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		klog.Errorf("failed to record %s in the report: %v", objectName(req), err)
+	}
+	if added {
+		message := fmt.Sprintf("%s used by %s for %s", strings.Join(messages, "; "), requester, objectName(req))
+		r.queueFinding(pendingFinding{
+			operatorNs:     operatorNs,
+			requesterNs:    requesterNs,
+			requesterName:  requesterName,
+			apiFromRequest: apiFromRequest,
+			message:        message,
+		})
+	}
+
+	if len(enforced) == 0 {
+		return admission.Allowed("")
+	}
+	switch p.Mode {
+	case operatorv1alpha1.WarnMode:
+		return admission.Allowed("").WithWarnings(enforced...)
+	case operatorv1alpha1.DenyMode:
+		return admission.Denied(strings.Join(enforced, "; "))
 	}
 	return admission.Allowed("")
 }
 
+// policy returns the policy of the cluster narrowed for the namespace of the
+// object. It is built here, without the discovered APIs, until the reconciler
+// shares it.
+func (r *Recorder) policy(ctx context.Context, operatorNs, namespace string) (*policy.Policy, error) {
+	p := r.Policy.Load()
+	if p == nil {
+		var err error
+		if p, err = policy.ForCluster(ctx, r.Client, operatorNs, nil); err != nil {
+			return nil, err
+		}
+	}
+	return p.ForNamespace(ctx, r.Depremons, operatorNs, namespace)
+}
+
+// newFinding resolves the workloads of a new requester to add them to the
+// report, then records the events and sends the notifications
+func (r *Recorder) newFinding(operatorNs, requesterNs, requesterName string, apiFromRequest DeprecatedObjectList, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), findingTimeout)
+	defer cancel()
+
+	obj := apiFromRequest.Objects[0]
+	requester := obj.RequesterList[0]
+	var sa *corev1.ServiceAccount
+	var workloads []workload.Workload
+	var descriptions []string
+	if requesterNs != "" {
+		sa = &corev1.ServiceAccount{}
+		if err := r.Reader.Get(ctx, client.ObjectKey{Namespace: requesterNs, Name: requesterName}, sa); err != nil {
+			klog.Error(err)
+			sa = nil
+		} else {
+			sa.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ServiceAccount"))
+		}
+
+		var err error
+		workloads, err = workload.ForServiceAccount(ctx, r.Reader, requesterNs, requesterName)
+		if err != nil {
+			klog.Error(err)
+		}
+		for _, w := range workloads {
+			obj.Workloads = append(obj.Workloads, RequesterWorkload{
+				Requester:   requester,
+				Description: w.String(),
+				Workload:    w,
+			})
+			descriptions = append(descriptions, w.String())
+		}
+		if len(descriptions) != 0 {
+			message += " by " + strings.Join(descriptions, ", ")
+		}
+	}
+
+	// The owner is looked for from the most specific object: the workloads,
+	// the service account, then the namespaces of the requester and of the
+	// object
+	var candidates []client.Object
+	for _, w := range workloads {
+		candidates = append(candidates, w.Object)
+	}
+	if sa != nil {
+		candidates = append(candidates, sa)
+	}
+	candidates = append(candidates, r.namespaces(ctx, requesterNs, obj.Namespace)...)
+	owner, source := ownerFor(r.ownerKeys(ctx, operatorNs), candidates...)
+	if owner != "" {
+		obj.Owners = []RequesterOwner{{Requester: requester, Owner: owner, Source: source}}
+	}
+
+	if len(obj.Workloads) != 0 || len(obj.Owners) != 0 {
+		apiFromRequest.Objects = []DeprecatedObject{obj}
+		if err := AddRequesterDetails(ctx, r.Client, apiFromRequest); err != nil {
+			klog.Error(err)
+		}
+	}
+
+	r.recordEvents(ctx, operatorNs, requester, sa, workloads, message)
+	if r.Notifier != nil {
+		r.Notifier.Notify(notifier.Finding{
+			Group:     apiFromRequest.Group,
+			Version:   apiFromRequest.Version,
+			Kind:      apiFromRequest.Kind,
+			Name:      obj.Name,
+			Namespace: obj.Namespace,
+			Requester: requester,
+			Workloads: descriptions,
+			Owner:     owner,
+			Message:   message,
+			Time:      time.Now(),
+		})
+	}
+}
+
+// namespaces reads the namespaces with the given names, skipping the empty
+// and the duplicated ones
+func (r *Recorder) namespaces(ctx context.Context, names ...string) []client.Object {
+	var namespaces []client.Object
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		ns := &corev1.Namespace{}
+		if err := r.Reader.Get(ctx, client.ObjectKey{Name: name}, ns); err != nil {
+			klog.Error(err)
+			continue
+		}
+		ns.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
+
+// RequesterFor splits the user name of a service account into its namespace
+// and name. Other users are returned without namespace.
+func RequesterFor(username string) (namespace, name string) {
+	parts := strings.Split(username, ":")
+	if len(parts) == 4 && parts[0] == "system" && parts[1] == "serviceaccount" {
+		return parts[2], parts[3]
+	}
+	return "", username
+}
+
+// clientFor returns the client of the request, parsed from the field manager
+// the apiserver derived from its user-agent. The admission request doesn't
+// carry the user-agent, and the apiserver only keeps the part before the first
+// "/", so the version is only known when the client sets its own field manager
+// as "binary/version".
+func clientFor(req admission.Request, kind metav1.GroupVersionKind) (useragent.Client, bool) {
+	raw := req.Object.Raw
+	if len(raw) == 0 {
+		raw = req.OldObject.Raw
+	}
+	metadata := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(raw, metadata); err != nil {
+		return useragent.Client{}, false
+	}
+
+	apiVersion := kind.Version
+	if kind.Group != "" {
+		apiVersion = kind.Group + "/" + kind.Version
+	}
+	var latest *metav1.ManagedFieldsEntry
+	for i, entry := range metadata.ManagedFields {
+		if entry.APIVersion != apiVersion || entry.Manager == "" {
+			continue
+		}
+		if latest == nil || (entry.Time != nil && latest.Time != nil && latest.Time.Before(entry.Time)) {
+			latest = &metadata.ManagedFields[i]
+		}
+	}
+	if latest == nil {
+		return useragent.Client{}, false
+	}
+	return useragent.Parse(latest.Manager), true
+}
+
+// requested returns the kind and the resource used by the client. With the
+// Equivalent match policy, the apiserver converts the object to the version of
+// the webhook rule and keeps the original ones in RequestKind and
+// RequestResource.
+func requested(req admission.Request) (metav1.GroupVersionKind, metav1.GroupVersionResource) {
+	kind, resource := req.Kind, req.Resource
+	if req.RequestKind != nil {
+		kind = *req.RequestKind
+	}
+	if req.RequestResource != nil {
+		resource = *req.RequestResource
+	}
+	return kind, resource
+}
+
+// deprecatedFields returns the deprecated fields set in the requested object.
+// The object is in the version of req.Resource, converted by the apiserver
+// when the rule matched an equivalent version.
+func deprecatedFields(p *policy.Policy, req admission.Request) []catalog.FieldUse {
+	fields := catalog.FieldsFor(p.Fields, req.Resource.Group, req.Resource.Version, req.Resource.Resource)
+	if len(fields) == 0 || len(req.Object.Raw) == 0 {
+		return nil
+	}
+	object := make(map[string]interface{})
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		klog.Error(err)
+		return nil
+	}
+	return catalog.FindFields(fields, object)
+}
+
+// ruleMessage describes a custom rule matched by a request
+func ruleMessage(rule operatorv1alpha1.CustomRule) string {
+	message := fmt.Sprintf("%s rule %s is matched", rule.Severity, rule.Name)
+	if rule.Message != "" {
+		message += ": " + rule.Message
+	}
+	return message
+}
+
+// isStable tells if a version is neither alpha nor beta
+func isStable(version string) bool {
+	return !strings.Contains(version, "alpha") && !strings.Contains(version, "beta")
+}
+
+// objectName returns the namespace and the name of the requested object
+func objectName(req admission.Request) string {
+	if req.Namespace == "" {
+		return req.Name
+	}
+	return req.Namespace + "/" + req.Name
+}
+
+func deprecationMessage(p *policy.Policy, req admission.Request) string {
+	_, resource := requested(req)
+	message := fmt.Sprintf("%s/%s %s is deprecated", resource.Group, resource.Version, resource.Resource)
+	api, found := catalog.Lookup(p.Catalog, resource.Group, resource.Version, resource.Resource)
+	if !found {
+		api, found = catalog.Lookup(p.Catalog, req.Resource.Group, req.Resource.Version, req.Resource.Resource)
+	}
+	if !found {
+		return message
+	}
+	if api.RemovedIn != "" {
+		message += fmt.Sprintf(" and removed in %s", api.RemovedIn)
+	}
+	if api.ReplacedBy != "" {
+		message += fmt.Sprintf(", use %s instead", api.ReplacedBy)
+	}
+	return message
+}
+
 func AddtoReport(apiReport []DeprecatedObjectList, pendingApi DeprecatedObjectList) []DeprecatedObjectList {
 	apiMap := make(map[string]int)
 	apiObjMap := make(map[string]int)
@@ -102,12 +506,16 @@ func AddtoReport(apiReport []DeprecatedObjectList, pendingApi DeprecatedObjectLi
 	if objIndex, apiFound := apiMap[pendingApi.Group+pendingApi.Version+pendingApi.Kind]; apiFound {
 		resourceIndex, objFound := apiObjMap[pendingApi.Objects[0].Name+pendingApi.Objects[0].Namespace+pendingApi.Group+pendingApi.Version+pendingApi.Kind]
 		if objFound {
+			existing := &apiReport[objIndex].Objects[resourceIndex]
+			existing.Fields = mergeFields(existing.Fields, pendingApi.Objects[0].Fields)
+			existing.Rules = mergeRules(existing.Rules, pendingApi.Objects[0].Rules)
 			for _, req := range apiReport[objIndex].Objects[resourceIndex].RequesterList {
 				if req == pendingApi.Objects[0].RequesterList[0] {
 					return apiReport
 				}
 			}
 			apiReport[objIndex].Objects[resourceIndex].RequesterList = append(apiReport[objIndex].Objects[resourceIndex].RequesterList, pendingApi.Objects[0].RequesterList[0])
+			apiReport[objIndex].Objects[resourceIndex].Clients = append(apiReport[objIndex].Objects[resourceIndex].Clients, pendingApi.Objects[0].Clients...)
 			return apiReport
 		}
 		apiReport[objIndex].Objects = append(apiReport[objIndex].Objects, pendingApi.Objects[0])
@@ -117,50 +525,209 @@ func AddtoReport(apiReport []DeprecatedObjectList, pendingApi DeprecatedObjectLi
 	return apiReport
 }
 
-func UpdateConfigmap(ctx context.Context, client client.Client, apiFromRequest DeprecatedObjectList) error {
-	cm := &corev1.ConfigMap{}
+// mergeFields adds the pending fields missing from the fields of an object
+func mergeFields(fields, pending []RequesterField) []RequesterField {
+	for _, p := range pending {
+		if !hasField(fields, p) {
+			fields = append(fields, p)
+		}
+	}
+	return fields
+}
+
+func hasField(fields []RequesterField, field RequesterField) bool {
+	for _, f := range fields {
+		if f.Requester == field.Requester && f.Path == field.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRules adds the pending rules missing from the rules of an object
+func mergeRules(rules, pending []RequesterRule) []RequesterRule {
+	for _, p := range pending {
+		if !hasRule(rules, p) {
+			rules = append(rules, p)
+		}
+	}
+	return rules
+}
+
+func hasRule(rules []RequesterRule, rule RequesterRule) bool {
+	for _, r := range rules {
+		if r.Requester == rule.Requester && r.Rule == rule.Rule {
+			return true
+		}
+	}
+	return false
+}
+
+// inReport tells if the object, the requester, the fields and the rules of
+// pendingApi are already in the report
+func inReport(apiReport []DeprecatedObjectList, pendingApi DeprecatedObjectList) bool {
+	pending := pendingApi.Objects[0]
+	for _, objList := range apiReport {
+		if objList.Group != pendingApi.Group || objList.Version != pendingApi.Version || objList.Kind != pendingApi.Kind {
+			continue
+		}
+		for _, obj := range objList.Objects {
+			if obj.Name != pending.Name || obj.Namespace != pending.Namespace {
+				continue
+			}
+			for _, field := range pending.Fields {
+				if !hasField(obj.Fields, field) {
+					return false
+				}
+			}
+			for _, rule := range pending.Rules {
+				if !hasRule(obj.Rules, rule) {
+					return false
+				}
+			}
+			for _, req := range obj.RequesterList {
+				if req == pending.RequesterList[0] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// UpdateConfigmap adds apiFromRequest to the report, and tells if its object
+// or its requester is new, or if its finding was no longer active. The update
+// is retried when a concurrent request changed or created the report.
+func UpdateConfigmap(ctx context.Context, c client.Client, apiFromRequest DeprecatedObjectList) (bool, error) {
 	ns, err := utils.GetOperatorNamespace()
 	if err != nil {
-		klog.Error(err)
-		return err
+		return false, err
 	}
-	var apiSlice []DeprecatedObjectList
 
-	err = client.Get(ctx, types.NamespacedName{Namespace: ns, Name: "deprecated-api-report"}, cm)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			cm.SetName("deprecated-api-report")
+	added := false
+	err = retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}, func() error {
+		var apiSlice []DeprecatedObjectList
+		now := metav1.Now()
+
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: ReportName}, cm); err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			cm.SetName(ReportName)
 			cm.SetNamespace(ns)
 			apiSlice = AddtoReport(apiSlice, apiFromRequest)
+			touch(apiSlice, apiFromRequest, now)
 			rawData, err := utilyaml.Marshal(apiSlice)
 			if err != nil {
-				klog.Error(err)
 				return err
 			}
-			cm.Data = make(map[string]string)
-			cm.Data["deprecated-api-report.yaml"] = string(rawData)
-			err = client.Create(ctx, cm)
-			if err != nil {
-				klog.Error(err)
+			cm.Data = map[string]string{ReportKey: string(rawData)}
+			if err := c.Create(ctx, cm); err != nil {
 				return err
 			}
-		} else {
-			klog.Error(err)
+			added = true
+			return nil
+		}
+
+		if err := utilyaml.Unmarshal([]byte(cm.Data[ReportKey]), &apiSlice); err != nil {
 			return err
 		}
-	}
-	deprecatedApiReport := cm.Data["deprecated-api-report.yaml"]
-	if err := utilyaml.Unmarshal([]byte(deprecatedApiReport), &apiSlice); err != nil {
-		klog.Error(err)
+		found := inReport(apiSlice, apiFromRequest)
+		if !found {
+			apiSlice = AddtoReport(apiSlice, apiFromRequest)
+		}
+		reactivated, changed := touch(apiSlice, apiFromRequest, now)
+		if found && !changed {
+			added = false
+			return nil
+		}
+		rawData, err := utilyaml.Marshal(apiSlice)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[ReportKey] = string(rawData)
+		if err := c.Update(ctx, cm); err != nil {
+			return err
+		}
+		added = !found || reactivated
+		return nil
+	})
+	return added, err
+}
+
+// AddRequesterDetails adds the workloads and the owner of the requester of
+// apiFromRequest to the report, replacing the previous ones
+func AddRequesterDetails(ctx context.Context, c client.Client, apiFromRequest DeprecatedObjectList) error {
+	ns, err := utils.GetOperatorNamespace()
+	if err != nil {
 		return err
 	}
-	apiSlice = AddtoReport(apiSlice, apiFromRequest)
-	rawData, err := utilyaml.Marshal(apiSlice)
+	pending := apiFromRequest.Objects[0]
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: ReportName}, cm); err != nil {
+			return err
+		}
+		var apiSlice []DeprecatedObjectList
+		if err := utilyaml.Unmarshal([]byte(cm.Data[ReportKey]), &apiSlice); err != nil {
+			return err
+		}
+
+		for i, objList := range apiSlice {
+			if objList.Group != apiFromRequest.Group || objList.Version != apiFromRequest.Version || objList.Kind != apiFromRequest.Kind {
+				continue
+			}
+			for j, obj := range objList.Objects {
+				if obj.Name != pending.Name || obj.Namespace != pending.Namespace {
+					continue
+				}
+				var workloads []RequesterWorkload
+				for _, w := range obj.Workloads {
+					if w.Requester != pending.RequesterList[0] {
+						workloads = append(workloads, w)
+					}
+				}
+				apiSlice[i].Objects[j].Workloads = append(workloads, pending.Workloads...)
+
+				var owners []RequesterOwner
+				for _, owner := range obj.Owners {
+					if owner.Requester != pending.RequesterList[0] {
+						owners = append(owners, owner)
+					}
+				}
+				apiSlice[i].Objects[j].Owners = append(owners, pending.Owners...)
+			}
+		}
+
+		rawData, err := utilyaml.Marshal(apiSlice)
+		if err != nil {
+			return err
+		}
+		cm.Data[ReportKey] = string(rawData)
+		return c.Update(ctx, cm)
+	})
+}
+
+// DeleteReport deletes the config map holding the report
+func DeleteReport(ctx context.Context, client client.Client) error {
+	ns, err := utils.GetOperatorNamespace()
 	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{}
+	cm.SetName(ReportName)
+	cm.SetNamespace(ns)
+	if err := client.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
 		klog.Error(err)
 		return err
 	}
-	cm.Data["deprecated-api-report.yaml"] = string(rawData)
-	err = client.Update(ctx, cm)
-	return err
+	return nil
 }
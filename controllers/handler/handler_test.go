@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	utilyaml "github.com/ghodss/yaml"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+)
+
+func ingressRequest(name, username string) admission.Request {
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"},
+		Resource:  metav1.GroupVersionResource{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"},
+		Namespace: "shop",
+		Name:      name,
+		Operation: admissionv1.Create,
+		UserInfo:  authenticationv1.UserInfo{Username: username},
+	}}
+}
+
+func TestHandle(t *testing.T) {
+	os.Setenv("OPERATOR_NAMESPACE", "depremon")
+	defer os.Unsetenv("OPERATOR_NAMESPACE")
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := operatorv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	shared := &policy.Shared{}
+	shared.Store(&policy.Policy{
+		Catalog: []operatorv1alpha1.DeprecatedAPI{{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", RemovedIn: "v1.22", ReplacedBy: "networking.k8s.io/v1"}},
+		Mode:    operatorv1alpha1.WarnMode,
+	})
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &Recorder{Client: c, Policy: shared, Depremons: c}
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		req      admission.Request
+		warned   bool
+		findings int
+	}{
+		{name: "new object", req: ingressRequest("web", "system:serviceaccount:shop:deployer"), warned: true, findings: 1},
+		{name: "recorded requester", req: ingressRequest("web", "system:serviceaccount:shop:deployer"), warned: true, findings: 1},
+		{name: "new requester", req: ingressRequest("web", "kubernetes-admin"), warned: true, findings: 2},
+		{name: "served API", req: func() admission.Request {
+			req := ingressRequest("cart", "kubernetes-admin")
+			req.Kind.Version, req.Resource.Version = "v1", "v1"
+			return req
+		}(), findings: 2},
+	}
+	for _, test := range tests {
+		resp := r.Handle(ctx, test.req)
+		if !resp.Allowed {
+			t.Errorf("%s: request denied in the warn mode", test.name)
+		}
+		if warned := len(resp.Warnings) != 0; warned != test.warned {
+			t.Errorf("%s: unexpected warnings %v", test.name, resp.Warnings)
+		}
+		if test.warned && !strings.Contains(resp.Warnings[0], "removed in v1.22, use networking.k8s.io/v1 instead") {
+			t.Errorf("%s: unexpected warning %q", test.name, resp.Warnings[0])
+		}
+		if len(r.queue()) != test.findings {
+			t.Errorf("%s: %d findings queued, expected %d", test.name, len(r.queue()), test.findings)
+		}
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "depremon", Name: ReportName}, cm); err != nil {
+		t.Fatal(err)
+	}
+	var report []DeprecatedObjectList
+	if err := utilyaml.Unmarshal([]byte(cm.Data[ReportKey]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || len(report[0].Objects) != 1 {
+		t.Fatalf("unexpected report %v", report)
+	}
+	if requesters := report[0].Objects[0].RequesterList; len(requesters) != 2 || requesters[0] != "shop/deployer" || requesters[1] != "kubernetes-admin" {
+		t.Errorf("unexpected requesters %v", requesters)
+	}
+}
+
+func TestHandleDenyMode(t *testing.T) {
+	os.Setenv("OPERATOR_NAMESPACE", "depremon")
+	defer os.Unsetenv("OPERATOR_NAMESPACE")
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := operatorv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	shared := &policy.Shared{}
+	shared.Store(&policy.Policy{
+		Catalog: []operatorv1alpha1.DeprecatedAPI{{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"}},
+		Mode:    operatorv1alpha1.DenyMode,
+		Exemptions: []operatorv1alpha1.Exemption{
+			{Requesters: []string{"kubernetes-admin"}},
+		},
+	})
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &Recorder{Client: c, Policy: shared, Depremons: c}
+
+	if resp := r.Handle(context.Background(), ingressRequest("web", "system:serviceaccount:shop:deployer")); resp.Allowed {
+		t.Error("request allowed in the deny mode")
+	}
+	if resp := r.Handle(context.Background(), ingressRequest("web", "kubernetes-admin")); !resp.Allowed {
+		t.Error("request of an exempted requester denied")
+	}
+}
@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+)
+
+// FindingState is the state of a finding
+type FindingState string
+
+const (
+	// ActiveFinding is a finding whose object has been requested with the
+	// deprecated API within the inactivity window
+	ActiveFinding FindingState = "Active"
+	// StaleFinding is a finding whose object hasn't been requested with the
+	// deprecated API within the inactivity window
+	StaleFinding FindingState = "Stale"
+	// ResolvedFinding is a finding whose object has been deleted, or is no
+	// longer managed with the deprecated API
+	ResolvedFinding FindingState = "Resolved"
+)
+
+// lastSeenResolution limits the updates of the report for the requests of
+// an active finding
+const lastSeenResolution = time.Hour
+
+// Lifecycle configures the transitions of the findings
+type Lifecycle struct {
+	// InactivityWindow is the time after which an active finding becomes
+	// stale
+	InactivityWindow time.Duration
+	// ResolvedRetention is the time after which a resolved finding is
+	// removed from the report
+	ResolvedRetention time.Duration
+}
+
+// touch marks the finding of pendingApi as active and seen now. It tells if
+// the finding was stale or resolved, and if the report changed.
+func touch(apiReport []DeprecatedObjectList, pendingApi DeprecatedObjectList, now metav1.Time) (reactivated, changed bool) {
+	pending := pendingApi.Objects[0]
+	for i, objList := range apiReport {
+		if objList.Group != pendingApi.Group || objList.Version != pendingApi.Version || objList.Kind != pendingApi.Kind {
+			continue
+		}
+		for j := range objList.Objects {
+			obj := &apiReport[i].Objects[j]
+			if obj.Name != pending.Name || obj.Namespace != pending.Namespace {
+				continue
+			}
+			if obj.State != ActiveFinding {
+				reactivated = obj.State != ""
+				obj.State = ActiveFinding
+				obj.ResolvedAt = nil
+				changed = true
+			}
+			if obj.FirstSeen == nil {
+				obj.FirstSeen = &now
+				changed = true
+			}
+			if obj.LastSeen == nil || now.Sub(obj.LastSeen.Time) >= lastSeenResolution {
+				obj.LastSeen = &now
+				changed = true
+			}
+		}
+	}
+	return reactivated, changed
+}
+
+// UpdateLifecycle moves the findings of the report through their states: the
+// findings whose object is gone or no longer managed with the deprecated API
+// are resolved, the active findings not seen within the inactivity window
+// become stale, and the resolved findings are removed after the retention.
+// The objects are read with reader, and their kind is mapped with mapper. The
+// deprecated fields of the findings are evaluated again with the policy.
+func UpdateLifecycle(ctx context.Context, c client.Client, reader client.Reader, mapper meta.RESTMapper, p *policy.Policy, namespace string, lifecycle Lifecycle) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ReportName}, cm); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		var apiSlice []DeprecatedObjectList
+		if err := utilyaml.Unmarshal([]byte(cm.Data[ReportKey]), &apiSlice); err != nil {
+			return err
+		}
+
+		now := metav1.Now()
+		changed := false
+		var report []DeprecatedObjectList
+		for _, objList := range apiSlice {
+			var objects []DeprecatedObject
+			for _, obj := range objList.Objects {
+				updated, err := nextState(ctx, reader, mapper, p, objList, obj, lifecycle, now)
+				if err != nil {
+					return err
+				}
+				if updated == nil {
+					klog.Infof("Pruning resolved finding %s %s/%s", objList.Kind, obj.Namespace, obj.Name)
+					changed = true
+					continue
+				}
+				if updated.State != obj.State || updated.FirstSeen != obj.FirstSeen || updated.LastSeen != obj.LastSeen {
+					changed = true
+				}
+				objects = append(objects, *updated)
+			}
+			if len(objects) != 0 {
+				objList.Objects = objects
+				report = append(report, objList)
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		rawData, err := utilyaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		cm.Data[ReportKey] = string(rawData)
+		return c.Update(ctx, cm)
+	})
+}
+
+// nextState returns the finding with its new state, or nil when it must be
+// pruned
+func nextState(ctx context.Context, reader client.Reader, mapper meta.RESTMapper, p *policy.Policy, objList DeprecatedObjectList, obj DeprecatedObject, lifecycle Lifecycle, now metav1.Time) (*DeprecatedObject, error) {
+	// Findings recorded before the lifecycle are active from now on
+	if obj.State == "" {
+		obj.State = ActiveFinding
+	}
+	if obj.FirstSeen == nil {
+		obj.FirstSeen = &now
+	}
+	if obj.LastSeen == nil {
+		obj.LastSeen = &now
+	}
+
+	if obj.State == ResolvedFinding {
+		if obj.ResolvedAt != nil && lifecycle.ResolvedRetention > 0 && now.Sub(obj.ResolvedAt.Time) >= lifecycle.ResolvedRetention {
+			return nil, nil
+		}
+		return &obj, nil
+	}
+
+	resolved, err := isResolved(ctx, reader, mapper, p, objList, obj)
+	if err != nil {
+		return nil, err
+	}
+	if resolved {
+		obj.State = ResolvedFinding
+		obj.ResolvedAt = &now
+		return &obj, nil
+	}
+
+	if lifecycle.InactivityWindow > 0 && now.Sub(obj.LastSeen.Time) >= lifecycle.InactivityWindow {
+		obj.State = StaleFinding
+	}
+	return &obj, nil
+}
+
+// isResolved tells if the object of a finding is deleted, or if none of its
+// managers use the deprecated API anymore and none of its deprecated fields
+// are set. A finding matching custom rules is only resolved by the deletion of
+// its object.
+func isResolved(ctx context.Context, reader client.Reader, mapper meta.RESTMapper, p *policy.Policy, objList DeprecatedObjectList, obj DeprecatedObject) (bool, error) {
+	// The deprecated version may no longer be served, the object is read
+	// with the preferred version of its kind
+	mapping, err := restMapping(mapper, p, objList)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			// The kind is no longer served and has no known replacement,
+			// whether its objects are gone is unknown: the finding becomes
+			// stale instead
+			klog.Infof("Can't map %s %s/%s: %v", objList.Kind, obj.Namespace, obj.Name, err)
+			return false, nil
+		}
+		return false, err
+	}
+	if len(obj.Fields) != 0 {
+		set, err := hasFields(ctx, reader, mapper, p, objList, obj)
+		if err != nil || set {
+			return false, err
+		}
+		// The object was only recorded for its fields
+		if _, found := catalog.Lookup(p.Catalog, objList.Group, objList.Version, mapping.Resource.Resource); !found && len(obj.Rules) == 0 {
+			return true, nil
+		}
+	}
+
+	metadata := &metav1.PartialObjectMetadata{}
+	metadata.SetGroupVersionKind(mapping.GroupVersionKind)
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: obj.Namespace, Name: obj.Name}, metadata); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		if errors.IsForbidden(err) {
+			klog.Infof("Can't read %s %s/%s: %v", objList.Kind, obj.Namespace, obj.Name, err)
+			return false, nil
+		}
+		return false, err
+	}
+
+	// The custom rules read the request, they can't be evaluated again and
+	// are resolved with the object only
+	if len(obj.Rules) != 0 {
+		return false, nil
+	}
+
+	// Without managed fields, the version used by the managers is unknown
+	if len(metadata.ManagedFields) == 0 {
+		return false, nil
+	}
+	apiVersion := schema.GroupVersion{Group: objList.Group, Version: objList.Version}.String()
+	for _, entry := range metadata.ManagedFields {
+		if entry.APIVersion == apiVersion {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// hasFields tells if deprecated fields are still set in the object of a
+// finding. The object is read with the recorded version when it is still
+// served, with the preferred version otherwise. A deleted object has none.
+func hasFields(ctx context.Context, reader client.Reader, mapper meta.RESTMapper, p *policy.Policy, objList DeprecatedObjectList, obj DeprecatedObject) (bool, error) {
+	groupKind := schema.GroupKind{Group: objList.Group, Kind: objList.Kind}
+	mapping, err := mapper.RESTMapping(groupKind, objList.Version)
+	if err != nil {
+		if mapping, err = restMapping(mapper, p, objList); err != nil {
+			return false, err
+		}
+	}
+
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(mapping.GroupVersionKind)
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: obj.Namespace, Name: obj.Name}, object); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		if errors.IsForbidden(err) {
+			klog.Infof("Can't read %s %s/%s: %v", objList.Kind, obj.Namespace, obj.Name, err)
+			return true, nil
+		}
+		return false, err
+	}
+	fields := catalog.FieldsFor(p.Fields, mapping.Resource.Group, mapping.Resource.Version, mapping.Resource.Resource)
+	return len(catalog.FindFields(fields, object.Object)) != 0, nil
+}
+
+// restMapping maps the kind of a finding to its preferred version. A kind no
+// longer served in its group, like the ingresses of the extensions group
+// after an upgrade, is mapped in the group of its replacement in the catalog.
+func restMapping(mapper meta.RESTMapper, p *policy.Policy, objList DeprecatedObjectList) (*meta.RESTMapping, error) {
+	mapping, err := mapper.RESTMapping(schema.GroupKind{Group: objList.Group, Kind: objList.Kind})
+	if err == nil || !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+
+	resource, _ := meta.UnsafeGuessKindToResource(schema.GroupVersionKind{Group: objList.Group, Version: objList.Version, Kind: objList.Kind})
+	api, found := catalog.Lookup(p.Catalog, objList.Group, objList.Version, resource.Resource)
+	if !found || api.ReplacedBy == "" {
+		return nil, err
+	}
+	replacement, parseErr := schema.ParseGroupVersion(api.ReplacedBy)
+	if parseErr != nil || replacement.Group == objList.Group {
+		return nil, err
+	}
+	return mapper.RESTMapping(schema.GroupKind{Group: replacement.Group, Kind: objList.Kind}, replacement.Version)
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+)
+
+func TestRestMapping(t *testing.T) {
+	networking := schema.GroupVersion{Group: "networking.k8s.io", Version: "v1"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{networking})
+	mapper.Add(networking.WithKind("Ingress"), meta.RESTScopeNamespace)
+
+	p := &policy.Policy{Catalog: []operatorv1alpha1.DeprecatedAPI{
+		{Group: "extensions", Version: "v1beta1", Resource: "ingresses", ReplacedBy: "networking.k8s.io/v1"},
+	}}
+
+	mapping, err := restMapping(mapper, p, DeprecatedObjectList{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"})
+	if err != nil || mapping.GroupVersionKind != networking.WithKind("Ingress") {
+		t.Errorf("a served kind must be mapped to its preferred version, got %v, %v", mapping, err)
+	}
+
+	mapping, err = restMapping(mapper, p, DeprecatedObjectList{Group: "extensions", Version: "v1beta1", Kind: "Ingress"})
+	if err != nil || mapping.GroupVersionKind != networking.WithKind("Ingress") {
+		t.Errorf("a kind no longer served must be mapped to its replacement, got %v, %v", mapping, err)
+	}
+
+	_, err = restMapping(mapper, p, DeprecatedObjectList{Group: "extensions", Version: "v1beta1", Kind: "PodSecurityPolicy"})
+	if !meta.IsNoMatchError(err) {
+		t.Errorf("a kind without replacement can't be mapped, got %v", err)
+	}
+}
+
+func TestIsResolvedUnknownKind(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	objList := DeprecatedObjectList{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}
+	resolved, err := isResolved(context.Background(), nil, mapper, &policy.Policy{}, objList, DeprecatedObject{Namespace: "team-a", Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved {
+		t.Error("a finding whose kind isn't served anymore must not be resolved")
+	}
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+const (
+	// teamReportPrefix prefixes the names of the config maps holding the
+	// report of a team
+	teamReportPrefix = ReportName + "-team-"
+	// TeamReportLabel marks the config maps holding the report of a team
+	TeamReportLabel = "operator.horis233.com/team-report"
+	// TeamAnnotation is the team of a team report
+	TeamAnnotation = "operator.horis233.com/team"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// RequesterOwner is the team owning a requester
+type RequesterOwner struct {
+	Requester string `json:"requester"`
+	Owner     string `json:"owner"`
+	// Source is the object and the key the owner was found with
+	Source string `json:"source"`
+}
+
+// ownerKeys returns the annotation and label keys set on the Depremon objects
+// of the operator namespace, or the default ones
+func (r *Recorder) ownerKeys(ctx context.Context, operatorNs string) []string {
+	depremons := &operatorv1alpha1.DepremonList{}
+	if err := r.Client.List(ctx, depremons, client.InNamespace(operatorNs)); err != nil {
+		klog.Error(err)
+	}
+	for _, depremon := range depremons.Items {
+		if len(depremon.Spec.OwnerKeys) != 0 {
+			return depremon.Spec.OwnerKeys
+		}
+	}
+	return operatorv1alpha1.DefaultOwnerKeys
+}
+
+// ownerFor looks for the keys in the annotations, then in the labels, of each
+// object in order. The first value found is the owner.
+func ownerFor(keys []string, objects ...client.Object) (owner, source string) {
+	for _, obj := range objects {
+		if obj == nil {
+			continue
+		}
+		for _, key := range keys {
+			value, found := obj.GetAnnotations()[key]
+			if !found {
+				value, found = obj.GetLabels()[key]
+			}
+			if found && value != "" {
+				kind := obj.GetObjectKind().GroupVersionKind().Kind
+				name := obj.GetName()
+				if obj.GetNamespace() != "" {
+					name = obj.GetNamespace() + "/" + name
+				}
+				return value, kind + " " + name + " " + key
+			}
+		}
+	}
+	return "", ""
+}
+
+// TeamReport filters the report on the requesters owned by a team
+func TeamReport(apiSlice []DeprecatedObjectList, team string) []DeprecatedObjectList {
+	var report []DeprecatedObjectList
+	for _, objList := range apiSlice {
+		teamList := DeprecatedObjectList{
+			Group:   objList.Group,
+			Version: objList.Version,
+			Kind:    objList.Kind,
+		}
+		for _, obj := range objList.Objects {
+			requesters := make(map[string]bool)
+			for _, owner := range obj.Owners {
+				if owner.Owner == team {
+					requesters[owner.Requester] = true
+				}
+			}
+			if len(requesters) == 0 {
+				continue
+			}
+
+			teamList.Objects = append(teamList.Objects, filterRequesters(obj, requesters))
+		}
+		if len(teamList.Objects) != 0 {
+			report = append(report, teamList)
+		}
+	}
+	return report
+}
+
+// Teams returns the sorted owners of the report
+func Teams(apiSlice []DeprecatedObjectList) []string {
+	seen := make(map[string]bool)
+	var teams []string
+	for _, objList := range apiSlice {
+		for _, obj := range objList.Objects {
+			for _, owner := range obj.Owners {
+				if !seen[owner.Owner] {
+					seen[owner.Owner] = true
+					teams = append(teams, owner.Owner)
+				}
+			}
+		}
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// teamReportName returns the name of the config map of a team report. Teams
+// are free text: the name ends with a hash of the team, so that it is valid
+// and unique even when the team has no valid character or differs only by
+// case or punctuation from another team.
+func teamReportName(team string) string {
+	sum := sha256.Sum256([]byte(team))
+	hash := hex.EncodeToString(sum[:4])
+
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(team), "-")
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	name = strings.Trim(name, "-")
+	if name == "" {
+		return teamReportPrefix + hash
+	}
+	return teamReportPrefix + name + "-" + hash
+}
+
+// UpdateTeamReports writes a config map with the report of each team, and
+// deletes the ones of the teams no longer in the report. The report of a team
+// which can't be written is skipped, so it doesn't block the other reports.
+func UpdateTeamReports(ctx context.Context, c client.Client, namespace string, apiSlice []DeprecatedObjectList) error {
+	current := make(map[string]bool)
+	for _, team := range Teams(apiSlice) {
+		name := teamReportName(team)
+		current[name] = true
+		if err := updateTeamReport(ctx, c, namespace, name, team, TeamReport(apiSlice, team)); err != nil {
+			klog.Errorf("failed to write the report of team %q: %v", team, err)
+		}
+	}
+
+	list := &corev1.ConfigMapList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels{TeamReportLabel: "true"}); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		if current[list.Items[i].Name] {
+			continue
+		}
+		if err := c.Delete(ctx, &list.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateTeamReport writes the config map of a team report
+func updateTeamReport(ctx context.Context, c client.Client, namespace, name, team string, report []DeprecatedObjectList) error {
+	rawData, err := utilyaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, c, cm, func() error {
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[TeamReportLabel] = "true"
+		if cm.Annotations == nil {
+			cm.Annotations = map[string]string{}
+		}
+		cm.Annotations[TeamAnnotation] = team
+		cm.Data = map[string]string{ReportKey: string(rawData)}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestTeamReportName(t *testing.T) {
+	names := make(map[string]string)
+	for _, team := range []string{"payments", "Team A", "team-a", "team a", "日本", "@@", "-", strings.Repeat("x", 300)} {
+		name := teamReportName(team)
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+			t.Errorf("the report name %q of team %q is invalid: %v", name, team, errs)
+		}
+		if other, found := names[name]; found {
+			t.Errorf("teams %q and %q have the same report name %q", team, other, name)
+		}
+		names[name] = team
+		if teamReportName(team) != name {
+			t.Errorf("the report name of team %q changed", team)
+		}
+	}
+	if name := teamReportName("payments"); !strings.HasPrefix(name, teamReportPrefix+"payments-") {
+		t.Errorf("the report name %q must contain the team", name)
+	}
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NamespaceReportName is the name of the config map holding the report
+	// of a namespace, in that namespace
+	NamespaceReportName = "deprecated-api-namespace-report"
+	// NamespaceReportLabel marks the config maps holding the report of a
+	// namespace
+	NamespaceReportLabel = "operator.horis233.com/namespace-report"
+	// OtherNamespacesRequester replaces the service accounts of the other
+	// namespaces in the report of a namespace
+	OtherNamespacesRequester = "<other namespaces>"
+)
+
+// NamespaceReport filters the report on a namespace: the objects of the
+// namespace with their requesters, and the other objects with the requesters
+// of the namespace only. The service accounts of the other namespaces
+// requesting the objects of the namespace are replaced by
+// OtherNamespacesRequester, without their details.
+func NamespaceReport(apiSlice []DeprecatedObjectList, namespace string) []DeprecatedObjectList {
+	var report []DeprecatedObjectList
+	for _, objList := range apiSlice {
+		nsList := DeprecatedObjectList{
+			Group:   objList.Group,
+			Version: objList.Version,
+			Kind:    objList.Kind,
+		}
+		for _, obj := range objList.Objects {
+			requesters := make(map[string]bool)
+			others := false
+			for _, requester := range obj.RequesterList {
+				switch requesterNs := requesterNamespace(requester); {
+				case requesterNs == namespace:
+					requesters[requester] = true
+				case obj.Namespace != namespace:
+				case requesterNs == "":
+					// the users outside of the namespaces
+					requesters[requester] = true
+				default:
+					others = true
+				}
+			}
+			if obj.Namespace != namespace && len(requesters) == 0 {
+				continue
+			}
+			filtered := filterRequesters(obj, requesters)
+			if others {
+				filtered.RequesterList = append(filtered.RequesterList, OtherNamespacesRequester)
+			}
+			nsList.Objects = append(nsList.Objects, filtered)
+		}
+		if len(nsList.Objects) != 0 {
+			report = append(report, nsList)
+		}
+	}
+	return report
+}
+
+// Namespaces returns the namespaces with findings: the namespaces of the
+// objects and of the service accounts requesting them
+func Namespaces(apiSlice []DeprecatedObjectList) map[string]bool {
+	namespaces := make(map[string]bool)
+	for _, objList := range apiSlice {
+		for _, obj := range objList.Objects {
+			if obj.Namespace != "" {
+				namespaces[obj.Namespace] = true
+			}
+			for _, requester := range obj.RequesterList {
+				if requesterNs := requesterNamespace(requester); requesterNs != "" {
+					namespaces[requesterNs] = true
+				}
+			}
+		}
+	}
+	return namespaces
+}
+
+// requesterNamespace returns the namespace of a "namespace/serviceaccount"
+// requester, and an empty string for the other users
+func requesterNamespace(requester string) string {
+	parts := strings.SplitN(requester, "/", 2)
+	if len(parts) != 2 || len(validation.IsDNS1123Label(parts[0])) != 0 {
+		return ""
+	}
+	return parts[0]
+}
+
+// filterRequesters keeps the given requesters of obj, with their details
+func filterRequesters(obj DeprecatedObject, requesters map[string]bool) DeprecatedObject {
+	filtered := DeprecatedObject{
+		Name:       obj.Name,
+		Namespace:  obj.Namespace,
+		State:      obj.State,
+		FirstSeen:  obj.FirstSeen,
+		LastSeen:   obj.LastSeen,
+		ResolvedAt: obj.ResolvedAt,
+	}
+	for _, requester := range obj.RequesterList {
+		if requesters[requester] {
+			filtered.RequesterList = append(filtered.RequesterList, requester)
+		}
+	}
+	for _, w := range obj.Workloads {
+		if requesters[w.Requester] {
+			filtered.Workloads = append(filtered.Workloads, w)
+		}
+	}
+	for _, c := range obj.Clients {
+		if requesters[c.Requester] {
+			filtered.Clients = append(filtered.Clients, c)
+		}
+	}
+	for _, owner := range obj.Owners {
+		if requesters[owner.Requester] {
+			filtered.Owners = append(filtered.Owners, owner)
+		}
+	}
+	for _, field := range obj.Fields {
+		if requesters[field.Requester] {
+			filtered.Fields = append(filtered.Fields, field)
+		}
+	}
+	for _, rule := range obj.Rules {
+		if requesters[rule.Requester] {
+			filtered.Rules = append(filtered.Rules, rule)
+		}
+	}
+	return filtered
+}
+
+// UpdateNamespaceReports writes the report of each namespace with findings in
+// that namespace, and deletes the reports of the namespaces without findings.
+// The client can be cached on the operator namespace only, so the config maps
+// are read with reader.
+func UpdateNamespaceReports(ctx context.Context, c client.Client, reader client.Reader, apiSlice []DeprecatedObjectList) error {
+	namespaces := Namespaces(apiSlice)
+	for namespace := range namespaces {
+		rawData, err := utilyaml.Marshal(NamespaceReport(apiSlice, namespace))
+		if err != nil {
+			return err
+		}
+		data := map[string]string{ReportKey: string(rawData)}
+
+		cm := &corev1.ConfigMap{}
+		err = reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: NamespaceReportName}, cm)
+		if errors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      NamespaceReportName,
+					Namespace: namespace,
+					Labels:    map[string]string{NamespaceReportLabel: "true"},
+				},
+				Data: data,
+			}
+			if err := c.Create(ctx, cm); err != nil {
+				if errors.IsNotFound(err) {
+					// The namespace is being deleted
+					continue
+				}
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Labels[NamespaceReportLabel] == "true" && cm.Data[ReportKey] == data[ReportKey] {
+			continue
+		}
+
+		klog.Infof("Updating deprecated api report of namespace %s", namespace)
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[NamespaceReportLabel] = "true"
+		cm.Data = data
+		if err := c.Update(ctx, cm); err != nil {
+			return err
+		}
+	}
+
+	list := &corev1.ConfigMapList{}
+	if err := reader.List(ctx, list, client.MatchingLabels{NamespaceReportLabel: "true"}); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		if namespaces[list.Items[i].Namespace] {
+			continue
+		}
+		if err := c.Delete(ctx, &list.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
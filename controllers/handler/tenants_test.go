@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespaceReport(t *testing.T) {
+	apiSlice := []DeprecatedObjectList{{
+		Group:   "networking.k8s.io",
+		Version: "v1beta1",
+		Kind:    "Ingress",
+		Objects: []DeprecatedObject{
+			{
+				Name:          "shop",
+				Namespace:     "shop",
+				RequesterList: []string{"shop/deployer", "ci/pipeline", "kubernetes-admin"},
+				Workloads: []RequesterWorkload{
+					{Requester: "shop/deployer", Description: "deployment deployer in ns shop"},
+					{Requester: "ci/pipeline", Description: "deployment pipeline in ns ci"},
+				},
+				Clients: []RequesterClient{{Requester: "ci/pipeline"}},
+				Owners: []RequesterOwner{
+					{Requester: "shop/deployer", Owner: "shop-team"},
+					{Requester: "ci/pipeline", Owner: "ci-team"},
+				},
+			},
+			{
+				Name:          "blog",
+				Namespace:     "blog",
+				RequesterList: []string{"shop/deployer", "blog/editor"},
+				Owners:        []RequesterOwner{{Requester: "blog/editor", Owner: "blog-team"}},
+			},
+			{
+				Name:          "wiki",
+				Namespace:     "wiki",
+				RequesterList: []string{"wiki/editor"},
+			},
+		},
+	}}
+
+	expected := []DeprecatedObjectList{{
+		Group:   "networking.k8s.io",
+		Version: "v1beta1",
+		Kind:    "Ingress",
+		Objects: []DeprecatedObject{
+			{
+				Name:          "shop",
+				Namespace:     "shop",
+				RequesterList: []string{"shop/deployer", "kubernetes-admin", OtherNamespacesRequester},
+				Workloads:     []RequesterWorkload{{Requester: "shop/deployer", Description: "deployment deployer in ns shop"}},
+				Owners:        []RequesterOwner{{Requester: "shop/deployer", Owner: "shop-team"}},
+			},
+			{
+				Name:          "blog",
+				Namespace:     "blog",
+				RequesterList: []string{"shop/deployer"},
+			},
+		},
+	}}
+	if report := NamespaceReport(apiSlice, "shop"); !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report of namespace shop %+v", report)
+	}
+
+	// a namespace sees the objects of the other namespaces requested by its
+	// own service accounts, without their other requesters
+	expected = []DeprecatedObjectList{{
+		Group:   "networking.k8s.io",
+		Version: "v1beta1",
+		Kind:    "Ingress",
+		Objects: []DeprecatedObject{{
+			Name:          "shop",
+			Namespace:     "shop",
+			RequesterList: []string{"ci/pipeline"},
+			Workloads:     []RequesterWorkload{{Requester: "ci/pipeline", Description: "deployment pipeline in ns ci"}},
+			Clients:       []RequesterClient{{Requester: "ci/pipeline"}},
+			Owners:        []RequesterOwner{{Requester: "ci/pipeline", Owner: "ci-team"}},
+		}},
+	}}
+	if report := NamespaceReport(apiSlice, "ci"); !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report of namespace ci %+v", report)
+	}
+
+	expected = []DeprecatedObjectList{{
+		Group:   "networking.k8s.io",
+		Version: "v1beta1",
+		Kind:    "Ingress",
+		Objects: []DeprecatedObject{{Name: "wiki", Namespace: "wiki", RequesterList: []string{"wiki/editor"}}},
+	}}
+	if report := NamespaceReport(apiSlice, "wiki"); !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report of namespace wiki %+v", report)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	apiSlice := []DeprecatedObjectList{{
+		Kind: "ClusterRole",
+		Objects: []DeprecatedObject{
+			{Name: "admin", RequesterList: []string{"ci/pipeline", "kubernetes-admin", "system:serviceaccount:kube-system:default"}},
+		},
+	}, {
+		Kind:    "Ingress",
+		Objects: []DeprecatedObject{{Name: "shop", Namespace: "shop", RequesterList: []string{"kubernetes-admin"}}},
+	}}
+	expected := map[string]bool{"ci": true, "shop": true}
+	if namespaces := Namespaces(apiSlice); !reflect.DeepEqual(namespaces, expected) {
+		t.Errorf("unexpected namespaces %v", namespaces)
+	}
+}
@@ -0,0 +1,223 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+const (
+	// batchSize is the number of custom resources migrated on each step
+	batchSize = 100
+	// BatchDelay is the delay before migrating the next batch, the writes
+	// are already rate limited by the QPS of the migration
+	BatchDelay = time.Second
+)
+
+// Migrator rewrites the custom resources stored in old versions, so they are
+// encoded in the storage version of their custom resource definition
+type Migrator struct {
+	Client client.Client
+	// Reader lists the custom resources of the whole cluster
+	Reader client.Reader
+
+	limiter flowcontrol.RateLimiter
+	qps     int32
+}
+
+// NeedsMigration returns the stored versions of a custom resource definition
+// other than its storage version, when one of them is deprecated or no longer
+// served, and the storage version
+func NeedsMigration(crd *apiextensionsv1.CustomResourceDefinition) ([]string, string) {
+	storage := ""
+	obsolete := make(map[string]bool)
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			storage = v.Name
+		}
+		obsolete[v.Name] = v.Deprecated || !v.Served
+	}
+	if storage == "" {
+		return nil, ""
+	}
+
+	var old []string
+	migrate := false
+	for _, v := range crd.Status.StoredVersions {
+		if v == storage {
+			continue
+		}
+		old = append(old, v)
+		if deprecated, listed := obsolete[v]; !listed || deprecated {
+			migrate = true
+		}
+	}
+	if !migrate {
+		return nil, storage
+	}
+	return old, storage
+}
+
+// Migrate runs a step of the migrations of the custom resource definitions
+// selected by spec: it updates the migrations, and migrates a batch of custom
+// resources of the first running one. Failed and forbidden migrations are
+// resumed when resume is set. It tells if custom resources remain to be migrated.
+func (m *Migrator) Migrate(ctx context.Context, spec operatorv1alpha1.StorageMigrationSpec, migrations []operatorv1alpha1.StorageMigrationStatus, resume bool) ([]operatorv1alpha1.StorageMigrationStatus, bool, error) {
+	list := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := m.Client.List(ctx, list); err != nil {
+		return migrations, false, err
+	}
+	selected := make(map[string]bool)
+	for _, name := range spec.CRDs {
+		selected[name] = true
+	}
+
+	crds := make(map[string]*apiextensionsv1.CustomResourceDefinition)
+	var updated []operatorv1alpha1.StorageMigrationStatus
+	for i := range list.Items {
+		crd := &list.Items[i]
+		if len(selected) != 0 && !selected[crd.Name] {
+			continue
+		}
+		crds[crd.Name] = crd
+		migration := find(migrations, crd.Name)
+		storedVersions, storageVersion := NeedsMigration(crd)
+		switch {
+		case len(storedVersions) != 0 && (migration == nil || migration.Phase == operatorv1alpha1.MigrationSucceeded ||
+			migration.StorageVersion != storageVersion):
+			now := metav1.Now()
+			klog.Infof("Migrating the custom resources of %s from %v to %s", crd.Name, storedVersions, storageVersion)
+			migration = &operatorv1alpha1.StorageMigrationStatus{
+				CRD:            crd.Name,
+				StoredVersions: storedVersions,
+				StorageVersion: storageVersion,
+				Phase:          operatorv1alpha1.MigrationRunning,
+				StartTime:      &now,
+			}
+		case len(storedVersions) == 0 && migration != nil && migration.Phase != operatorv1alpha1.MigrationSucceeded:
+			// status.storedVersions was updated by someone else
+			now := metav1.Now()
+			migration.Phase = operatorv1alpha1.MigrationSucceeded
+			migration.Continue = ""
+			migration.CompletionTime = &now
+		}
+		if migration != nil {
+			updated = append(updated, *migration)
+		}
+	}
+
+	for i := range updated {
+		migration := &updated[i]
+		if migration.Phase == operatorv1alpha1.MigrationSucceeded ||
+			(migration.Phase == operatorv1alpha1.MigrationFailed || migration.Phase == operatorv1alpha1.MigrationForbidden) && !resume {
+			continue
+		}
+		m.setQPS(spec.QPS)
+		if err := m.step(ctx, crds[migration.CRD], migration); errors.IsForbidden(err) {
+			klog.Errorf("Missing permission to migrate the custom resources of %s: %v", migration.CRD, err)
+			migration.Phase = operatorv1alpha1.MigrationForbidden
+			migration.Message = fmt.Sprintf("missing permission to list and update the custom resources, bind the depremon-migrator ClusterRole to the operator: %v", err)
+			return updated, false, nil
+		} else if err != nil {
+			klog.Errorf("Failed to migrate the custom resources of %s: %v", migration.CRD, err)
+			migration.Phase = operatorv1alpha1.MigrationFailed
+			migration.Message = err.Error()
+			return updated, false, nil
+		}
+		return updated, migration.Phase == operatorv1alpha1.MigrationRunning, nil
+	}
+	return updated, false, nil
+}
+
+// step rewrites a batch of custom resources, then removes the old versions
+// from status.storedVersions once they are all rewritten
+func (m *Migrator) step(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, migration *operatorv1alpha1.StorageMigrationStatus) error {
+	migration.Phase = operatorv1alpha1.MigrationRunning
+	migration.Message = ""
+
+	listKind := crd.Spec.Names.ListKind
+	if listKind == "" {
+		listKind = crd.Spec.Names.Kind + "List"
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{Group: crd.Spec.Group, Version: migration.StorageVersion, Kind: listKind})
+	if err := m.Reader.List(ctx, list, client.Limit(batchSize), client.Continue(migration.Continue)); err != nil {
+		if errors.IsResourceExpired(err) {
+			// Rewriting a custom resource again is harmless, start over
+			klog.Infof("Restarting the migration of %s: %v", crd.Name, err)
+			migration.Continue = ""
+			return nil
+		}
+		return err
+	}
+
+	for i := range list.Items {
+		m.limiter.Accept()
+		// An update without changes is enough, the apiserver encodes the
+		// custom resource in the storage version
+		if err := m.Client.Update(ctx, &list.Items[i]); err != nil {
+			// A custom resource changed since it was listed is already
+			// stored in the storage version
+			if errors.IsNotFound(err) || errors.IsConflict(err) {
+				continue
+			}
+			return fmt.Errorf("can't update %s %s/%s: %w", crd.Spec.Names.Kind, list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+		}
+		migration.Migrated++
+	}
+	migration.Continue = list.GetContinue()
+	if migration.Continue != "" {
+		return nil
+	}
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := m.Client.Get(ctx, client.ObjectKey{Name: crd.Name}, crd); err != nil {
+			return err
+		}
+		if _, storageVersion := NeedsMigration(crd); storageVersion != migration.StorageVersion {
+			return fmt.Errorf("storage version changed to %s during the migration", storageVersion)
+		}
+		crd.Status.StoredVersions = []string{migration.StorageVersion}
+		return m.Client.Status().Update(ctx, crd)
+	}); err != nil {
+		return err
+	}
+	klog.Infof("Migrated %d custom resources of %s to %s", migration.Migrated, crd.Name, migration.StorageVersion)
+	now := metav1.Now()
+	migration.Phase = operatorv1alpha1.MigrationSucceeded
+	migration.CompletionTime = &now
+	return nil
+}
+
+func (m *Migrator) setQPS(qps int32) {
+	if qps == 0 {
+		qps = operatorv1alpha1.DefaultMigrationQPS
+	}
+	if m.limiter != nil && m.qps == qps {
+		return
+	}
+	m.limiter = flowcontrol.NewTokenBucketRateLimiter(float32(qps), 1)
+	m.qps = qps
+}
+
+func find(migrations []operatorv1alpha1.StorageMigrationStatus, crd string) *operatorv1alpha1.StorageMigrationStatus {
+	for i := range migrations {
+		if migrations[i].CRD == crd {
+			migration := migrations[i]
+			return &migration
+		}
+	}
+	return nil
+}
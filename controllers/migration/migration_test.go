@@ -0,0 +1,349 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func version(name string, served, storage, deprecated bool) apiextensionsv1.CustomResourceDefinitionVersion {
+	return apiextensionsv1.CustomResourceDefinitionVersion{Name: name, Served: served, Storage: storage, Deprecated: deprecated}
+}
+
+func crd(stored []string, versions ...apiextensionsv1.CustomResourceDefinitionVersion) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "crontabs.stable.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    "stable.example.com",
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "crontabs", Kind: "CronTab", ListKind: "CronTabList"},
+			Scope:    apiextensionsv1.NamespaceScoped,
+			Versions: versions,
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: stored},
+	}
+}
+
+func TestNeedsMigration(t *testing.T) {
+	tests := []struct {
+		name    string
+		crd     *apiextensionsv1.CustomResourceDefinition
+		old     []string
+		storage string
+	}{
+		{
+			name:    "only the storage version is stored",
+			crd:     crd([]string{"v1"}, version("v1beta1", true, false, true), version("v1", true, true, false)),
+			storage: "v1",
+		},
+		{
+			name:    "a deprecated version is stored",
+			crd:     crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, true), version("v1", true, true, false)),
+			old:     []string{"v1beta1"},
+			storage: "v1",
+		},
+		{
+			name:    "a version no longer served is stored",
+			crd:     crd([]string{"v1beta1", "v1"}, version("v1beta1", false, false, false), version("v1", true, true, false)),
+			old:     []string{"v1beta1"},
+			storage: "v1",
+		},
+		{
+			name:    "a version removed from the definition is stored",
+			crd:     crd([]string{"v1alpha1", "v1"}, version("v1", true, true, false)),
+			old:     []string{"v1alpha1"},
+			storage: "v1",
+		},
+		{
+			name:    "a version still served is stored",
+			crd:     crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, false), version("v1", true, true, false)),
+			storage: "v1",
+		},
+		{
+			name: "no storage version",
+			crd:  crd([]string{"v1beta1"}, version("v1beta1", true, false, true)),
+		},
+	}
+	for _, test := range tests {
+		old, storage := NeedsMigration(test.crd)
+		if !reflect.DeepEqual(old, test.old) || storage != test.storage {
+			t.Errorf("%s: NeedsMigration() = %v, %q, expected %v, %q", test.name, old, storage, test.old, test.storage)
+		}
+	}
+}
+
+var cronTab = schema.GroupVersionKind{Group: "stable.example.com", Version: "v1", Kind: "CronTab"}
+
+// pagedReader lists the custom resources by pages, like the apiserver, which
+// the fake client doesn't. The continue token is the index of the next
+// custom resource, and the List calls listed in failures fail.
+type pagedReader struct {
+	client.Reader
+	calls    int
+	failures map[int]bool
+}
+
+func (r *pagedReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	r.calls++
+	if r.failures[r.calls] {
+		return fmt.Errorf("the server is currently unable to handle the request")
+	}
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	start := 0
+	if listOpts.Continue != "" {
+		var err error
+		if start, err = strconv.Atoi(listOpts.Continue); err != nil {
+			return errors.NewResourceExpired("the provided continue parameter is too old")
+		}
+	}
+
+	if err := r.Reader.List(ctx, list); err != nil {
+		return err
+	}
+	items := list.(*unstructured.UnstructuredList)
+	sort.Slice(items.Items, func(i, j int) bool { return items.Items[i].GetName() < items.Items[j].GetName() })
+	end := start + int(listOpts.Limit)
+	items.SetContinue(strconv.Itoa(end))
+	if end >= len(items.Items) {
+		end = len(items.Items)
+		items.SetContinue("")
+	}
+	items.Items = items.Items[start:end]
+	return nil
+}
+
+func newMigrator(t *testing.T, crd *apiextensionsv1.CustomResourceDefinition, count int) (*Migrator, *pagedReader) {
+	scheme := runtime.NewScheme()
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypeWithName(cronTab, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(cronTab.GroupVersion().WithKind("CronTabList"), &unstructured.UnstructuredList{})
+
+	objects := []client.Object{crd}
+	for i := 0; i < count; i++ {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(cronTab)
+		obj.SetNamespace("default")
+		obj.SetName(fmt.Sprintf("crontab-%03d", i))
+		objects = append(objects, obj)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	reader := &pagedReader{Reader: c}
+	return &Migrator{Client: c, Reader: reader}, reader
+}
+
+func storedVersions(t *testing.T, m *Migrator) []string {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.Client.Get(context.Background(), client.ObjectKey{Name: "crontabs.stable.example.com"}, crd); err != nil {
+		t.Fatal(err)
+	}
+	return crd.Status.StoredVersions
+}
+
+var spec = operatorv1alpha1.StorageMigrationSpec{Enabled: true, QPS: 10000}
+
+func TestMigrate(t *testing.T) {
+	m, _ := newMigrator(t, crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, true), version("v1", true, true, false)), 250)
+	ctx := context.Background()
+
+	var migrations []operatorv1alpha1.StorageMigrationStatus
+	var tokens []string
+	for migrating := true; migrating; {
+		var err error
+		migrations, migrating, err = m.Migrate(ctx, spec, migrations, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != 1 {
+			t.Fatalf("expected one migration, got %v", migrations)
+		}
+		tokens = append(tokens, migrations[0].Continue)
+	}
+
+	if !reflect.DeepEqual(tokens, []string{"100", "200", ""}) {
+		t.Errorf("continue tokens are %v, expected a batch of 100 per step", tokens)
+	}
+	migration := migrations[0]
+	if migration.Phase != operatorv1alpha1.MigrationSucceeded || migration.Migrated != 250 || migration.CompletionTime == nil {
+		t.Errorf("unexpected migration %+v", migration)
+	}
+	if !reflect.DeepEqual(migration.StoredVersions, []string{"v1beta1"}) || migration.StorageVersion != "v1" {
+		t.Errorf("migration from %v to %s, expected from [v1beta1] to v1", migration.StoredVersions, migration.StorageVersion)
+	}
+	if stored := storedVersions(t, m); !reflect.DeepEqual(stored, []string{"v1"}) {
+		t.Errorf("stored versions are %v, expected [v1]", stored)
+	}
+
+	// a succeeded migration is left alone
+	migrations, migrating, err := m.Migrate(ctx, spec, migrations, true)
+	if err != nil || migrating || migrations[0].Migrated != 250 {
+		t.Errorf("a succeeded migration must not run again: %+v %t %v", migrations, migrating, err)
+	}
+}
+
+func TestMigrateResumesAfterFailure(t *testing.T) {
+	m, reader := newMigrator(t, crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, true), version("v1", true, true, false)), 250)
+	reader.failures = map[int]bool{2: true}
+	ctx := context.Background()
+
+	migrations, migrating, err := m.Migrate(ctx, spec, nil, false)
+	if err != nil || !migrating || migrations[0].Continue != "100" {
+		t.Fatalf("unexpected first step %+v %t %v", migrations, migrating, err)
+	}
+
+	migrations, migrating, err = m.Migrate(ctx, spec, migrations, false)
+	if err != nil || migrating {
+		t.Fatalf("a failed step must stop the migration: %t %v", migrating, err)
+	}
+	if migrations[0].Phase != operatorv1alpha1.MigrationFailed || migrations[0].Message == "" {
+		t.Errorf("unexpected failed migration %+v", migrations[0])
+	}
+
+	// a failed migration waits for the next scan
+	calls := reader.calls
+	migrations, migrating, err = m.Migrate(ctx, spec, migrations, false)
+	if err != nil || migrating || reader.calls != calls || migrations[0].Phase != operatorv1alpha1.MigrationFailed {
+		t.Errorf("a failed migration must only be resumed on a scan: %+v %t %v", migrations[0], migrating, err)
+	}
+
+	// then resumes where it stopped
+	migrations, migrating, err = m.Migrate(ctx, spec, migrations, true)
+	if err != nil || !migrating {
+		t.Fatalf("the migration must resume: %t %v", migrating, err)
+	}
+	if migrations[0].Phase != operatorv1alpha1.MigrationRunning || migrations[0].Message != "" ||
+		migrations[0].Continue != "200" || migrations[0].Migrated != 200 {
+		t.Errorf("the migration must resume from the continue token: %+v", migrations[0])
+	}
+}
+
+func TestMigrateRestartsOnExpiredToken(t *testing.T) {
+	m, _ := newMigrator(t, crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, true), version("v1", true, true, false)), 150)
+	started := metav1.Now()
+	migrations := []operatorv1alpha1.StorageMigrationStatus{{
+		CRD:            "crontabs.stable.example.com",
+		StoredVersions: []string{"v1beta1"},
+		StorageVersion: "v1",
+		Phase:          operatorv1alpha1.MigrationRunning,
+		Migrated:       100,
+		Continue:       "expired",
+		StartTime:      &started,
+	}}
+
+	migrations, migrating, err := m.Migrate(context.Background(), spec, migrations, false)
+	if err != nil || !migrating {
+		t.Fatalf("the migration must go on: %t %v", migrating, err)
+	}
+	if migrations[0].Continue != "" || migrations[0].Phase != operatorv1alpha1.MigrationRunning || migrations[0].Migrated != 100 {
+		t.Errorf("the migration must start over: %+v", migrations[0])
+	}
+}
+
+func TestMigrateFollowsTheStorageVersion(t *testing.T) {
+	m, _ := newMigrator(t, crd([]string{"v1beta1", "v1"},
+		version("v1beta1", true, false, true), version("v1", true, false, true), version("v2", true, true, false)), 50)
+	started := metav1.NewTime(time.Now().Add(-time.Hour))
+	migrations := []operatorv1alpha1.StorageMigrationStatus{{
+		CRD:            "crontabs.stable.example.com",
+		StoredVersions: []string{"v1beta1"},
+		StorageVersion: "v1",
+		Phase:          operatorv1alpha1.MigrationRunning,
+		Migrated:       40,
+		Continue:       "40",
+		StartTime:      &started,
+	}}
+
+	// the custom resources are listed in the storage version, which isn't
+	// registered: only check the migration started over before listing them
+	migrations, _, _ = m.Migrate(context.Background(), spec, migrations, false)
+	migration := migrations[0]
+	if migration.StorageVersion != "v2" || !reflect.DeepEqual(migration.StoredVersions, []string{"v1beta1", "v1"}) {
+		t.Errorf("the migration must restart to v2 from v1beta1 and v1: %+v", migration)
+	}
+	if migration.Migrated != 0 || !migration.StartTime.After(started.Time) {
+		t.Errorf("the migration must start over: %+v", migration)
+	}
+}
+
+func TestMigrateFailsWhenTheStorageVersionChanges(t *testing.T) {
+	m, _ := newMigrator(t, crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, true), version("v1", true, true, false)), 10)
+	ctx := context.Background()
+
+	// the storage version changes while the last batch is migrated
+	current := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: "crontabs.stable.example.com"}, current); err != nil {
+		t.Fatal(err)
+	}
+	changed := crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, true), version("v1", true, false, false), version("v2", true, true, false))
+	changed.ResourceVersion = current.ResourceVersion
+	if err := m.Client.Update(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	migration := &operatorv1alpha1.StorageMigrationStatus{
+		CRD:            "crontabs.stable.example.com",
+		StoredVersions: []string{"v1beta1"},
+		StorageVersion: "v1",
+		Phase:          operatorv1alpha1.MigrationRunning,
+	}
+	m.setQPS(spec.QPS)
+	if err := m.step(ctx, current, migration); err == nil {
+		t.Fatal("the migration must fail when the storage version changes")
+	}
+	if stored := storedVersions(t, m); !reflect.DeepEqual(stored, []string{"v1beta1", "v1"}) {
+		t.Errorf("stored versions changed to %v", stored)
+	}
+}
+
+// forbiddenReader is a reader without the permission to list the custom
+// resources
+type forbiddenReader struct {
+	client.Reader
+}
+
+func (r forbiddenReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return errors.NewForbidden(schema.GroupResource{Group: "stable.example.com", Resource: "crontabs"}, "",
+		fmt.Errorf("User \"system:serviceaccount:depremon:depremon-controller-manager\" cannot list resource \"crontabs\""))
+}
+
+func TestMigrateReportsMissingPermission(t *testing.T) {
+	m, reader := newMigrator(t, crd([]string{"v1beta1", "v1"}, version("v1beta1", true, false, true), version("v1", true, true, false)), 10)
+	m.Reader = forbiddenReader{reader}
+	ctx := context.Background()
+
+	migrations, migrating, err := m.Migrate(ctx, spec, nil, false)
+	if err != nil || migrating {
+		t.Fatalf("a forbidden step must stop the migration: %t %v", migrating, err)
+	}
+	if migrations[0].Phase != operatorv1alpha1.MigrationForbidden || !strings.Contains(migrations[0].Message, "depremon-migrator") {
+		t.Errorf("unexpected forbidden migration %+v", migrations[0])
+	}
+
+	// the migration resumes on the next scan once the permission is granted
+	m.Reader = reader
+	migrations, _, err = m.Migrate(ctx, spec, migrations, false)
+	if err != nil || migrations[0].Phase != operatorv1alpha1.MigrationForbidden {
+		t.Errorf("a forbidden migration must only be resumed on a scan: %+v %v", migrations[0], err)
+	}
+	migrations, _, err = m.Migrate(ctx, spec, migrations, true)
+	if err != nil || migrations[0].Phase != operatorv1alpha1.MigrationSucceeded || migrations[0].Migrated != 10 {
+		t.Errorf("the migration must resume once granted: %+v %v", migrations[0], err)
+	}
+}
@@ -0,0 +1,304 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+const (
+	// queueSize is the number of findings waiting to be sent. New findings
+	// are dropped when the queue is full, so the webhook is never blocked.
+	queueSize = 100
+	// maxDigestFindings bounds the findings kept for a daily digest
+	maxDigestFindings = 1000
+	// digestCheckInterval is the interval the digest hour is checked at
+	digestCheckInterval = time.Minute
+)
+
+// defaultTemplate renders the messages of the sinks without a template
+const defaultTemplate = `{{ .Title }}
+{{- range .Findings }}
+- {{ .Message }}
+{{- end }}
+`
+
+// Finding is a deprecated API used by a requester for an object
+type Finding struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Requester string `json:"requester"`
+	// Workloads running with the service account of the requester
+	Workloads []string `json:"workloads,omitempty"`
+	// Owner is the team owning the requester
+	Owner   string    `json:"owner,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// dedupKey identifies the findings of a requester for an API, so a
+// controller using the API for many objects is only reported once
+func (f Finding) dedupKey() string {
+	return f.Requester + "/" + f.Group + "/" + f.Version + "/" + f.Kind
+}
+
+// Message is sent to the sinks, and is the data of their templates
+type Message struct {
+	Event    operatorv1alpha1.NotificationEvent `json:"event"`
+	Title    string                             `json:"title"`
+	Findings []Finding                          `json:"findings"`
+	// Text is the message rendered by the template of the sink
+	Text string `json:"text"`
+}
+
+// Notifier sends the findings to the sinks configured on the Depremon objects
+// of the operator namespace. It runs with the manager.
+type Notifier struct {
+	// Client reads the secrets of the sinks
+	Client client.Client
+	// Namespace of the operator, where the secrets of the sinks are
+	Namespace string
+
+	queue chan Finding
+	lock  sync.Mutex
+	sinks map[string]*sinkState
+}
+
+// sinkState is a configured sink, with the findings it has sent and the ones
+// waiting for the digest
+type sinkState struct {
+	spec       operatorv1alpha1.NotificationSink
+	template   *template.Template
+	sent       map[string]time.Time
+	digest     []Finding
+	lastDigest time.Time
+}
+
+// New creates a Notifier without sinks
+func New(c client.Client, namespace string) *Notifier {
+	return &Notifier{
+		Client:    c,
+		Namespace: namespace,
+		queue:     make(chan Finding, queueSize),
+		sinks:     map[string]*sinkState{},
+	}
+}
+
+// Configure replaces the sinks. The state of a sink whose spec didn't change
+// is kept, so its findings aren't sent again.
+func (n *Notifier) Configure(sinks []operatorv1alpha1.NotificationSink) error {
+	states := make(map[string]*sinkState)
+	for _, spec := range sinks {
+		if _, found := states[spec.Name]; found {
+			klog.Warningf("Notification sink %s is defined more than once, keeping the first one", spec.Name)
+			continue
+		}
+
+		n.lock.Lock()
+		current, found := n.sinks[spec.Name]
+		n.lock.Unlock()
+		if found && reflect.DeepEqual(current.spec, spec) {
+			states[spec.Name] = current
+			continue
+		}
+
+		text := spec.Template
+		if text == "" {
+			text = defaultTemplate
+		}
+		tmpl, err := template.New(spec.Name).Parse(text)
+		if err != nil {
+			return err
+		}
+		states[spec.Name] = &sinkState{
+			spec:       spec,
+			template:   tmpl,
+			sent:       map[string]time.Time{},
+			lastDigest: time.Now(),
+		}
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.sinks = states
+	return nil
+}
+
+// Notify queues a new finding. It doesn't block, the finding is dropped when
+// the queue is full.
+func (n *Notifier) Notify(finding Finding) {
+	select {
+	case n.queue <- finding:
+	default:
+		klog.Warningf("Notification queue is full, dropping finding of %s", finding.Requester)
+	}
+}
+
+// Start sends the queued findings and the daily digests until ctx is done
+func (n *Notifier) Start(ctx context.Context) error {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case finding := <-n.queue:
+			n.sendFinding(ctx, finding)
+		case now := <-ticker.C:
+			n.sendDigests(ctx, now)
+		}
+	}
+}
+
+// sendFinding sends a finding to the sinks subscribed to NewFinding, unless
+// it has been sent within their dedup window, and keeps it for the digests
+func (n *Notifier) sendFinding(ctx context.Context, finding Finding) {
+	for _, state := range n.list() {
+		if !owned(state.spec, finding) {
+			continue
+		}
+		if subscribed(state.spec, operatorv1alpha1.DailyDigestEvent) {
+			n.lock.Lock()
+			if len(state.digest) < maxDigestFindings {
+				state.digest = append(state.digest, finding)
+			}
+			n.lock.Unlock()
+		}
+
+		if !subscribed(state.spec, operatorv1alpha1.NewFindingEvent) || n.duplicate(state, finding) {
+			continue
+		}
+		msg := Message{
+			Event:    operatorv1alpha1.NewFindingEvent,
+			Title:    "New deprecated API usage",
+			Findings: []Finding{finding},
+		}
+		if err := n.send(ctx, state, msg); err != nil {
+			klog.Errorf("Failed to notify sink %s: %v", state.spec.Name, err)
+			continue
+		}
+		n.markSent(state, finding)
+	}
+}
+
+// duplicate tells if the finding has been sent to the sink within its dedup
+// window
+func (n *Notifier) duplicate(state *sinkState, finding Finding) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	window := operatorv1alpha1.DefaultDedupWindow
+	if state.spec.DedupWindow != nil {
+		window = state.spec.DedupWindow.Duration
+	}
+	for key, sent := range state.sent {
+		if finding.Time.Sub(sent) >= window {
+			delete(state.sent, key)
+		}
+	}
+	_, found := state.sent[finding.dedupKey()]
+	return found
+}
+
+// markSent remembers the finding was delivered to the sink, a finding which
+// couldn't be delivered is sent again on its next occurrence
+func (n *Notifier) markSent(state *sinkState, finding Finding) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	state.sent[finding.dedupKey()] = finding.Time
+}
+
+// sendDigests sends the findings kept for the sinks whose digest hour is now,
+// once a day
+func (n *Notifier) sendDigests(ctx context.Context, now time.Time) {
+	for _, state := range n.list() {
+		if !subscribed(state.spec, operatorv1alpha1.DailyDigestEvent) {
+			continue
+		}
+		n.lock.Lock()
+		due := int32(now.UTC().Hour()) == state.spec.DigestHour && now.Sub(state.lastDigest) > 23*time.Hour
+		findings := state.digest
+		if due {
+			state.digest = nil
+			state.lastDigest = now
+		}
+		n.lock.Unlock()
+		if !due || len(findings) == 0 {
+			continue
+		}
+
+		msg := Message{
+			Event:    operatorv1alpha1.DailyDigestEvent,
+			Title:    "Deprecated API usages of the last 24 hours",
+			Findings: findings,
+		}
+		if err := n.send(ctx, state, msg); err != nil {
+			klog.Errorf("Failed to send the digest to sink %s: %v", state.spec.Name, err)
+		}
+	}
+}
+
+// send renders the message with the template of the sink and delivers it
+func (n *Notifier) send(ctx context.Context, state *sinkState, msg Message) error {
+	var text bytes.Buffer
+	if err := state.template.Execute(&text, msg); err != nil {
+		return err
+	}
+	msg.Text = text.String()
+
+	klog.Infof("Sending %s to sink %s", msg.Event, state.spec.Name)
+	return n.deliver(ctx, state.spec, msg)
+}
+
+// list returns the sinks sorted by name
+func (n *Notifier) list() []*sinkState {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	states := make([]*sinkState, 0, len(n.sinks))
+	for _, state := range n.sinks {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].spec.Name < states[j].spec.Name
+	})
+	return states
+}
+
+// owned tells if the sink receives the findings of the owner of finding
+func owned(spec operatorv1alpha1.NotificationSink, finding Finding) bool {
+	if len(spec.Owners) == 0 {
+		return true
+	}
+	for _, owner := range spec.Owners {
+		if owner == finding.Owner {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribed(spec operatorv1alpha1.NotificationSink, event operatorv1alpha1.NotificationEvent) bool {
+	if len(spec.Events) == 0 {
+		return event == operatorv1alpha1.NewFindingEvent
+	}
+	for _, e := range spec.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func finding(requester string, at time.Time) Finding {
+	return Finding{
+		Group:     "networking.k8s.io",
+		Version:   "v1beta1",
+		Kind:      "Ingress",
+		Name:      "web",
+		Namespace: "team-a",
+		Requester: requester,
+		Owner:     "team-a",
+		Message:   "networking.k8s.io/v1beta1 ingresses is deprecated",
+		Time:      at,
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	n := New(nil, "depremon")
+	state := &sinkState{
+		spec: operatorv1alpha1.NotificationSink{Name: "sink", DedupWindow: &metav1.Duration{Duration: time.Hour}},
+		sent: map[string]time.Time{},
+	}
+	now := time.Now()
+
+	if n.duplicate(state, finding("ci/deployer", now)) {
+		t.Error("a finding never sent isn't a duplicate")
+	}
+	// only the delivered findings are remembered
+	if n.duplicate(state, finding("ci/deployer", now)) {
+		t.Error("a finding which wasn't delivered isn't a duplicate")
+	}
+
+	n.markSent(state, finding("ci/deployer", now))
+	if !n.duplicate(state, finding("ci/deployer", now.Add(30*time.Minute))) {
+		t.Error("a finding sent within the window is a duplicate")
+	}
+	other := finding("ci/deployer", now.Add(30*time.Minute))
+	other.Name = "api"
+	if !n.duplicate(state, other) {
+		t.Error("the findings of a requester for an API are deduplicated across objects")
+	}
+	if n.duplicate(state, finding("ci/other", now.Add(30*time.Minute))) {
+		t.Error("the findings of another requester aren't duplicates")
+	}
+	if n.duplicate(state, finding("ci/deployer", now.Add(time.Hour))) {
+		t.Error("a finding sent before the window isn't a duplicate")
+	}
+	if len(state.sent) != 0 {
+		t.Errorf("the findings out of the window must be forgotten, got %v", state.sent)
+	}
+}
+
+func TestOwned(t *testing.T) {
+	f := finding("ci/deployer", time.Now())
+	if !owned(operatorv1alpha1.NotificationSink{}, f) {
+		t.Error("a sink without owners receives every finding")
+	}
+	if !owned(operatorv1alpha1.NotificationSink{Owners: []string{"team-b", "team-a"}}, f) {
+		t.Error("a sink receives the findings of its owners")
+	}
+	if owned(operatorv1alpha1.NotificationSink{Owners: []string{"team-b"}}, f) {
+		t.Error("a sink doesn't receive the findings of other owners")
+	}
+	f.Owner = ""
+	if owned(operatorv1alpha1.NotificationSink{Owners: []string{"team-b"}}, f) {
+		t.Error("a sink with owners doesn't receive the findings without owner")
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	tests := []struct {
+		events   []operatorv1alpha1.NotificationEvent
+		event    operatorv1alpha1.NotificationEvent
+		expected bool
+	}{
+		{nil, operatorv1alpha1.NewFindingEvent, true},
+		{nil, operatorv1alpha1.DailyDigestEvent, false},
+		{[]operatorv1alpha1.NotificationEvent{operatorv1alpha1.DailyDigestEvent}, operatorv1alpha1.NewFindingEvent, false},
+		{[]operatorv1alpha1.NotificationEvent{operatorv1alpha1.DailyDigestEvent}, operatorv1alpha1.DailyDigestEvent, true},
+		{[]operatorv1alpha1.NotificationEvent{operatorv1alpha1.NewFindingEvent, operatorv1alpha1.DailyDigestEvent}, operatorv1alpha1.NewFindingEvent, true},
+	}
+	for _, test := range tests {
+		if subscribed(operatorv1alpha1.NotificationSink{Events: test.events}, test.event) != test.expected {
+			t.Errorf("subscribed(%v, %s) != %t", test.events, test.event, test.expected)
+		}
+	}
+}
+
+// sink records the messages posted to it, and answers with status
+type sink struct {
+	lock     sync.Mutex
+	status   int
+	messages []Message
+}
+
+func (s *sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		return
+	}
+	msg := Message{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.messages = append(s.messages, msg)
+}
+
+func (s *sink) setStatus(status int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status = status
+}
+
+func (s *sink) received() []Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+func newSink(t *testing.T, spec operatorv1alpha1.NotificationSink) (*Notifier, *sink) {
+	s := &sink{status: http.StatusOK}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	spec.Type = operatorv1alpha1.WebhookSink
+	spec.URL = server.URL
+	n := New(nil, "depremon")
+	if err := n.Configure([]operatorv1alpha1.NotificationSink{spec}); err != nil {
+		t.Fatal(err)
+	}
+	return n, s
+}
+
+func TestSendFindingRetriesFailedDeliveries(t *testing.T) {
+	n, s := newSink(t, operatorv1alpha1.NotificationSink{Name: "sink"})
+	ctx := context.Background()
+	now := time.Now()
+
+	// a rejected payload isn't retried, nor remembered as sent
+	s.setStatus(http.StatusBadRequest)
+	n.sendFinding(ctx, finding("ci/deployer", now))
+	if len(s.received()) != 0 {
+		t.Fatal("the sink rejected the finding")
+	}
+
+	s.setStatus(http.StatusOK)
+	n.sendFinding(ctx, finding("ci/deployer", now.Add(time.Minute)))
+	if len(s.received()) != 1 {
+		t.Fatal("a finding which wasn't delivered must be sent again")
+	}
+	n.sendFinding(ctx, finding("ci/deployer", now.Add(2*time.Minute)))
+	if len(s.received()) != 1 {
+		t.Error("a delivered finding must be deduplicated")
+	}
+}
+
+func TestSendDigests(t *testing.T) {
+	n, s := newSink(t, operatorv1alpha1.NotificationSink{
+		Name:       "digest",
+		Events:     []operatorv1alpha1.NotificationEvent{operatorv1alpha1.DailyDigestEvent},
+		DigestHour: 9,
+	})
+	ctx := context.Background()
+	morning := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	state := n.list()[0]
+	state.lastDigest = morning.Add(-24 * time.Hour)
+
+	// the findings are only kept for the digest
+	n.sendFinding(ctx, finding("ci/deployer", morning.Add(-time.Hour)))
+	n.sendFinding(ctx, finding("ci/other", morning.Add(-time.Hour)))
+	if len(s.received()) != 0 {
+		t.Fatal("a digest sink doesn't receive the new findings")
+	}
+
+	n.sendDigests(ctx, morning.Add(-time.Minute))
+	if len(s.received()) != 0 {
+		t.Fatal("the digest must wait for its hour")
+	}
+
+	n.sendDigests(ctx, morning)
+	messages := s.received()
+	if len(messages) != 1 || messages[0].Event != operatorv1alpha1.DailyDigestEvent || len(messages[0].Findings) != 2 {
+		t.Fatalf("expected a digest of the two findings, got %+v", messages)
+	}
+
+	// a single digest is sent during the digest hour
+	n.sendFinding(ctx, finding("ci/deployer", morning.Add(time.Minute)))
+	n.sendDigests(ctx, morning.Add(time.Minute))
+	if len(s.received()) != 1 {
+		t.Error("the digest must be sent once a day")
+	}
+
+	n.sendDigests(ctx, morning.Add(24*time.Hour))
+	messages = s.received()
+	if len(messages) != 2 || len(messages[1].Findings) != 1 {
+		t.Errorf("expected the digest of the next day with one finding, got %+v", messages)
+	}
+
+	// an empty digest isn't sent
+	n.sendDigests(ctx, morning.Add(48*time.Hour))
+	if len(s.received()) != 2 {
+		t.Error("an empty digest must not be sent")
+	}
+}
+
+func TestSendMailTimesOut(t *testing.T) {
+	// the server accepts the connection but never greets the client
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- sendMail(ctx, listener.Addr().String(), "127.0.0.1", nil, "depremon@example.com", []string{"team@example.com"}, []byte("body"))
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("sending to an unresponsive server must fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sending to an unresponsive server must time out with its context")
+	}
+}
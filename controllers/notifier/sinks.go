@@ -0,0 +1,233 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+const (
+	// cloudEventSource is the source of the CloudEvents sent by depremon
+	cloudEventSource = "/apis/operator.horis233.com/depremon"
+	// requestTimeout bounds each attempt to deliver a message
+	requestTimeout = 10 * time.Second
+)
+
+// backoff of the retries to deliver a message, about 15 seconds in total
+var backoff = wait.Backoff{
+	Steps:    5,
+	Duration: time.Second,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
+// permanentError is an error that retrying won't fix, e.g. a rejected payload
+type permanentError struct {
+	error
+}
+
+func retriable(err error) bool {
+	_, permanent := err.(permanentError)
+	return !permanent
+}
+
+// deliver sends the message to the sink, retrying the transient failures
+func (n *Notifier) deliver(ctx context.Context, spec operatorv1alpha1.NotificationSink, msg Message) error {
+	return retry.OnError(backoff, retriable, func() error {
+		if ctx.Err() != nil {
+			return permanentError{ctx.Err()}
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+
+		switch spec.Type {
+		case operatorv1alpha1.SMTPSink:
+			return n.sendMail(attemptCtx, spec, msg)
+		case operatorv1alpha1.SlackSink:
+			return n.post(attemptCtx, spec, "application/json", map[string]string{
+				"text": msg.Text,
+			})
+		case operatorv1alpha1.TeamsSink:
+			return n.post(attemptCtx, spec, "application/json", map[string]string{
+				"@type":    "MessageCard",
+				"@context": "https://schema.org/extensions",
+				"summary":  msg.Title,
+				"title":    msg.Title,
+				"text":     msg.Text,
+			})
+		case operatorv1alpha1.CloudEventsSink:
+			return n.post(attemptCtx, spec, "application/cloudevents+json", map[string]interface{}{
+				"specversion":     "1.0",
+				"id":              string(uuid.NewUUID()),
+				"source":          cloudEventSource,
+				"type":            "com.horis233.depremon." + strings.ToLower(string(msg.Event)),
+				"time":            time.Now().UTC().Format(time.RFC3339),
+				"datacontenttype": "application/json",
+				"data":            msg,
+			})
+		default:
+			return n.post(attemptCtx, spec, "application/json", msg)
+		}
+	})
+}
+
+// post sends the payload as JSON to the URL of the sink
+func (n *Notifier) post(ctx context.Context, spec operatorv1alpha1.NotificationSink, contentType string, payload interface{}) error {
+	url, err := n.urlFor(ctx, spec)
+	if err != nil {
+		return permanentError{err}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return permanentError{err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("sink %s returned %s", spec.Name, resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanentError{err}
+}
+
+// urlFor returns the URL of the sink, read from its secret when it's set
+func (n *Notifier) urlFor(ctx context.Context, spec operatorv1alpha1.NotificationSink) (string, error) {
+	if spec.URLSecretRef == nil {
+		return spec.URL, nil
+	}
+	value, err := n.secretValue(ctx, spec.URLSecretRef.Name, spec.URLSecretRef.Key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// sendMail sends the message as a plain text email
+func (n *Notifier) sendMail(ctx context.Context, spec operatorv1alpha1.NotificationSink, msg Message) error {
+	config := spec.SMTP
+	if config == nil {
+		return permanentError{fmt.Errorf("sink %s has no SMTP settings", spec.Name)}
+	}
+	port := config.Port
+	if port == 0 {
+		port = operatorv1alpha1.DefaultSMTPPort
+	}
+
+	var auth smtp.Auth
+	if config.CredentialsSecretRef != nil {
+		username, err := n.secretValue(ctx, config.CredentialsSecretRef.Name, corev1.BasicAuthUsernameKey)
+		if err != nil {
+			return permanentError{err}
+		}
+		password, err := n.secretValue(ctx, config.CredentialsSecretRef.Name, corev1.BasicAuthPasswordKey)
+		if err != nil {
+			return permanentError{err}
+		}
+		auth = smtp.PlainAuth("", username, password, config.Host)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", config.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&body, "Subject: [depremon] %s\r\n", msg.Title)
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(int(port)))
+	return sendMail(ctx, addr, config.Host, auth, config.From, config.To, body.Bytes())
+}
+
+// sendMail is smtp.SendMail bounded by ctx: the connection is dialed with ctx
+// and expires with it, so an unresponsive server can't block the notifier
+func sendMail(ctx context.Context, addr, host string, auth smtp.Auth, from string, to []string, body []byte) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return permanentError{fmt.Errorf("SMTP server %s doesn't support authentication", addr)}
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := c.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// secretValue reads a key of a secret of the operator namespace
+func (n *Notifier) secretValue(ctx context.Context, name, key string) (string, error) {
+	secret := &corev1.Secret{}
+	if err := n.Client.Get(ctx, client.ObjectKey{Namespace: n.Namespace, Name: name}, secret); err != nil {
+		return "", err
+	}
+	value, found := secret.Data[key]
+	if !found {
+		return "", fmt.Errorf("secret %s does not contain key %s", name, key)
+	}
+	return string(value), nil
+}
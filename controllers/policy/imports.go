@@ -0,0 +1,161 @@
+package policy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+// importedCatalog is a parsed catalog, with the version of its source: the
+// resource version of the config map or the modification time and size of
+// the file
+type importedCatalog struct {
+	version string
+	apis    []operatorv1alpha1.DeprecatedAPI
+	err     error
+}
+
+// imported caches the catalogs by source, they are parsed again when their
+// source changes
+var imported = struct {
+	sync.Mutex
+	catalogs map[string]importedCatalog
+}{catalogs: make(map[string]importedCatalog)}
+
+// importCatalogs returns the entries of the imported catalogs, the later ones
+// replace the entries of the earlier ones. A catalog which can't be read or
+// parsed is skipped, the error is logged once per version of its source. The
+// config maps are read in namespace.
+func importCatalogs(ctx context.Context, reader client.Reader, namespace string, imports []operatorv1alpha1.CatalogImport) []operatorv1alpha1.DeprecatedAPI {
+	var apis []operatorv1alpha1.DeprecatedAPI
+	for _, source := range imports {
+		key, version, read := catalogSource(ctx, reader, namespace, source)
+		cacheKey := string(source.Format) + " " + key
+
+		imported.Lock()
+		cached, found := imported.catalogs[cacheKey]
+		if !found || cached.version != version {
+			cached = importedCatalog{version: version}
+			cached.apis, cached.err = parseCatalog(source.Format, read)
+			if cached.err != nil {
+				klog.Errorf("failed to import the %s catalog from %s: %v", source.Format, key, cached.err)
+			}
+			imported.catalogs[cacheKey] = cached
+		}
+		imported.Unlock()
+
+		apis = catalog.Merge(apis, cached.apis)
+	}
+	return apis
+}
+
+// completeFrom returns the imported entries, with the fields their format
+// doesn't provide, like the scope, taken from the base entries they replace
+func completeFrom(apis, base []operatorv1alpha1.DeprecatedAPI) []operatorv1alpha1.DeprecatedAPI {
+	completed := make([]operatorv1alpha1.DeprecatedAPI, 0, len(apis))
+	for _, api := range apis {
+		if replaced, found := catalog.Lookup(base, api.Group, api.Version, api.Resource); found {
+			if api.Scope == "" {
+				api.Scope = replaced.Scope
+			}
+			if api.RemovedIn == "" {
+				api.RemovedIn = replaced.RemovedIn
+			}
+			if api.ReplacedBy == "" {
+				api.ReplacedBy = replaced.ReplacedBy
+			}
+			if api.ReplacementIntroducedIn == "" {
+				api.ReplacementIntroducedIn = replaced.ReplacementIntroducedIn
+			}
+		}
+		completed = append(completed, api)
+	}
+	return completed
+}
+
+// catalogSource returns the key and the version of the source of an imported
+// catalog, and how to read it. Errors accessing the source are returned by
+// read, and used as the version.
+func catalogSource(ctx context.Context, reader client.Reader, namespace string, source operatorv1alpha1.CatalogImport) (string, string, func() ([]byte, error)) {
+	switch {
+	case source.File != "" && source.ConfigMap != nil:
+		err := fmt.Errorf("only one of file and configMap can be set")
+		return "file " + source.File, err.Error(), func() ([]byte, error) { return nil, err }
+
+	case source.File != "":
+		key := "file " + source.File
+		info, err := os.Stat(source.File)
+		if err != nil {
+			return key, err.Error(), func() ([]byte, error) { return nil, err }
+		}
+		return key, fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size()), func() ([]byte, error) {
+			return ioutil.ReadFile(source.File)
+		}
+
+	case source.ConfigMap != nil:
+		key := "config map " + namespace + "/" + source.ConfigMap.Name + " key " + source.ConfigMap.Key
+		cm := &corev1.ConfigMap{}
+		if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.ConfigMap.Name}, cm); err != nil {
+			if errors.IsNotFound(err) && source.ConfigMap.Optional != nil && *source.ConfigMap.Optional {
+				return key, "", func() ([]byte, error) { return nil, nil }
+			}
+			return key, err.Error(), func() ([]byte, error) { return nil, err }
+		}
+		return key, cm.ResourceVersion, func() ([]byte, error) {
+			if data, found := cm.BinaryData[source.ConfigMap.Key]; found {
+				return data, nil
+			}
+			if data, found := cm.Data[source.ConfigMap.Key]; found {
+				return []byte(data), nil
+			}
+			if source.ConfigMap.Optional != nil && *source.ConfigMap.Optional {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("key %s not found", source.ConfigMap.Key)
+		}
+
+	default:
+		err := fmt.Errorf("one of file and configMap must be set")
+		return "", err.Error(), func() ([]byte, error) { return nil, err }
+	}
+}
+
+// parseCatalog reads and parses a catalog, which can be compressed with gzip:
+// the swagger.json of a release doesn't fit in a config map otherwise
+func parseCatalog(format operatorv1alpha1.CatalogFormat, read func() ([]byte, error)) ([]operatorv1alpha1.DeprecatedAPI, error) {
+	data, err := read()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case operatorv1alpha1.PlutoFormat:
+		return catalog.FromPluto(data)
+	case operatorv1alpha1.KubepugFormat:
+		return catalog.FromKubepug(data)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
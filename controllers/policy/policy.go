@@ -0,0 +1,215 @@
+package policy
+
+import (
+	"context"
+	"sync/atomic"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+// Policy is the effective configuration applied to a request using a
+// deprecated API. It is built from the ClusterDepremon objects and narrowed by
+// the Depremon objects.
+type Policy struct {
+	Catalog []operatorv1alpha1.DeprecatedAPI
+	Fields  []operatorv1alpha1.DeprecatedField
+	Rules   []operatorv1alpha1.CustomRule
+	// TenantRules are the rules of the Depremon objects of the namespace of
+	// the object, outside of the operator namespace. They are evaluated by
+	// the webhook of the tenant rules, the other webhook evaluates Rules.
+	TenantRules []operatorv1alpha1.CustomRule
+	Mode        operatorv1alpha1.EnforcementMode
+	Exemptions  []operatorv1alpha1.Exemption
+
+	// namespaces of the requesters to record, nil means all of them
+	namespaces map[string]bool
+}
+
+var modeStrictness = map[operatorv1alpha1.EnforcementMode]int{
+	operatorv1alpha1.RecordMode: 0,
+	operatorv1alpha1.WarnMode:   1,
+	operatorv1alpha1.DenyMode:   2,
+}
+
+// ForCluster builds the policy from all the ClusterDepremon objects. Catalogs,
+// fields and exemptions are merged, and the strictest mode wins. The catalog
+// also includes the discovered APIs, the ones probed in the Build mode, see
+// buildCatalog. The imported config maps are read in the operator namespace.
+func ForCluster(ctx context.Context, reader client.Reader, namespace string, discovered []operatorv1alpha1.DeprecatedAPI) (*Policy, error) {
+	list := &operatorv1alpha1.ClusterDepremonList{}
+	if err := reader.List(ctx, list); err != nil {
+		return nil, err
+	}
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := reader.List(ctx, crds); err != nil {
+		return nil, err
+	}
+
+	p := &Policy{
+		Catalog: buildCatalog(ctx, reader, namespace, list.Items, crds.Items, discovered),
+		Fields:  catalog.BuiltinFields(),
+		Mode:    operatorv1alpha1.RecordMode,
+	}
+	for _, cluster := range list.Items {
+		p.Fields = catalog.MergeFields(p.Fields, cluster.Spec.Fields)
+		p.Exemptions = append(p.Exemptions, cluster.Spec.Exemptions...)
+		if modeStrictness[cluster.Spec.Mode] > modeStrictness[p.Mode] {
+			p.Mode = cluster.Spec.Mode
+		}
+	}
+	return p, nil
+}
+
+// Configured returns the catalog configured in the cluster, without the APIs
+// discovered in the Build mode
+func Configured(ctx context.Context, reader client.Reader, namespace string) ([]operatorv1alpha1.DeprecatedAPI, error) {
+	list := &operatorv1alpha1.ClusterDepremonList{}
+	if err := reader.List(ctx, list); err != nil {
+		return nil, err
+	}
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := reader.List(ctx, crds); err != nil {
+		return nil, err
+	}
+	return buildCatalog(ctx, reader, namespace, list.Items, crds.Items, nil), nil
+}
+
+// buildCatalog merges the catalogs, the entries replace each other in this
+// order: the built-in catalog, the imported catalogs, the versions marked as
+// deprecated by the custom resource definitions, the discovered APIs, and the
+// ClusterDepremon catalogs.
+func buildCatalog(ctx context.Context, reader client.Reader, namespace string, clusters []operatorv1alpha1.ClusterDepremon,
+	crds []apiextensionsv1.CustomResourceDefinition, discovered []operatorv1alpha1.DeprecatedAPI) []operatorv1alpha1.DeprecatedAPI {
+	builtin := catalog.Builtin()
+	var imports []operatorv1alpha1.CatalogImport
+	for _, cluster := range clusters {
+		imports = append(imports, cluster.Spec.Imports...)
+	}
+
+	apis := catalog.Merge(builtin, completeFrom(importCatalogs(ctx, reader, namespace, imports), builtin), catalog.FromCRDs(crds), discovered)
+	for _, cluster := range clusters {
+		apis = catalog.Merge(apis, cluster.Spec.Catalog)
+	}
+	return apis
+}
+
+// ForNamespace narrows the policy of the cluster by the Depremon objects of
+// the operator namespace and of the namespace of the object. The reader is
+// expected to be cached on the Depremon objects of all the namespaces, it is
+// called for each admission request.
+func (p *Policy) ForNamespace(ctx context.Context, reader client.Reader, operatorNamespace, namespace string) (*Policy, error) {
+	namespaces := []string{operatorNamespace}
+	if namespace != "" && namespace != operatorNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	for _, ns := range namespaces {
+		list := &operatorv1alpha1.DepremonList{}
+		if err := reader.List(ctx, list, client.InNamespace(ns)); err != nil {
+			return nil, err
+		}
+		clusterRules := len(p.Rules)
+		for i := range list.Items {
+			p = p.Narrow(&list.Items[i])
+		}
+		if ns != operatorNamespace && len(list.Items) != 0 {
+			// p is a copy made by Narrow
+			p.TenantRules = p.Rules[clusterRules:]
+			p.Rules = p.Rules[:clusterRules:clusterRules]
+		}
+	}
+	return p, nil
+}
+
+// Shared is the policy of the cluster, built by the reconciler and read by the
+// webhook for each admission request
+type Shared struct {
+	current atomic.Value
+}
+
+// Store replaces the policy of the cluster
+func (s *Shared) Store(p *Policy) {
+	s.current.Store(p)
+}
+
+// Load returns the policy of the cluster, nil until it is first stored
+func (s *Shared) Load() *Policy {
+	if s == nil {
+		return nil
+	}
+	p, _ := s.current.Load().(*Policy)
+	return p
+}
+
+// Narrow returns a copy of the policy restricted by a Depremon. A Depremon can
+// add exemptions and custom rules, reduce the namespaces to record and make the
+// mode stricter, but it can't change the catalog nor weaken the mode.
+func (p *Policy) Narrow(instance *operatorv1alpha1.Depremon) *Policy {
+	mode := p.Mode
+	if modeStrictness[instance.Spec.Mode] > modeStrictness[mode] {
+		mode = instance.Spec.Mode
+	}
+
+	narrowed := &Policy{
+		Catalog:    p.Catalog,
+		Fields:     p.Fields,
+		Rules:      append(append([]operatorv1alpha1.CustomRule{}, p.Rules...), instance.Spec.Rules...),
+		Mode:       mode,
+		Exemptions: append(append([]operatorv1alpha1.Exemption{}, p.Exemptions...), instance.Spec.Exemptions...),
+		namespaces: p.namespaces,
+	}
+	if len(instance.Spec.Namespaces) == 0 {
+		return narrowed
+	}
+
+	namespaces := make(map[string]bool)
+	for _, ns := range instance.Spec.Namespaces {
+		if p.namespaces == nil || p.namespaces[ns] {
+			namespaces[ns] = true
+		}
+	}
+	narrowed.namespaces = namespaces
+	return narrowed
+}
+
+// Records tells if requests from the given requester namespace are recorded
+func (p *Policy) Records(requesterNamespace string) bool {
+	return p.namespaces == nil || p.namespaces[requesterNamespace]
+}
+
+// Exempted tells if a request is exempted. An exemption matches when the
+// object or the requester is in one of its namespaces, and the requester is
+// one of its requesters. Empty lists match everything, but an exemption with
+// both lists empty is ignored.
+func (p *Policy) Exempted(objectNamespace, requesterNamespace, requester string) bool {
+	for _, exemption := range p.Exemptions {
+		if len(exemption.Namespaces) == 0 && len(exemption.Requesters) == 0 {
+			continue
+		}
+		if len(exemption.Namespaces) != 0 &&
+			!contains(exemption.Namespaces, objectNamespace) &&
+			!contains(exemption.Namespaces, requesterNamespace) {
+			continue
+		}
+		if len(exemption.Requesters) != 0 && !contains(exemption.Requesters, requester) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,367 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+func depremon(namespace, name string, spec operatorv1alpha1.DepremonSpec) *operatorv1alpha1.Depremon {
+	return &operatorv1alpha1.Depremon{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       spec,
+	}
+}
+
+func TestNarrowMode(t *testing.T) {
+	tests := []struct {
+		cluster, depremon, expected operatorv1alpha1.EnforcementMode
+	}{
+		{operatorv1alpha1.RecordMode, "", operatorv1alpha1.RecordMode},
+		{operatorv1alpha1.RecordMode, operatorv1alpha1.WarnMode, operatorv1alpha1.WarnMode},
+		{operatorv1alpha1.WarnMode, operatorv1alpha1.DenyMode, operatorv1alpha1.DenyMode},
+		// a Depremon can't weaken the mode of the cluster
+		{operatorv1alpha1.DenyMode, operatorv1alpha1.RecordMode, operatorv1alpha1.DenyMode},
+		{operatorv1alpha1.WarnMode, operatorv1alpha1.RecordMode, operatorv1alpha1.WarnMode},
+	}
+	for _, test := range tests {
+		p := &Policy{Mode: test.cluster}
+		narrowed := p.Narrow(depremon("ns", "d", operatorv1alpha1.DepremonSpec{Mode: test.depremon}))
+		if narrowed.Mode != test.expected {
+			t.Errorf("%s narrowed by %s is %s, expected %s", test.cluster, test.depremon, narrowed.Mode, test.expected)
+		}
+	}
+}
+
+func TestNarrowKeepsThePolicy(t *testing.T) {
+	p := &Policy{
+		Catalog:    []operatorv1alpha1.DeprecatedAPI{{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies"}},
+		Rules:      []operatorv1alpha1.CustomRule{{Name: "cluster"}},
+		Exemptions: []operatorv1alpha1.Exemption{{Namespaces: []string{"kube-system"}}},
+		Mode:       operatorv1alpha1.RecordMode,
+	}
+	narrowed := p.Narrow(depremon("ns", "d", operatorv1alpha1.DepremonSpec{
+		Rules:      []operatorv1alpha1.CustomRule{{Name: "tenant"}},
+		Exemptions: []operatorv1alpha1.Exemption{{Requesters: []string{"admin"}}},
+	}))
+
+	if len(narrowed.Catalog) != 1 {
+		t.Errorf("catalog changed to %v", narrowed.Catalog)
+	}
+	if len(narrowed.Rules) != 2 || narrowed.Rules[1].Name != "tenant" {
+		t.Errorf("rules are %v, expected cluster and tenant", narrowed.Rules)
+	}
+	if len(narrowed.Exemptions) != 2 {
+		t.Errorf("exemptions are %v, expected both exemptions", narrowed.Exemptions)
+	}
+	// the policy being narrowed is left untouched
+	if len(p.Rules) != 1 || len(p.Exemptions) != 1 {
+		t.Errorf("narrowing changed the policy: %v %v", p.Rules, p.Exemptions)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	p := &Policy{}
+	if !p.Records("team-a") || !p.Records("") {
+		t.Error("a policy without namespaces must record every requester")
+	}
+
+	narrowed := p.Narrow(depremon("ns", "d", operatorv1alpha1.DepremonSpec{Namespaces: []string{"team-a", "team-b"}}))
+	if !narrowed.Records("team-a") || !narrowed.Records("team-b") {
+		t.Error("the namespaces of the Depremon must be recorded")
+	}
+	if narrowed.Records("team-c") || narrowed.Records("") {
+		t.Error("only the namespaces of the Depremon must be recorded")
+	}
+
+	// the namespaces can only be reduced
+	narrowed = narrowed.Narrow(depremon("ns", "e", operatorv1alpha1.DepremonSpec{Namespaces: []string{"team-b", "team-c"}}))
+	if narrowed.Records("team-a") || !narrowed.Records("team-b") || narrowed.Records("team-c") {
+		t.Error("the namespaces must be the intersection of the Depremon namespaces")
+	}
+}
+
+func TestExempted(t *testing.T) {
+	p := &Policy{Exemptions: []operatorv1alpha1.Exemption{
+		{},
+		{Namespaces: []string{"kube-system"}},
+		{Requesters: []string{"ci/deployer"}},
+		{Namespaces: []string{"team-a"}, Requesters: []string{"admin"}},
+	}}
+	tests := []struct {
+		objectNs, requesterNs, requester string
+		expected                         bool
+	}{
+		// objects and requesters of an exempted namespace
+		{"kube-system", "", "admin", true},
+		{"default", "kube-system", "kube-system/controller", true},
+		// exempted requesters in any namespace
+		{"default", "ci", "ci/deployer", true},
+		// both the namespace and the requester must match
+		{"team-a", "", "admin", true},
+		{"team-a", "", "developer", false},
+		{"team-b", "", "admin", false},
+		// the empty exemption is ignored
+		{"default", "", "developer", false},
+		// an empty namespace doesn't match
+		{"", "", "developer", false},
+	}
+	for _, test := range tests {
+		if exempted := p.Exempted(test.objectNs, test.requesterNs, test.requester); exempted != test.expected {
+			t.Errorf("Exempted(%q, %q, %q) = %t, expected %t", test.objectNs, test.requesterNs, test.requester, exempted, test.expected)
+		}
+	}
+}
+
+func TestForNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := operatorv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		depremon("depremon", "cluster", operatorv1alpha1.DepremonSpec{Mode: operatorv1alpha1.WarnMode}),
+		depremon("team-a", "tenant", operatorv1alpha1.DepremonSpec{Mode: operatorv1alpha1.DenyMode}),
+		depremon("team-b", "tenant", operatorv1alpha1.DepremonSpec{Exemptions: []operatorv1alpha1.Exemption{{Requesters: []string{"admin"}}}}),
+	).Build()
+
+	cluster := &Policy{Mode: operatorv1alpha1.RecordMode}
+	tests := []struct {
+		namespace  string
+		mode       operatorv1alpha1.EnforcementMode
+		exemptions int
+	}{
+		{"", operatorv1alpha1.WarnMode, 0},
+		{"depremon", operatorv1alpha1.WarnMode, 0},
+		{"team-a", operatorv1alpha1.DenyMode, 0},
+		{"team-b", operatorv1alpha1.WarnMode, 1},
+		{"team-c", operatorv1alpha1.WarnMode, 0},
+	}
+	for _, test := range tests {
+		p, err := cluster.ForNamespace(context.Background(), reader, "depremon", test.namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Mode != test.mode || len(p.Exemptions) != test.exemptions {
+			t.Errorf("policy of %q has mode %s and %d exemptions, expected %s and %d", test.namespace, p.Mode, len(p.Exemptions), test.mode, test.exemptions)
+		}
+	}
+	if cluster.Mode != operatorv1alpha1.RecordMode {
+		t.Error("the policy of the cluster must not change")
+	}
+}
+
+func TestForNamespaceTenantRules(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := operatorv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	clusterRule := operatorv1alpha1.CustomRule{Name: "cluster", Resource: "pods", Expression: "true"}
+	tenantRule := operatorv1alpha1.CustomRule{Name: "tenant", Resource: "pods", Expression: "true"}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		depremon("depremon", "cluster", operatorv1alpha1.DepremonSpec{Rules: []operatorv1alpha1.CustomRule{clusterRule}}),
+		depremon("team-a", "tenant", operatorv1alpha1.DepremonSpec{Rules: []operatorv1alpha1.CustomRule{tenantRule}}),
+	).Build()
+
+	cluster := &Policy{}
+	tests := []struct {
+		namespace   string
+		tenantRules int
+	}{
+		{"", 0},
+		{"depremon", 0},
+		{"team-a", 1},
+		{"team-b", 0},
+	}
+	for _, test := range tests {
+		p, err := cluster.ForNamespace(context.Background(), reader, "depremon", test.namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Rules) != 1 || p.Rules[0].Name != "cluster" {
+			t.Errorf("policy of %q has rules %v, expected the cluster rule", test.namespace, p.Rules)
+		}
+		if len(p.TenantRules) != test.tenantRules {
+			t.Errorf("policy of %q has tenant rules %v", test.namespace, p.TenantRules)
+		}
+	}
+}
+
+func TestShared(t *testing.T) {
+	var shared *Shared
+	if shared.Load() != nil {
+		t.Error("a nil shared policy must load nil")
+	}
+	shared = &Shared{}
+	if shared.Load() != nil {
+		t.Error("the policy must be nil until it is stored")
+	}
+	p := &Policy{Mode: operatorv1alpha1.DenyMode}
+	shared.Store(p)
+	if shared.Load() != p {
+		t.Error("the stored policy must be loaded")
+	}
+}
+
+func TestBuildCatalogPrecedence(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	// the catalog is imported from the operator namespace only
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: "pluto"},
+			Data: map[string]string{"versions.yaml": `deprecated-versions:
+- version: networking.k8s.io/v1beta1
+  kind: Ingress
+  removed-in: v1.23.0
+  replacement-api: networking.k8s.io/v1
+`},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "pluto"},
+			Data: map[string]string{"versions.yaml": `deprecated-versions:
+- version: networking.k8s.io/v1beta1
+  kind: Ingress
+  removed-in: v1.30.0
+`},
+		},
+	).Build()
+
+	imports := []operatorv1alpha1.CatalogImport{{
+		Format: operatorv1alpha1.PlutoFormat,
+		ConfigMap: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "pluto"},
+			Key:                  "versions.yaml",
+		},
+	}}
+	crd := apiextensionsv1.CustomResourceDefinition{Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+		Group: "networking.k8s.io",
+		Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "ingresses"},
+		Scope: apiextensionsv1.NamespaceScoped,
+		Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+			{Name: "v1beta1", Served: true, Deprecated: true},
+			{Name: "v2", Served: true, Storage: true},
+		},
+	}}
+	discovered := []operatorv1alpha1.DeprecatedAPI{
+		{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", RemovedIn: "v1.24", ReplacedBy: "networking.k8s.io/v1"},
+	}
+	cluster := operatorv1alpha1.ClusterDepremon{Spec: operatorv1alpha1.ClusterDepremonSpec{
+		Catalog: []operatorv1alpha1.DeprecatedAPI{
+			{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", RemovedIn: "v1.25", ReplacedBy: "networking.k8s.io/v1"},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		clusters   []operatorv1alpha1.ClusterDepremon
+		crds       []apiextensionsv1.CustomResourceDefinition
+		discovered []operatorv1alpha1.DeprecatedAPI
+		namespace  string
+		removedIn  string
+		replacedBy string
+	}{
+		{"builtin", nil, nil, nil, "depremon", "v1.22", "networking.k8s.io/v1"},
+		{"import", []operatorv1alpha1.ClusterDepremon{{Spec: operatorv1alpha1.ClusterDepremonSpec{Imports: imports}}},
+			nil, nil, "depremon", "v1.23", "networking.k8s.io/v1"},
+		{"import of another namespace", []operatorv1alpha1.ClusterDepremon{{Spec: operatorv1alpha1.ClusterDepremonSpec{Imports: imports}}},
+			nil, nil, "other", "v1.30", "networking.k8s.io/v1"},
+		{"custom resource definition", []operatorv1alpha1.ClusterDepremon{{Spec: operatorv1alpha1.ClusterDepremonSpec{Imports: imports}}},
+			[]apiextensionsv1.CustomResourceDefinition{crd}, nil, "depremon", "", "networking.k8s.io/v2"},
+		{"discovered", []operatorv1alpha1.ClusterDepremon{{Spec: operatorv1alpha1.ClusterDepremonSpec{Imports: imports}}},
+			[]apiextensionsv1.CustomResourceDefinition{crd}, discovered, "depremon", "v1.24", "networking.k8s.io/v1"},
+		{"ClusterDepremon", []operatorv1alpha1.ClusterDepremon{{Spec: operatorv1alpha1.ClusterDepremonSpec{Imports: imports}}, cluster},
+			[]apiextensionsv1.CustomResourceDefinition{crd}, discovered, "depremon", "v1.25", "networking.k8s.io/v1"},
+	}
+	for _, test := range tests {
+		apis := buildCatalog(context.Background(), reader, test.namespace, test.clusters, test.crds, test.discovered)
+		api, found := catalog.Lookup(apis, "networking.k8s.io", "v1beta1", "ingresses")
+		if !found {
+			t.Errorf("%s: ingresses not found", test.name)
+			continue
+		}
+		if api.RemovedIn != test.removedIn || api.ReplacedBy != test.replacedBy {
+			t.Errorf("%s: removed in %q and replaced by %q, expected %q and %q", test.name, api.RemovedIn, api.ReplacedBy, test.removedIn, test.replacedBy)
+		}
+		if len(apis) != len(catalog.Builtin()) {
+			t.Errorf("%s: %d entries, expected the %d built-in ones", test.name, len(apis), len(catalog.Builtin()))
+		}
+	}
+}
+
+func TestForCluster(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{operatorv1alpha1.AddToScheme, apiextensionsv1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	widgets := operatorv1alpha1.DeprecatedAPI{Group: "example.com", Version: "v1alpha1", Resource: "widgets", RemovedIn: "v1.24"}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&operatorv1alpha1.ClusterDepremon{
+			ObjectMeta: metav1.ObjectMeta{Name: "platform"},
+			Spec: operatorv1alpha1.ClusterDepremonSpec{
+				Catalog:    []operatorv1alpha1.DeprecatedAPI{widgets},
+				Mode:       operatorv1alpha1.DenyMode,
+				Exemptions: []operatorv1alpha1.Exemption{{Namespaces: []string{"kube-system"}}},
+			},
+		},
+		&operatorv1alpha1.ClusterDepremon{
+			ObjectMeta: metav1.ObjectMeta{Name: "security"},
+			Spec: operatorv1alpha1.ClusterDepremonSpec{
+				Mode:       operatorv1alpha1.WarnMode,
+				Exemptions: []operatorv1alpha1.Exemption{{Requesters: []string{"ci/pipeline"}}},
+				Fields: []operatorv1alpha1.DeprecatedField{
+					{Group: "apps", Resource: "deployments", Path: "spec.template.spec.serviceAccount", RemovedIn: "v1.30"},
+				},
+			},
+		},
+	).Build()
+
+	p, err := ForCluster(context.Background(), reader, "depremon", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode != operatorv1alpha1.DenyMode {
+		t.Errorf("the strictest mode must win, got %s", p.Mode)
+	}
+	if len(p.Exemptions) != 2 {
+		t.Errorf("the exemptions must be merged, got %v", p.Exemptions)
+	}
+	if api, found := catalog.Lookup(p.Catalog, "example.com", "v1alpha1", "widgets"); !found || api != widgets {
+		t.Errorf("the catalog of the ClusterDepremon objects must be added, got %v", api)
+	}
+	if len(p.Catalog) != len(catalog.Builtin())+1 {
+		t.Errorf("expected the built-in catalog and widgets, got %d entries", len(p.Catalog))
+	}
+	// the field of the ClusterDepremon replaces the built-in one
+	if len(p.Fields) != len(catalog.BuiltinFields()) {
+		t.Errorf("expected the %d built-in fields, got %d", len(catalog.BuiltinFields()), len(p.Fields))
+	}
+	for _, field := range p.Fields {
+		if field.Group == "apps" && field.Resource == "deployments" && field.Path == "spec.template.spec.serviceAccount" && field.RemovedIn != "v1.30" {
+			t.Errorf("the field of the ClusterDepremon must replace the built-in one, got %+v", field)
+		}
+	}
+	if !p.Exempted("kube-system", "", "kubernetes-admin") || !p.Exempted("shop", "ci", "ci/pipeline") || p.Exempted("shop", "shop", "shop/deployer") {
+		t.Error("unexpected exemptions of the cluster policy")
+	}
+
+	// without ClusterDepremon objects, the built-in catalog is recorded
+	empty := fake.NewClientBuilder().WithScheme(scheme).Build()
+	if p, err = ForCluster(context.Background(), empty, "depremon", nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode != operatorv1alpha1.RecordMode || len(p.Catalog) != len(catalog.Builtin()) || len(p.Exemptions) != 0 {
+		t.Errorf("unexpected default policy %+v", p)
+	}
+}
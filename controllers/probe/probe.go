@@ -0,0 +1,199 @@
+package probe
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+// Interval is the minimum time between two probes of the served APIs, the
+// deprecations only change with the version of the cluster
+const Interval = time.Hour
+
+// deprecationWarning matches the warnings of the apiserver for the deprecated
+// APIs, e.g. "policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+,
+// unavailable in v1.25+" or "extensions/v1beta1 Ingress is deprecated in
+// v1.14+, unavailable in v1.22+; use networking.k8s.io/v1 Ingress". The
+// custom resource definitions can set their own warning.
+var deprecationWarning = regexp.MustCompile(`is deprecated(?: in v[0-9.]+\+)?(?:, unavailable in (v[0-9.]+)\+)?(?:; use ([^ ]+))?`)
+
+// Result is the outcome of a probe of the served APIs
+type Result struct {
+	// APIs are the served APIs the apiserver warns about
+	APIs []operatorv1alpha1.DeprecatedAPI
+	// Served are the resources served by the cluster
+	Served *ServedAPIs
+	// Skipped are the resources which couldn't be listed
+	Skipped []string
+	// Forbidden are the resources the operator isn't allowed to list
+	Forbidden []string
+	Time      time.Time
+}
+
+// capture is a WarningHandler keeping the warnings of a request
+type capture struct {
+	messages []string
+}
+
+func (c *capture) HandleWarningHeader(code int, agent string, message string) {
+	if code == 299 && message != "" {
+		c.messages = append(c.messages, message)
+	}
+}
+
+// Probe lists one object of each served resource, and turns the deprecation
+// warnings of the apiserver into catalog entries. The subresources and the
+// resources which can't be listed, or whose list fails, are skipped, as well
+// as the groups whose discovery failed. The operator is only allowed to list
+// the resources of its cluster roles, the other ones are Forbidden.
+func Probe(ctx context.Context, config *rest.Config) (*Result, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	_, apiLists, err := dc.ServerGroupsAndResources()
+	served, err := newServedAPIs(apiLists, err)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Served: served, Time: time.Now()}
+	for _, apiList := range apiLists {
+		gv, err := schema.ParseGroupVersion(apiList.GroupVersion)
+		if err != nil {
+			klog.Error(err)
+			continue
+		}
+		for _, resource := range apiList.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			api := operatorv1alpha1.DeprecatedAPI{Group: gv.Group, Version: gv.Version, Resource: resource.Name}
+			if !contains(resource.Verbs, "list") {
+				continue
+			}
+
+			warnings := &capture{}
+			path := "/apis/" + apiList.GroupVersion + "/" + resource.Name
+			if gv.Group == "" {
+				path = "/api/" + gv.Version + "/" + resource.Name
+			}
+			err := dc.RESTClient().Get().AbsPath(path).Param("limit", "1").WarningHandler(warnings).Do(ctx).Error()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if errors.IsForbidden(err) {
+					result.Forbidden = append(result.Forbidden, catalog.Key(api))
+					continue
+				}
+				// An unavailable aggregated API only skips its resources
+				if !errors.IsNotFound(err) && !errors.IsMethodNotSupported(err) {
+					klog.Infof("Can't list %s: %v", catalog.Key(api), err)
+				}
+				result.Skipped = append(result.Skipped, catalog.Key(api))
+				continue
+			}
+
+			for _, message := range warnings.messages {
+				match := deprecationWarning.FindStringSubmatch(message)
+				if match == nil {
+					continue
+				}
+				api.RemovedIn = match[1]
+				api.ReplacedBy = match[2]
+				api.Scope = operatorv1alpha1.ClusterScope
+				if resource.Namespaced {
+					api.Scope = operatorv1alpha1.NamespacedScope
+				}
+				klog.Infof("%s is deprecated: %s", catalog.Key(api), message)
+				result.APIs = append(result.APIs, api)
+				break
+			}
+		}
+	}
+	sort.Strings(result.Skipped)
+	sort.Strings(result.Forbidden)
+	return result, nil
+}
+
+// Prober probes the served APIs at most once per Interval, and keeps the
+// result of the last probe
+type Prober struct {
+	config *rest.Config
+
+	lock sync.Mutex
+	// result is the result of the last probe, and build tells if the APIs
+	// it discovered are added to the catalog
+	result *Result
+	build  bool
+}
+
+// NewProber returns a Prober of the cluster of config
+func NewProber(config *rest.Config) *Prober {
+	return &Prober{config: config}
+}
+
+// Run probes the served APIs when the last probe is older than Interval, and
+// returns the result of the last probe. build adds the discovered APIs to
+// Catalog.
+func (p *Prober) Run(ctx context.Context, build bool) (*Result, error) {
+	p.lock.Lock()
+	result := p.result
+	p.build = build
+	p.lock.Unlock()
+	if result != nil && time.Since(result.Time) < Interval {
+		return result, nil
+	}
+
+	result, err := Probe(ctx, p.config)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.result = result
+	return result, nil
+}
+
+// Disable stops adding the discovered APIs to Catalog
+func (p *Prober) Disable() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.build = false
+}
+
+// Catalog returns the APIs discovered by the last probe in the Build mode. A
+// nil Prober has discovered nothing.
+func (p *Prober) Catalog() []operatorv1alpha1.DeprecatedAPI {
+	if p == nil {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.build || p.result == nil {
+		return nil
+	}
+	return p.result.APIs
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
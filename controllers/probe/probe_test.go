@@ -0,0 +1,55 @@
+package probe
+
+import "testing"
+
+func TestDeprecationWarning(t *testing.T) {
+	tests := []struct {
+		message    string
+		match      bool
+		removedIn  string
+		replacedBy string
+	}{
+		{
+			message:   "policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+, unavailable in v1.25+",
+			match:     true,
+			removedIn: "v1.25",
+		},
+		{
+			message:    "extensions/v1beta1 Ingress is deprecated in v1.14+, unavailable in v1.22+; use networking.k8s.io/v1 Ingress",
+			match:      true,
+			removedIn:  "v1.22",
+			replacedBy: "networking.k8s.io/v1",
+		},
+		{
+			message:    "batch/v1beta1 CronJob is deprecated in v1.21+, unavailable in v1.25+; use batch/v1",
+			match:      true,
+			removedIn:  "v1.25",
+			replacedBy: "batch/v1",
+		},
+		{
+			// the default warning of a deprecated version of a custom
+			// resource definition
+			message: "example.com/v1alpha1 Widget is deprecated",
+			match:   true,
+		},
+		{
+			message: "spec.template.spec.containers[0].resources: unknown field",
+		},
+		{
+			message: "",
+		},
+	}
+	for _, test := range tests {
+		match := deprecationWarning.FindStringSubmatch(test.message)
+		if (match != nil) != test.match {
+			t.Errorf("%q: match %v, expected %t", test.message, match, test.match)
+			continue
+		}
+		if match == nil {
+			continue
+		}
+		if match[1] != test.removedIn || match[2] != test.replacedBy {
+			t.Errorf("%q: removed in %q and replaced by %q, expected %q and %q", test.message, match[1], match[2], test.removedIn, test.replacedBy)
+		}
+	}
+}
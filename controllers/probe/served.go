@@ -0,0 +1,77 @@
+package probe
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+// ServedAPIs are the resources served by the cluster, according to discovery
+type ServedAPIs struct {
+	resources map[string]bool
+	// failed are the group versions whose discovery failed
+	failed map[schema.GroupVersion]bool
+}
+
+// Discover returns the resources served by the cluster. The group versions
+// whose discovery failed, like an unavailable aggregated API, are neither
+// served nor removed.
+func Discover(dc discovery.DiscoveryInterface) (*ServedAPIs, error) {
+	_, apiLists, err := dc.ServerGroupsAndResources()
+	return newServedAPIs(apiLists, err)
+}
+
+func newServedAPIs(apiLists []*metav1.APIResourceList, err error) (*ServedAPIs, error) {
+	served := &ServedAPIs{
+		resources: make(map[string]bool),
+		failed:    make(map[schema.GroupVersion]bool),
+	}
+	if err != nil {
+		failed, ok := err.(*discovery.ErrGroupDiscoveryFailed)
+		if !ok {
+			return nil, err
+		}
+		klog.Infof("Discovery failed for some groups: %v", err)
+		for gv := range failed.Groups {
+			served.failed[gv] = true
+		}
+	}
+	for _, apiList := range apiLists {
+		gv, err := schema.ParseGroupVersion(apiList.GroupVersion)
+		if err != nil {
+			klog.Error(err)
+			continue
+		}
+		for _, resource := range apiList.APIResources {
+			served.resources[catalog.Key(operatorv1alpha1.DeprecatedAPI{Group: gv.Group, Version: gv.Version, Resource: resource.Name})] = true
+		}
+	}
+	return served, nil
+}
+
+// Serves tells if the cluster serves an API
+func (s *ServedAPIs) Serves(api operatorv1alpha1.DeprecatedAPI) bool {
+	return s.resources[catalog.Key(api)]
+}
+
+// Removed tells if the cluster doesn't serve an API anymore
+func (s *ServedAPIs) Removed(api operatorv1alpha1.DeprecatedAPI) bool {
+	return !s.Serves(api) && !s.failed[schema.GroupVersion{Group: api.Group, Version: api.Version}]
+}
+
+// Split returns the entries of the catalog still served by the cluster, and
+// the ones it removed
+func (s *ServedAPIs) Split(apis []operatorv1alpha1.DeprecatedAPI) (served, removed []operatorv1alpha1.DeprecatedAPI) {
+	for _, api := range apis {
+		if s.Removed(api) {
+			removed = append(removed, api)
+			continue
+		}
+		served = append(served, api)
+	}
+	return served, removed
+}
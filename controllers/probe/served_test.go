@@ -0,0 +1,45 @@
+package probe
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func TestSplit(t *testing.T) {
+	apiLists := []*metav1.APIResourceList{
+		{GroupVersion: "networking.k8s.io/v1", APIResources: []metav1.APIResource{{Name: "ingresses"}}},
+		{GroupVersion: "policy/v1beta1", APIResources: []metav1.APIResource{{Name: "poddisruptionbudgets"}, {Name: "podsecuritypolicies"}}},
+	}
+	// the aggregated metrics API is unavailable
+	failed := &discovery.ErrGroupDiscoveryFailed{Groups: map[schema.GroupVersion]error{
+		{Group: "metrics.k8s.io", Version: "v1beta1"}: fmt.Errorf("the server is currently unable to handle the request"),
+	}}
+	served, err := newServedAPIs(apiLists, failed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apis := []operatorv1alpha1.DeprecatedAPI{
+		{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"},
+		{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies"},
+		{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"},
+		{Group: "extensions", Version: "v1beta1", Resource: "ingresses"},
+	}
+	stillServed, removed := served.Split(apis)
+	if len(stillServed) != 2 || stillServed[0].Group != "policy" || stillServed[1].Group != "metrics.k8s.io" {
+		t.Errorf("unexpected served APIs %v", stillServed)
+	}
+	if len(removed) != 2 || removed[0].Group != "networking.k8s.io" || removed[1].Group != "extensions" {
+		t.Errorf("unexpected removed APIs %v", removed)
+	}
+
+	if _, err := newServedAPIs(nil, fmt.Errorf("connection refused")); err == nil {
+		t.Error("expected the error of the discovery")
+	}
+}
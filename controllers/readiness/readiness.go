@@ -0,0 +1,211 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+	"github.com/horis233/k8s-deprecation-checker/controllers/handler"
+)
+
+// MaxStatusFindings is the number of blocking findings kept in the status of
+// the Depremon objects
+const MaxStatusFindings = 50
+
+// Evaluator combines the report and the objects of the cluster into the
+// readiness for a target version
+type Evaluator struct {
+	// Reader reads the objects of the whole cluster
+	Reader client.Reader
+	Mapper meta.RESTMapper
+	// Namespace of the operator, holding the report
+	Namespace string
+}
+
+// Evaluate returns the readiness of the cluster for the target version, with
+// all its blocking findings. Each source returns its findings and the
+// resources it isn't allowed to read.
+func (e *Evaluator) Evaluate(ctx context.Context, apis []operatorv1alpha1.DeprecatedAPI, targetVersion string) (*operatorv1alpha1.ReadinessStatus, error) {
+	removed, err := catalog.RemovedBy(apis, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []operatorv1alpha1.BlockingFinding
+	var unreadable []string
+	for _, source := range []func(context.Context, []operatorv1alpha1.DeprecatedAPI) ([]operatorv1alpha1.BlockingFinding, []string, error){
+		e.reportFindings,
+		e.managedFieldsFindings,
+		e.crdFindings,
+		e.webhookFindings,
+		e.helmFindings,
+	} {
+		found, denied, err := source(ctx, removed)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+		unreadable = append(unreadable, denied...)
+	}
+	findings = dedup(findings)
+
+	status := &operatorv1alpha1.ReadinessStatus{
+		TargetVersion:     targetVersion,
+		Verdict:           operatorv1alpha1.Ready,
+		BlockingCount:     int32(len(findings)),
+		BlockingFindings:  findings,
+		UnreadableSources: unreadable,
+		EvaluationTime:    metav1.Now(),
+	}
+	switch {
+	case len(findings) != 0:
+		status.Verdict = operatorv1alpha1.NotReady
+	case len(unreadable) != 0:
+		// the sources which can't be read may hide blocking findings
+		status.Verdict = operatorv1alpha1.Unknown
+	}
+	return status, nil
+}
+
+// reportFindings returns the findings of the report which aren't resolved
+func (e *Evaluator) reportFindings(ctx context.Context, removed []operatorv1alpha1.DeprecatedAPI) ([]operatorv1alpha1.BlockingFinding, []string, error) {
+	cm := &corev1.ConfigMap{}
+	if err := e.Reader.Get(ctx, client.ObjectKey{Namespace: e.Namespace, Name: handler.ReportName}, cm); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	var apiSlice []handler.DeprecatedObjectList
+	if err := utilyaml.Unmarshal([]byte(cm.Data[handler.ReportKey]), &apiSlice); err != nil {
+		return nil, nil, err
+	}
+
+	var findings []operatorv1alpha1.BlockingFinding
+	for _, objList := range apiSlice {
+		gvk := schema.GroupVersionKind{Group: objList.Group, Version: objList.Version, Kind: objList.Kind}
+		api, found := catalog.Lookup(removed, objList.Group, objList.Version, e.resourceFor(gvk))
+		if !found {
+			continue
+		}
+		for _, obj := range objList.Objects {
+			if obj.State == handler.ResolvedFinding {
+				continue
+			}
+			findings = append(findings, newFinding(operatorv1alpha1.ReportSource, api, gvk, obj.Name, obj.Namespace,
+				fmt.Sprintf("requested by %v", obj.RequesterList)))
+		}
+	}
+	return findings, nil, nil
+}
+
+// managedFieldsFindings returns the objects of the removed APIs whose managed
+// fields were written with the removed version, even if the request wasn't
+// observed by the webhook. The objects are read with the preferred version of
+// their kind, the resources the operator isn't allowed to list are returned
+// as unreadable.
+func (e *Evaluator) managedFieldsFindings(ctx context.Context, removed []operatorv1alpha1.DeprecatedAPI) ([]operatorv1alpha1.BlockingFinding, []string, error) {
+	var findings []operatorv1alpha1.BlockingFinding
+	var unreadable []string
+	for _, api := range removed {
+		gvk, err := e.Mapper.KindFor(schema.GroupVersionResource{Group: api.Group, Resource: api.Resource})
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		apiVersion := schema.GroupVersion{Group: api.Group, Version: api.Version}.String()
+		removedGVK := schema.GroupVersionKind{Group: api.Group, Version: api.Version, Kind: gvk.Kind}
+
+		list := &metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		for {
+			if err := e.Reader.List(ctx, list, client.Limit(500), client.Continue(list.Continue)); err != nil {
+				if denied := deniedResource(err, schema.GroupResource{Group: api.Group, Resource: api.Resource}); denied != "" {
+					unreadable = append(unreadable, denied)
+					break
+				}
+				return nil, nil, err
+			}
+			for _, obj := range list.Items {
+				for _, entry := range obj.ManagedFields {
+					if entry.APIVersion == apiVersion {
+						findings = append(findings, newFinding(operatorv1alpha1.ManagedFieldsSource, api, removedGVK, obj.Name, obj.Namespace,
+							fmt.Sprintf("managed by %s with %s", entry.Manager, apiVersion)))
+						break
+					}
+				}
+			}
+			if list.Continue == "" {
+				break
+			}
+		}
+	}
+	return findings, unreadable, nil
+}
+
+// deniedResource returns the resource to report as unreadable when err is
+// Forbidden, and logs it
+func deniedResource(err error, resource schema.GroupResource) string {
+	if !errors.IsForbidden(err) {
+		return ""
+	}
+	klog.Errorf("Can't read %s, the readiness is unknown: %v", resource, err)
+	return resource.String()
+}
+
+// resourceFor returns the resource of a kind, guessed when the version is no
+// longer served
+func (e *Evaluator) resourceFor(gvk schema.GroupVersionKind) string {
+	if mapping, err := e.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		return mapping.Resource.Resource
+	}
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return plural.Resource
+}
+
+func newFinding(source operatorv1alpha1.FindingSource, api operatorv1alpha1.DeprecatedAPI, gvk schema.GroupVersionKind, name, namespace, message string) operatorv1alpha1.BlockingFinding {
+	return operatorv1alpha1.BlockingFinding{
+		Source:     source,
+		Group:      gvk.Group,
+		Version:    gvk.Version,
+		Kind:       gvk.Kind,
+		Name:       name,
+		Namespace:  namespace,
+		RemovedIn:  api.RemovedIn,
+		ReplacedBy: api.ReplacedBy,
+		Message:    message,
+	}
+}
+
+// dedup removes the objects found by their managed fields which are already
+// in the report. The other sources find different problems of the same
+// objects, such as a Helm release to fix, so they are all kept.
+func dedup(findings []operatorv1alpha1.BlockingFinding) []operatorv1alpha1.BlockingFinding {
+	reported := make(map[string]bool)
+	var deduped []operatorv1alpha1.BlockingFinding
+	for _, finding := range findings {
+		key := finding.Group + "/" + finding.Version + "/" + finding.Kind + "/" + finding.Namespace + "/" + finding.Name
+		switch finding.Source {
+		case operatorv1alpha1.ReportSource:
+			reported[key] = true
+		case operatorv1alpha1.ManagedFieldsSource:
+			if reported[key] {
+				continue
+			}
+		}
+		deduped = append(deduped, finding)
+	}
+	return deduped
+}
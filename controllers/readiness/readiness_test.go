@@ -0,0 +1,200 @@
+package readiness
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func TestDedup(t *testing.T) {
+	finding := func(source operatorv1alpha1.FindingSource, name string) operatorv1alpha1.BlockingFinding {
+		return operatorv1alpha1.BlockingFinding{Source: source, Group: "extensions", Version: "v1beta1", Kind: "Ingress", Namespace: "shop", Name: name}
+	}
+	findings := []operatorv1alpha1.BlockingFinding{
+		finding(operatorv1alpha1.ReportSource, "cart"),
+		finding(operatorv1alpha1.ManagedFieldsSource, "cart"),
+		finding(operatorv1alpha1.ManagedFieldsSource, "web"),
+		finding(operatorv1alpha1.HelmSource, "cart"),
+		finding(operatorv1alpha1.HelmSource, "cart"),
+	}
+	expected := []operatorv1alpha1.BlockingFinding{findings[0], findings[2], findings[3], findings[4]}
+	if deduped := dedup(findings); !reflect.DeepEqual(deduped, expected) {
+		t.Errorf("unexpected findings %v", deduped)
+	}
+}
+
+func TestRuleFindings(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}, meta.RESTScopeNamespace)
+	e := &Evaluator{Mapper: mapper}
+	removed := []operatorv1alpha1.DeprecatedAPI{{
+		Group:      "networking.k8s.io",
+		Version:    "v1beta1",
+		Resource:   "ingresses",
+		RemovedIn:  "v1.22",
+		ReplacedBy: "networking.k8s.io/v1",
+	}}
+	rule := func(groups, versions, resources []string) admissionregistrationv1.RuleWithOperations {
+		return admissionregistrationv1.RuleWithOperations{Rule: admissionregistrationv1.Rule{APIGroups: groups, APIVersions: versions, Resources: resources}}
+	}
+	tests := []struct {
+		name     string
+		rules    []admissionregistrationv1.RuleWithOperations
+		findings int
+	}{
+		{"removed version only", []admissionregistrationv1.RuleWithOperations{
+			rule([]string{"networking.k8s.io"}, []string{"v1beta1"}, []string{"ingresses"}),
+		}, 1},
+		{"subresource", []admissionregistrationv1.RuleWithOperations{
+			rule([]string{"*"}, []string{"v1beta1"}, []string{"ingresses/status"}),
+		}, 1},
+		{"replacement too", []admissionregistrationv1.RuleWithOperations{
+			rule([]string{"networking.k8s.io"}, []string{"v1beta1", "v1"}, []string{"ingresses"}),
+		}, 0},
+		{"all versions", []admissionregistrationv1.RuleWithOperations{
+			rule([]string{"networking.k8s.io"}, []string{"*"}, []string{"ingresses"}),
+		}, 0},
+		{"other resource", []admissionregistrationv1.RuleWithOperations{
+			rule([]string{"networking.k8s.io"}, []string{"v1beta1"}, []string{"ingressclasses"}),
+		}, 0},
+	}
+	for _, test := range tests {
+		findings := e.ruleFindings(removed, "ValidatingWebhookConfiguration", "policies", "ingress.example.com", test.rules)
+		if len(findings) != test.findings {
+			t.Errorf("%s: unexpected findings %v", test.name, findings)
+			continue
+		}
+		for _, finding := range findings {
+			if finding.Source != operatorv1alpha1.WebhookSource || finding.Kind != "Ingress" || finding.Name != "policies" || finding.RemovedIn != "v1.22" {
+				t.Errorf("%s: unexpected finding %v", test.name, finding)
+			}
+		}
+	}
+}
+
+func TestDecodeRelease(t *testing.T) {
+	raw := []byte(`{"name":"shop","namespace":"apps","version":3,"manifest":"apiVersion: extensions/v1beta1\nkind: Ingress\n"}`)
+	expected := &helmRelease{Name: "shop", Namespace: "apps", Version: 3, Manifest: "apiVersion: extensions/v1beta1\nkind: Ingress\n"}
+
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	if _, err := w.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"plain": raw, "gzip": gzipped.Bytes()} {
+		release, err := decodeRelease([]byte(base64.StdEncoding.EncodeToString(data)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(release, expected) {
+			t.Errorf("%s: decoded %v", name, release)
+		}
+	}
+
+	if _, err := decodeRelease([]byte("not base64!")); err == nil {
+		t.Error("a release which isn't base64 must fail")
+	}
+	if _, err := decodeRelease([]byte(base64.StdEncoding.EncodeToString([]byte("{")))); err == nil {
+		t.Error("a release which isn't JSON must fail")
+	}
+}
+
+// denyingReader denies listing the kinds in denied
+type denyingReader struct {
+	client.Reader
+	denied map[string]bool
+}
+
+func (r denyingReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk, err := apiutil.GVKForObject(list, r.Reader.(client.Client).Scheme())
+	if err != nil {
+		return err
+	}
+	if r.denied[gvk.Kind] {
+		return errors.NewForbidden(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, "", fmt.Errorf("access denied"))
+	}
+	return r.Reader.List(ctx, list, opts...)
+}
+
+func TestEvaluateUnreadableSources(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{corev1.AddToScheme, admissionregistrationv1.AddToScheme, apiextensionsv1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ingress := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}
+	scheme.AddKnownTypeWithName(ingress.GroupVersion().WithKind("IngressList"), &metav1.PartialObjectMetadataList{})
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(ingress, meta.RESTScopeNamespace)
+	apis := []operatorv1alpha1.DeprecatedAPI{{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses", RemovedIn: "v1.22"}}
+
+	tests := []struct {
+		name       string
+		denied     map[string]bool
+		objects    []client.Object
+		verdict    operatorv1alpha1.ReadinessVerdict
+		unreadable []string
+	}{
+		{
+			name:    "all the sources are read",
+			verdict: operatorv1alpha1.Ready,
+		},
+		{
+			name:       "the managed fields and the Helm releases can't be read",
+			denied:     map[string]bool{"IngressList": true, "SecretList": true},
+			verdict:    operatorv1alpha1.Unknown,
+			unreadable: []string{"ingresses.networking.k8s.io", "secrets"},
+		},
+		{
+			name:   "a finding blocks the upgrade anyway",
+			denied: map[string]bool{"ValidatingWebhookConfigurationList": true},
+			objects: []client.Object{&apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "ingresses.networking.k8s.io"},
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Group: "networking.k8s.io",
+					Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "ingresses", Kind: "Ingress"},
+				},
+				Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1beta1"}},
+			}},
+			verdict:    operatorv1alpha1.NotReady,
+			unreadable: []string{"validatingwebhookconfigurations.admissionregistration.k8s.io"},
+		},
+	}
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.objects...).Build()
+		e := &Evaluator{Reader: denyingReader{Reader: c, denied: test.denied}, Mapper: mapper, Namespace: "depremon"}
+		status, err := e.Evaluate(context.Background(), apis, "v1.22")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if status.Verdict != test.verdict || !reflect.DeepEqual(status.UnreadableSources, test.unreadable) {
+			t.Errorf("%s: verdict %s with unreadable sources %v, expected %s with %v", test.name, status.Verdict,
+				status.UnreadableSources, test.verdict, test.unreadable)
+		}
+	}
+}
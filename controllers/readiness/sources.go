@@ -0,0 +1,223 @@
+package readiness
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	utilyaml "github.com/ghodss/yaml"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/catalog"
+)
+
+// crdFindings returns the custom resource definitions whose stored versions
+// include a removed version, their objects must be migrated before the
+// upgrade
+func (e *Evaluator) crdFindings(ctx context.Context, removed []operatorv1alpha1.DeprecatedAPI) ([]operatorv1alpha1.BlockingFinding, []string, error) {
+	list := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := e.Reader.List(ctx, list); err != nil {
+		if denied := deniedResource(err, apiextensionsv1.Resource("customresourcedefinitions")); denied != "" {
+			return nil, []string{denied}, nil
+		}
+		return nil, nil, err
+	}
+
+	var findings []operatorv1alpha1.BlockingFinding
+	for _, crd := range list.Items {
+		for _, stored := range crd.Status.StoredVersions {
+			api, found := catalog.Lookup(removed, crd.Spec.Group, stored, crd.Spec.Names.Plural)
+			if !found {
+				continue
+			}
+			gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: stored, Kind: crd.Spec.Names.Kind}
+			findings = append(findings, newFinding(operatorv1alpha1.CRDSource, api, gvk, crd.Name, "",
+				fmt.Sprintf("objects are stored as %s, migrate them and remove it from status.storedVersions", stored)))
+		}
+	}
+	return findings, nil, nil
+}
+
+// webhookFindings returns the webhooks with rules on a removed API but not on
+// its replacement, they won't intercept the requests after the upgrade
+func (e *Evaluator) webhookFindings(ctx context.Context, removed []operatorv1alpha1.DeprecatedAPI) ([]operatorv1alpha1.BlockingFinding, []string, error) {
+	var findings []operatorv1alpha1.BlockingFinding
+	var unreadable []string
+
+	mutating := &admissionregistrationv1.MutatingWebhookConfigurationList{}
+	if err := e.Reader.List(ctx, mutating); err != nil {
+		denied := deniedResource(err, admissionregistrationv1.Resource("mutatingwebhookconfigurations"))
+		if denied == "" {
+			return nil, nil, err
+		}
+		unreadable = append(unreadable, denied)
+	}
+	for _, configuration := range mutating.Items {
+		for _, webhook := range configuration.Webhooks {
+			findings = append(findings, e.ruleFindings(removed, "MutatingWebhookConfiguration", configuration.Name, webhook.Name, webhook.Rules)...)
+		}
+	}
+
+	validating := &admissionregistrationv1.ValidatingWebhookConfigurationList{}
+	if err := e.Reader.List(ctx, validating); err != nil {
+		denied := deniedResource(err, admissionregistrationv1.Resource("validatingwebhookconfigurations"))
+		if denied == "" {
+			return nil, nil, err
+		}
+		unreadable = append(unreadable, denied)
+	}
+	for _, configuration := range validating.Items {
+		for _, webhook := range configuration.Webhooks {
+			findings = append(findings, e.ruleFindings(removed, "ValidatingWebhookConfiguration", configuration.Name, webhook.Name, webhook.Rules)...)
+		}
+	}
+	return findings, unreadable, nil
+}
+
+func (e *Evaluator) ruleFindings(removed []operatorv1alpha1.DeprecatedAPI, kind, configuration, webhook string, rules []admissionregistrationv1.RuleWithOperations) []operatorv1alpha1.BlockingFinding {
+	var findings []operatorv1alpha1.BlockingFinding
+	for _, rule := range rules {
+		for _, api := range removed {
+			if !matches(rule.APIGroups, api.Group) || !contains(rule.APIVersions, api.Version) || !matchesResource(rule.Resources, api.Resource) {
+				continue
+			}
+			if replacement, err := schema.ParseGroupVersion(api.ReplacedBy); err == nil && api.ReplacedBy != "" &&
+				matches(rule.APIGroups, replacement.Group) && matches(rule.APIVersions, replacement.Version) {
+				continue
+			}
+			findings = append(findings, newFinding(operatorv1alpha1.WebhookSource, api, e.kindFor(api), configuration, "",
+				fmt.Sprintf("webhook %s of %s only intercepts %s/%s %s", webhook, kind, api.Group, api.Version, api.Resource)))
+		}
+	}
+	return findings
+}
+
+// helmRelease is the part of a Helm 3 release used to find the removed APIs
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Manifest  string `json:"manifest"`
+}
+
+// manifestObject is the part of a rendered object used to find the removed
+// APIs
+type manifestObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+// helmFindings returns the objects of the deployed Helm releases rendered
+// with a removed API, the releases can't be upgraded once the API is gone.
+// Only the releases stored in secrets by Helm 3 are read.
+func (e *Evaluator) helmFindings(ctx context.Context, removed []operatorv1alpha1.DeprecatedAPI) ([]operatorv1alpha1.BlockingFinding, []string, error) {
+	list := &corev1.SecretList{}
+	if err := e.Reader.List(ctx, list, client.MatchingLabels{"owner": "helm", "status": "deployed"}); err != nil {
+		if denied := deniedResource(err, corev1.Resource("secrets")); denied != "" {
+			return nil, []string{denied}, nil
+		}
+		return nil, nil, err
+	}
+
+	var findings []operatorv1alpha1.BlockingFinding
+	for _, secret := range list.Items {
+		release, err := decodeRelease(secret.Data["release"])
+		if err != nil {
+			klog.Errorf("Skipping Helm release %s/%s: %v", secret.Namespace, secret.Name, err)
+			continue
+		}
+		for _, doc := range strings.Split(release.Manifest, "\n---") {
+			obj := manifestObject{}
+			if err := utilyaml.Unmarshal([]byte(doc), &obj); err != nil || obj.APIVersion == "" {
+				continue
+			}
+			gv, err := schema.ParseGroupVersion(obj.APIVersion)
+			if err != nil {
+				continue
+			}
+			gvk := gv.WithKind(obj.Kind)
+			api, found := catalog.Lookup(removed, gv.Group, gv.Version, e.resourceFor(gvk))
+			if !found {
+				continue
+			}
+			namespace := obj.Metadata.Namespace
+			if namespace == "" && api.Scope != operatorv1alpha1.ClusterScope {
+				namespace = release.Namespace
+			}
+			findings = append(findings, newFinding(operatorv1alpha1.HelmSource, api, gvk, obj.Metadata.Name, namespace,
+				fmt.Sprintf("rendered by revision %d of Helm release %s/%s", release.Version, release.Namespace, release.Name)))
+		}
+	}
+	return findings, nil, nil
+}
+
+// decodeRelease decodes a release stored by Helm 3: base64 encoded JSON,
+// usually gzipped
+func decodeRelease(data []byte) (*helmRelease, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if raw, err = ioutil.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+	release := &helmRelease{}
+	if err := json.Unmarshal(raw, release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// kindFor returns the kind of a catalog entry, guessed from the preferred
+// version when the removed one is no longer served
+func (e *Evaluator) kindFor(api operatorv1alpha1.DeprecatedAPI) schema.GroupVersionKind {
+	gvk := schema.GroupVersionKind{Group: api.Group, Version: api.Version}
+	if preferred, err := e.Mapper.KindFor(schema.GroupVersionResource{Group: api.Group, Resource: api.Resource}); err == nil {
+		gvk.Kind = preferred.Kind
+	}
+	return gvk
+}
+
+func matches(values []string, value string) bool {
+	return contains(values, "*") || contains(values, value)
+}
+
+func matchesResource(resources []string, resource string) bool {
+	for _, r := range resources {
+		if r == "*" || r == "*/*" || strings.SplitN(r, "/", 2)[0] == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
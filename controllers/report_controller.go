@@ -0,0 +1,168 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	"github.com/horis233/k8s-deprecation-checker/controllers/handler"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+	"github.com/horis233/k8s-deprecation-checker/controllers/snapshot"
+)
+
+// lifecycleInterval is the interval between two updates of the state of the
+// findings. The objects of the findings are polled rather than watched: they
+// can be of any kind, and an informer per kind would cache every object of
+// the kinds with a finding, while few of them are in the report.
+const lifecycleInterval = 10 * time.Minute
+
+// ReportReconciler updates the state of the findings of the report of the
+// operator namespace, derives the team and the namespace reports from it, and
+// takes its snapshots
+type ReportReconciler struct {
+	client.Client
+	// Reader reads the namespace reports outside of the operator namespace,
+	// and the objects of the findings
+	Reader client.Reader
+	// Policy is the policy of the cluster built by the Depremon reconciler
+	Policy *policy.Shared
+	// lastLifecycle is the time of the last update of the state of the
+	// findings. Each write of the report triggers a reconciliation, while the
+	// states are only updated once per lifecycleInterval.
+	lastLifecycle time.Time
+}
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses;ingressclasses,verbs=get
+//+kubebuilder:rbac:groups=apiregistration.k8s.io,resources=apiservices,verbs=get
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings;clusterroles;clusterrolebindings,verbs=get
+//+kubebuilder:rbac:groups=scheduling.k8s.io,resources=priorityclasses,verbs=get
+//+kubebuilder:rbac:groups=policy,resources=podsecuritypolicies,verbs=get
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=csidrivers;csinodes;storageclasses;volumeattachments,verbs=get
+//+kubebuilder:rbac:groups="",resources=replicationcontrollers,verbs=get
+
+// Reconcile updates the state of the findings at most once per
+// lifecycleInterval, then writes the team and the namespace reports from the
+// report. They are deleted with the report.
+func (r *ReportReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	settings := r.settings(ctx, req.Namespace)
+	if now := time.Now(); !now.Before(r.lastLifecycle.Add(lifecycleInterval)) {
+		p := r.Policy.Load()
+		if p == nil {
+			var err error
+			if p, err = policy.ForCluster(ctx, r.Client, req.Namespace, nil); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if err := handler.UpdateLifecycle(ctx, r.Client, r.Reader, r.Client.RESTMapper(), p, req.Namespace, lifecycle(settings)); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.lastLifecycle = now
+	}
+
+	var apiSlice []handler.DeprecatedObjectList
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cm); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	} else if err := utilyaml.Unmarshal([]byte(cm.Data[handler.ReportKey]), &apiSlice); err != nil {
+		klog.Error(err)
+		return ctrl.Result{}, err
+	}
+
+	if err := handler.UpdateTeamReports(ctx, r.Client, req.Namespace, apiSlice); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := handler.UpdateNamespaceReports(ctx, r.Client, r.Reader, apiSlice); err != nil {
+		return ctrl.Result{}, err
+	}
+	if apiSlice == nil {
+		return ctrl.Result{}, nil
+	}
+
+	interval, keep := snapshots(settings)
+	if err := snapshot.Take(ctx, r.Client, req.Namespace, apiSlice, interval, keep, time.Now()); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: time.Until(r.lastLifecycle.Add(lifecycleInterval))}, nil
+}
+
+// settings returns the spec of the first Depremon of the operator namespace,
+// which holds the settings of the report, or an empty spec
+func (r *ReportReconciler) settings(ctx context.Context, namespace string) operatorv1alpha1.DepremonSpec {
+	first, err := firstDepremon(ctx, r.Client, namespace)
+	if err != nil {
+		klog.Error(err)
+		return operatorv1alpha1.DepremonSpec{}
+	}
+	if first == nil {
+		return operatorv1alpha1.DepremonSpec{}
+	}
+	return first.Spec
+}
+
+// lifecycle returns the lifecycle of the findings, or the default one
+func lifecycle(spec operatorv1alpha1.DepremonSpec) handler.Lifecycle {
+	lifecycle := handler.Lifecycle{
+		InactivityWindow:  operatorv1alpha1.DefaultInactivityWindow,
+		ResolvedRetention: operatorv1alpha1.DefaultResolvedRetentionDays * 24 * time.Hour,
+	}
+	if spec.Lifecycle.InactivityWindow != nil {
+		lifecycle.InactivityWindow = spec.Lifecycle.InactivityWindow.Duration
+	}
+	if spec.Lifecycle.ResolvedRetentionDays != 0 {
+		lifecycle.ResolvedRetention = time.Duration(spec.Lifecycle.ResolvedRetentionDays) * 24 * time.Hour
+	}
+	return lifecycle
+}
+
+// snapshots returns the interval between two snapshots of the report and the
+// number of snapshots to keep, or the default ones
+func snapshots(spec operatorv1alpha1.DepremonSpec) (time.Duration, int) {
+	interval, keep := operatorv1alpha1.DefaultSnapshotInterval, operatorv1alpha1.DefaultSnapshotKeep
+	if spec.Snapshots.Interval != nil {
+		interval = spec.Snapshots.Interval.Duration
+	}
+	if spec.Snapshots.Keep != 0 {
+		keep = int(spec.Snapshots.Keep)
+	}
+	return interval, keep
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ReportReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("report").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == handler.ReportName
+		}))).
+		Complete(r)
+}
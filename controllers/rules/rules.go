@@ -0,0 +1,158 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+// NewEnv returns the CEL environment of the custom rules, declaring the
+// object, oldObject and request variables
+func NewEnv() (*cel.Env, error) {
+	return cel.NewEnv(cel.Declarations(
+		decls.NewVar("object", decls.Dyn),
+		decls.NewVar("oldObject", decls.Dyn),
+		decls.NewVar("request", decls.Dyn),
+	))
+}
+
+// Compile checks an expression and returns its program. The expression must
+// return a boolean, or a dynamic value checked on evaluation.
+func Compile(env *cel.Env, expression string) (cel.Program, error) {
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if resultType := cel.FormatType(ast.ResultType()); resultType != "bool" && resultType != "dyn" {
+		return nil, fmt.Errorf("must return a bool, not %s", resultType)
+	}
+	return env.Program(ast)
+}
+
+// For returns the rules of a group, version and resource
+func For(rules []operatorv1alpha1.CustomRule, group, version, resource string) []operatorv1alpha1.CustomRule {
+	var matching []operatorv1alpha1.CustomRule
+	for _, rule := range rules {
+		if rule.Group != group || rule.Resource != resource {
+			continue
+		}
+		if len(rule.Versions) != 0 && !contains(rule.Versions, version) {
+			continue
+		}
+		matching = append(matching, rule)
+	}
+	return matching
+}
+
+// Evaluator evaluates the custom rules on the admission requests. The
+// programs are compiled once per expression. The zero value is ready to use.
+type Evaluator struct {
+	mu       sync.Mutex
+	env      *cel.Env
+	programs map[string]cel.Program
+}
+
+// Matching returns the rules matched by a request. The rules failing to
+// compile or to evaluate are logged and skipped.
+func (e *Evaluator) Matching(rules []operatorv1alpha1.CustomRule, req admission.Request) []operatorv1alpha1.CustomRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	vars, err := variables(req)
+	if err != nil {
+		klog.Error(err)
+		return nil
+	}
+
+	var matched []operatorv1alpha1.CustomRule
+	for _, rule := range rules {
+		program, err := e.program(rule.Expression)
+		if err != nil {
+			klog.Errorf("Invalid expression of rule %s: %v", rule.Name, err)
+			continue
+		}
+		out, _, err := program.Eval(vars)
+		if err != nil {
+			klog.Infof("Can't evaluate rule %s on %s/%s: %v", rule.Name, req.Namespace, req.Name, err)
+			continue
+		}
+		if match, ok := out.Value().(bool); ok && match {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+func (e *Evaluator) program(expression string) (cel.Program, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if program, found := e.programs[expression]; found {
+		return program, nil
+	}
+	if e.env == nil {
+		env, err := NewEnv()
+		if err != nil {
+			return nil, err
+		}
+		e.env = env
+		e.programs = make(map[string]cel.Program)
+	}
+	program, err := Compile(e.env, expression)
+	if err != nil {
+		return nil, err
+	}
+	e.programs[expression] = program
+	return program, nil
+}
+
+// variables decodes the objects and the request, without its objects, as
+// JSON values
+func variables(req admission.Request) (map[string]interface{}, error) {
+	vars := map[string]interface{}{
+		"object":    nil,
+		"oldObject": nil,
+	}
+	if len(req.Object.Raw) != 0 {
+		var object map[string]interface{}
+		if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+			return nil, err
+		}
+		vars["object"] = object
+	}
+	if len(req.OldObject.Raw) != 0 {
+		var oldObject map[string]interface{}
+		if err := json.Unmarshal(req.OldObject.Raw, &oldObject); err != nil {
+			return nil, err
+		}
+		vars["oldObject"] = oldObject
+	}
+
+	raw, err := json.Marshal(req.AdmissionRequest)
+	if err != nil {
+		return nil, err
+	}
+	var request map[string]interface{}
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return nil, err
+	}
+	delete(request, "object")
+	delete(request, "oldObject")
+	vars["request"] = request
+	return vars, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
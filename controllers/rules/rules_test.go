@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+)
+
+func TestCompile(t *testing.T) {
+	env, err := NewEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expression string
+		valid      bool
+	}{
+		{"true", true},
+		{"has(object.metadata.labels)", true},
+		{"object.spec.replicas > 1", true},
+		{"object.metadata.name", true},
+		{"1 + 1", false},
+		{"'tier'", false},
+		{"object.", false},
+	}
+	for _, test := range tests {
+		_, err := Compile(env, test.expression)
+		if (err == nil) != test.valid {
+			t.Errorf("compiling %q returned %v", test.expression, err)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	rules := []operatorv1alpha1.CustomRule{
+		{Name: "all", Group: "apps", Resource: "deployments"},
+		{Name: "v1", Group: "apps", Versions: []string{"v1"}, Resource: "deployments"},
+		{Name: "pods", Resource: "pods"},
+	}
+	if matching := For(rules, "apps", "v1beta2", "deployments"); len(matching) != 1 || matching[0].Name != "all" {
+		t.Errorf("unexpected rules %v", matching)
+	}
+	if matching := For(rules, "apps", "v1", "deployments"); len(matching) != 2 {
+		t.Errorf("unexpected rules %v", matching)
+	}
+}
+
+func TestMatching(t *testing.T) {
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Update,
+		Namespace: "team-a",
+		Name:      "web",
+		Object:    runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"web","labels":{"tier":"front"}},"spec":{"replicas":3}}`)},
+		OldObject: runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"web"},"spec":{"replicas":1}}`)},
+	}}
+	tests := []struct {
+		expression string
+		matched    bool
+	}{
+		{"has(object.metadata.labels) && 'tier' in object.metadata.labels", true},
+		{"object.spec.replicas > oldObject.spec.replicas", true},
+		{"has(oldObject.metadata.labels)", false},
+		{"request.operation == 'UPDATE'", true},
+		{"request.operation == 'CREATE'", false},
+		{"request.namespace == 'team-a' && !has(request.object)", true},
+		// evaluation errors and invalid expressions never match
+		{"object.spec.missing == 1", false},
+		{"1 + 1", false},
+	}
+	evaluator := &Evaluator{}
+	for _, test := range tests {
+		rule := operatorv1alpha1.CustomRule{Name: "rule", Expression: test.expression}
+		matched := evaluator.Matching([]operatorv1alpha1.CustomRule{rule}, req)
+		if (len(matched) == 1) != test.matched {
+			t.Errorf("%q matched %v, expected %v", test.expression, matched, test.matched)
+		}
+	}
+}
+
+func TestMatchingCreate(t *testing.T) {
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"web"}}`)},
+	}}
+	rules := []operatorv1alpha1.CustomRule{
+		{Name: "created", Expression: "oldObject == null"},
+		{Name: "named", Expression: "object.metadata.name == 'web'"},
+	}
+	if matched := (&Evaluator{}).Matching(rules, req); len(matched) != 2 {
+		t.Errorf("unexpected rules %v", matched)
+	}
+}
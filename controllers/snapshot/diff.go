@@ -0,0 +1,162 @@
+package snapshot
+
+import (
+	"sort"
+	"time"
+
+	"github.com/horis233/k8s-deprecation-checker/controllers/handler"
+)
+
+// ObjectRef identifies an object of the report
+type ObjectRef struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RequesterRef is a requester of an object of the report
+type RequesterRef struct {
+	ObjectRef `json:",inline"`
+	Requester string `json:"requester"`
+}
+
+// Count is the number of unresolved objects of a kind in both snapshots
+type Count struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+}
+
+// Diff is the progress between two snapshots
+type Diff struct {
+	From     string    `json:"from"`
+	FromTime time.Time `json:"fromTime"`
+	To       string    `json:"to"`
+	ToTime   time.Time `json:"toTime"`
+
+	// NewObjects are the unresolved objects missing from the first snapshot
+	NewObjects []ObjectRef `json:"newObjects,omitempty"`
+	// NewRequesters are the requesters missing from the first snapshot
+	NewRequesters []RequesterRef `json:"newRequesters,omitempty"`
+	// ResolvedObjects are the objects unresolved in the first snapshot, and
+	// resolved or removed in the second one
+	ResolvedObjects []ObjectRef `json:"resolvedObjects,omitempty"`
+	// Counts are the unresolved objects per kind
+	Counts []Count `json:"counts"`
+}
+
+// Compare returns the diff from a snapshot to another one
+func Compare(from, to Snapshot) Diff {
+	diff := Diff{
+		From:     from.Name,
+		FromTime: from.Time,
+		To:       to.Name,
+		ToTime:   to.Time,
+	}
+	fromObjects := index(from.Report)
+	toObjects := index(to.Report)
+	counts := make(map[ObjectRef]*Count)
+
+	for ref, obj := range toObjects {
+		count := countFor(counts, ref)
+		if obj.State != handler.ResolvedFinding {
+			count.To++
+		}
+
+		previous, found := fromObjects[ref]
+		if !found || previous.State == handler.ResolvedFinding {
+			if obj.State != handler.ResolvedFinding {
+				diff.NewObjects = append(diff.NewObjects, ref)
+			}
+		} else if obj.State == handler.ResolvedFinding {
+			diff.ResolvedObjects = append(diff.ResolvedObjects, ref)
+		}
+
+		known := make(map[string]bool)
+		if found {
+			for _, requester := range previous.RequesterList {
+				known[requester] = true
+			}
+		}
+		for _, requester := range obj.RequesterList {
+			if !known[requester] {
+				diff.NewRequesters = append(diff.NewRequesters, RequesterRef{ObjectRef: ref, Requester: requester})
+			}
+		}
+	}
+
+	for ref, obj := range fromObjects {
+		if obj.State == handler.ResolvedFinding {
+			continue
+		}
+		countFor(counts, ref).From++
+		if _, found := toObjects[ref]; !found {
+			diff.ResolvedObjects = append(diff.ResolvedObjects, ref)
+		}
+	}
+
+	for _, count := range counts {
+		diff.Counts = append(diff.Counts, *count)
+	}
+	sortRefs(diff.NewObjects)
+	sortRefs(diff.ResolvedObjects)
+	sort.Slice(diff.NewRequesters, func(i, j int) bool {
+		a, b := diff.NewRequesters[i], diff.NewRequesters[j]
+		if a.ObjectRef != b.ObjectRef {
+			return less(a.ObjectRef, b.ObjectRef)
+		}
+		return a.Requester < b.Requester
+	})
+	sort.Slice(diff.Counts, func(i, j int) bool {
+		a, b := diff.Counts[i], diff.Counts[j]
+		return a.Group+"/"+a.Version+"/"+a.Kind < b.Group+"/"+b.Version+"/"+b.Kind
+	})
+	return diff
+}
+
+// index maps the objects of a report by reference
+func index(report []handler.DeprecatedObjectList) map[ObjectRef]handler.DeprecatedObject {
+	objects := make(map[ObjectRef]handler.DeprecatedObject)
+	for _, objList := range report {
+		for _, obj := range objList.Objects {
+			objects[ObjectRef{
+				Group:     objList.Group,
+				Version:   objList.Version,
+				Kind:      objList.Kind,
+				Name:      obj.Name,
+				Namespace: obj.Namespace,
+			}] = obj
+		}
+	}
+	return objects
+}
+
+func countFor(counts map[ObjectRef]*Count, ref ObjectRef) *Count {
+	key := ObjectRef{Group: ref.Group, Version: ref.Version, Kind: ref.Kind}
+	if count, found := counts[key]; found {
+		return count
+	}
+	count := &Count{Group: ref.Group, Version: ref.Version, Kind: ref.Kind}
+	counts[key] = count
+	return count
+}
+
+func sortRefs(refs []ObjectRef) {
+	sort.Slice(refs, func(i, j int) bool {
+		return less(refs[i], refs[j])
+	})
+}
+
+func less(a, b ObjectRef) bool {
+	if a.Group+"/"+a.Version+"/"+a.Kind != b.Group+"/"+b.Version+"/"+b.Kind {
+		return a.Group+"/"+a.Version+"/"+a.Kind < b.Group+"/"+b.Version+"/"+b.Kind
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
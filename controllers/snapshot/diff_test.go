@@ -0,0 +1,131 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/horis233/k8s-deprecation-checker/controllers/handler"
+)
+
+func ingresses(objects ...handler.DeprecatedObject) handler.DeprecatedObjectList {
+	return handler.DeprecatedObjectList{Group: "extensions", Version: "v1beta1", Kind: "Ingress", Objects: objects}
+}
+
+func cronJobs(objects ...handler.DeprecatedObject) handler.DeprecatedObjectList {
+	return handler.DeprecatedObjectList{Group: "batch", Version: "v1beta1", Kind: "CronJob", Objects: objects}
+}
+
+func object(name string, state handler.FindingState, requesters ...string) handler.DeprecatedObject {
+	return handler.DeprecatedObject{Name: name, Namespace: "shop", RequesterList: requesters, State: state}
+}
+
+func ingress(name string) ObjectRef {
+	return ObjectRef{Group: "extensions", Version: "v1beta1", Kind: "Ingress", Name: name, Namespace: "shop"}
+}
+
+func cronJob(name string) ObjectRef {
+	return ObjectRef{Group: "batch", Version: "v1beta1", Kind: "CronJob", Name: name, Namespace: "shop"}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name          string
+		from, to      []handler.DeprecatedObjectList
+		newObjects    []ObjectRef
+		resolved      []ObjectRef
+		newRequesters []RequesterRef
+		counts        []Count
+	}{
+		{
+			name:   "unchanged",
+			from:   []handler.DeprecatedObjectList{ingresses(object("web", handler.ActiveFinding, "alice"))},
+			to:     []handler.DeprecatedObjectList{ingresses(object("web", handler.StaleFinding, "alice"))},
+			counts: []Count{{Group: "extensions", Version: "v1beta1", Kind: "Ingress", From: 1, To: 1}},
+		},
+		{
+			name:          "new object",
+			from:          nil,
+			to:            []handler.DeprecatedObjectList{ingresses(object("web", handler.ActiveFinding, "alice"))},
+			newObjects:    []ObjectRef{ingress("web")},
+			newRequesters: []RequesterRef{{ObjectRef: ingress("web"), Requester: "alice"}},
+			counts:        []Count{{Group: "extensions", Version: "v1beta1", Kind: "Ingress", From: 0, To: 1}},
+		},
+		{
+			name:       "resolved object used again",
+			from:       []handler.DeprecatedObjectList{ingresses(object("web", handler.ResolvedFinding, "alice"))},
+			to:         []handler.DeprecatedObjectList{ingresses(object("web", handler.ActiveFinding, "alice"))},
+			newObjects: []ObjectRef{ingress("web")},
+			counts:     []Count{{Group: "extensions", Version: "v1beta1", Kind: "Ingress", From: 0, To: 1}},
+		},
+		{
+			name:     "resolved object",
+			from:     []handler.DeprecatedObjectList{ingresses(object("web", handler.ActiveFinding, "alice"))},
+			to:       []handler.DeprecatedObjectList{ingresses(object("web", handler.ResolvedFinding, "alice"))},
+			resolved: []ObjectRef{ingress("web")},
+			counts:   []Count{{Group: "extensions", Version: "v1beta1", Kind: "Ingress", From: 1, To: 0}},
+		},
+		{
+			name:     "removed object",
+			from:     []handler.DeprecatedObjectList{ingresses(object("web", handler.StaleFinding, "alice"), object("api", handler.ActiveFinding, "bob"))},
+			to:       []handler.DeprecatedObjectList{ingresses(object("api", handler.ActiveFinding, "bob"))},
+			resolved: []ObjectRef{ingress("web")},
+			counts:   []Count{{Group: "extensions", Version: "v1beta1", Kind: "Ingress", From: 2, To: 1}},
+		},
+		{
+			name:     "pruned resolved object",
+			from:     []handler.DeprecatedObjectList{ingresses(object("web", handler.ResolvedFinding, "alice"))},
+			to:       nil,
+			resolved: nil,
+			counts:   nil,
+		},
+		{
+			name: "new requesters",
+			from: []handler.DeprecatedObjectList{ingresses(object("web", handler.ActiveFinding, "alice"))},
+			to:   []handler.DeprecatedObjectList{ingresses(object("web", handler.ActiveFinding, "carol", "alice", "bob"))},
+			newRequesters: []RequesterRef{
+				{ObjectRef: ingress("web"), Requester: "bob"},
+				{ObjectRef: ingress("web"), Requester: "carol"},
+			},
+			counts: []Count{{Group: "extensions", Version: "v1beta1", Kind: "Ingress", From: 1, To: 1}},
+		},
+		{
+			name: "counts per kind",
+			from: []handler.DeprecatedObjectList{
+				ingresses(object("web", handler.ActiveFinding), object("api", handler.ActiveFinding)),
+				cronJobs(object("backup", handler.ActiveFinding)),
+			},
+			to: []handler.DeprecatedObjectList{
+				ingresses(object("web", handler.ActiveFinding)),
+				cronJobs(object("backup", handler.StaleFinding), object("report", handler.ActiveFinding), object("clean", handler.ResolvedFinding)),
+			},
+			newObjects: []ObjectRef{cronJob("report")},
+			resolved:   []ObjectRef{ingress("api")},
+			counts: []Count{
+				{Group: "batch", Version: "v1beta1", Kind: "CronJob", From: 1, To: 2},
+				{Group: "extensions", Version: "v1beta1", Kind: "Ingress", From: 2, To: 1},
+			},
+		},
+	}
+
+	fromTime := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	toTime := fromTime.Add(24 * time.Hour)
+	for _, test := range tests {
+		diff := Compare(Snapshot{Name: "from", Time: fromTime, Report: test.from}, Snapshot{Name: "to", Time: toTime, Report: test.to})
+		if diff.From != "from" || diff.To != "to" || !diff.FromTime.Equal(fromTime) || !diff.ToTime.Equal(toTime) {
+			t.Errorf("%s: unexpected snapshots %s %s %s %s", test.name, diff.From, diff.FromTime, diff.To, diff.ToTime)
+		}
+		if !reflect.DeepEqual(diff.NewObjects, test.newObjects) {
+			t.Errorf("%s: new objects %v, expected %v", test.name, diff.NewObjects, test.newObjects)
+		}
+		if !reflect.DeepEqual(diff.ResolvedObjects, test.resolved) {
+			t.Errorf("%s: resolved objects %v, expected %v", test.name, diff.ResolvedObjects, test.resolved)
+		}
+		if !reflect.DeepEqual(diff.NewRequesters, test.newRequesters) {
+			t.Errorf("%s: new requesters %v, expected %v", test.name, diff.NewRequesters, test.newRequesters)
+		}
+		if !reflect.DeepEqual(diff.Counts, test.counts) {
+			t.Errorf("%s: counts %v, expected %v", test.name, diff.Counts, test.counts)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package snapshot
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	utilyaml "github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/horis233/k8s-deprecation-checker/controllers/handler"
+)
+
+const (
+	// namePrefix prefixes the names of the snapshots, followed by their time
+	namePrefix = handler.ReportName + "-snapshot-"
+	// nameTimeFormat is the format of the time in the names of the snapshots
+	nameTimeFormat = "20060102-150405"
+
+	// Label marks the config maps holding a snapshot
+	Label = "operator.horis233.com/report-snapshot"
+	// TimeAnnotation is the time a snapshot was taken, in RFC3339
+	TimeAnnotation = "operator.horis233.com/snapshot-time"
+	// DiffKey is the key of the diff with the previous snapshot
+	DiffKey = "diff.yaml"
+)
+
+// Snapshot is an immutable copy of the report
+type Snapshot struct {
+	Name   string
+	Time   time.Time
+	Report []handler.DeprecatedObjectList
+}
+
+// List returns the snapshots of a namespace, oldest first
+func List(ctx context.Context, reader client.Reader, namespace string) ([]Snapshot, error) {
+	list := &corev1.ConfigMapList{}
+	if err := reader.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels{Label: "true"}); err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, cm := range list.Items {
+		snapshot, err := fromConfigMap(&cm)
+		if err != nil {
+			klog.Errorf("Skipping snapshot %s: %v", cm.Name, err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Get returns a snapshot by name
+func Get(ctx context.Context, reader client.Reader, namespace, name string) (Snapshot, error) {
+	cm := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm); err != nil {
+		return Snapshot{}, err
+	}
+	return fromConfigMap(cm)
+}
+
+func fromConfigMap(cm *corev1.ConfigMap) (Snapshot, error) {
+	t, err := time.Parse(time.RFC3339, cm.Annotations[TimeAnnotation])
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot := Snapshot{Name: cm.Name, Time: t}
+	if err := utilyaml.Unmarshal([]byte(cm.Data[handler.ReportKey]), &snapshot.Report); err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// Take writes an immutable snapshot of the report when the last one is older
+// than interval, then deletes the oldest snapshots to keep the given number.
+// The snapshot holds the diff with the previous one.
+func Take(ctx context.Context, c client.Client, namespace string, report []handler.DeprecatedObjectList, interval time.Duration, keep int, now time.Time) error {
+	snapshots, err := List(ctx, c, namespace)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 || now.Sub(snapshots[len(snapshots)-1].Time) >= interval {
+		snapshot := Snapshot{
+			Name:   namePrefix + now.UTC().Format(nameTimeFormat),
+			Time:   now.UTC().Truncate(time.Second),
+			Report: report,
+		}
+		var previous *Snapshot
+		if len(snapshots) != 0 {
+			previous = &snapshots[len(snapshots)-1]
+		}
+		if err := create(ctx, c, namespace, snapshot, previous); err != nil {
+			return err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	for i := 0; i < len(snapshots)-keep; i++ {
+		klog.Infof("Deleting report snapshot %s", snapshots[i].Name)
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      snapshots[i].Name,
+				Namespace: namespace,
+			},
+		}
+		if err := c.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func create(ctx context.Context, c client.Client, namespace string, snapshot Snapshot, previous *Snapshot) error {
+	rawReport, err := utilyaml.Marshal(snapshot.Report)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{handler.ReportKey: string(rawReport)}
+	if previous != nil {
+		rawDiff, err := utilyaml.Marshal(Compare(*previous, snapshot))
+		if err != nil {
+			return err
+		}
+		data[DiffKey] = string(rawDiff)
+	}
+
+	immutable := true
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        snapshot.Name,
+			Namespace:   namespace,
+			Labels:      map[string]string{Label: "true"},
+			Annotations: map[string]string{TimeAnnotation: snapshot.Time.Format(time.RFC3339)},
+		},
+		Immutable: &immutable,
+		Data:      data,
+	}
+	klog.Infof("Taking report snapshot %s", snapshot.Name)
+	if err := c.Create(ctx, cm); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package useragent
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// unknownVersion is the version of client-go built without version
+// information, as in most controllers vendoring it
+const unknownVersion = "v0.0.0"
+
+// Client is the binary and the version of a client, parsed from its
+// user-agent, e.g. "manager/v0.0.0 (linux/amd64) kubernetes/$Format" or
+// "kubectl/v1.18.2 (linux/amd64) kubernetes/59603c6". The field managers the
+// apiserver derives from a user-agent only keep the binary, e.g. "kubectl".
+type Client struct {
+	Binary  string `json:"binary"`
+	Version string `json:"version,omitempty"`
+}
+
+// Parse parses a user-agent. The version is empty when it's unknown.
+func Parse(userAgent string) Client {
+	product := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(product, " \t"); i >= 0 {
+		product = product[:i]
+	}
+
+	parts := strings.SplitN(product, "/", 2)
+	client := Client{Binary: parts[0]}
+	if len(parts) == 2 && parts[1] != unknownVersion {
+		if _, err := version.ParseGeneric(parts[1]); err == nil {
+			client.Version = parts[1]
+		}
+	}
+	return client
+}
+
+// String returns the client as "binary/version"
+func (c Client) String() string {
+	if c.Version == "" {
+		return c.Binary
+	}
+	return c.Binary + "/" + c.Version
+}
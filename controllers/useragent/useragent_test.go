@@ -0,0 +1,25 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  Client
+	}{
+		{"kubectl/v1.18.2 (linux/amd64) kubernetes/59603c6", Client{Binary: "kubectl", Version: "v1.18.2"}},
+		{"manager/v0.0.0 (linux/amd64) kubernetes/$Format", Client{Binary: "manager"}},
+		{"foo-operator/v0.18.2", Client{Binary: "foo-operator", Version: "v0.18.2"}},
+		// the field managers derived by the apiserver only keep the binary
+		{"kubectl", Client{Binary: "kubectl"}},
+		{"kubectl-client-side-apply", Client{Binary: "kubectl-client-side-apply"}},
+		{"helm/not-a-version", Client{Binary: "helm"}},
+		{"  kubectl/v1.20.0  ", Client{Binary: "kubectl", Version: "v1.20.0"}},
+		{"", Client{}},
+	}
+	for _, test := range tests {
+		if client := Parse(test.userAgent); client != test.expected {
+			t.Errorf("Parse(%q) = %+v, expected %+v", test.userAgent, client, test.expected)
+		}
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
 )
 
 // GetOperatorNamespace returns the namespace the operator should be running in.
@@ -25,3 +29,20 @@ func GetOperatorNamespace() (string, error) {
 	}
 	return ns, nil
 }
+
+// GetClusterVersion returns the major and minor version of the cluster, as "v1.21"
+func GetClusterVersion(config *rest.Config) (string, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return "", err
+	}
+	info, err := dc.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("v%d.%d", v.Major(), v.Minor()), nil
+}
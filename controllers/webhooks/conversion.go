@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"context"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// conversionPath is the path of the conversion webhook, the one the
+// WebhookBuilder would use
+const conversionPath = "/convert"
+
+// AddConversion adds a CRD whose versions are converted by the webhook server.
+// It must be called before SetupServer, which registers the conversion
+// endpoint, the CRD is pointed to the server on each reconciliation.
+func (webhookConfig *CSWebhookConfig) AddConversion(crdName string) {
+	webhookConfig.lock.Lock()
+	defer webhookConfig.lock.Unlock()
+
+	webhookConfig.conversions[crdName] = true
+}
+
+// reconcileConversion sets the conversion of a CRD to the webhook server. The
+// CRD is installed with the operator, so it's never created.
+func reconcileConversion(ctx context.Context, client k8sclient.Client, crdName, namespace string, caBundle []byte) (controllerutil.OperationResult, error) {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := client.Get(ctx, k8sclient.ObjectKey{Name: crdName}, crd); err != nil {
+		if errors.IsNotFound(err) {
+			klog.Warningf("CRD %s not found, skipping its conversion", crdName)
+			return controllerutil.OperationResultNone, nil
+		}
+		return controllerutil.OperationResultNone, err
+	}
+
+	path := conversionPath
+	port := int32(servicePort)
+	conversion := &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Namespace: namespace,
+					Name:      operatorPodServiceName,
+					Path:      &path,
+					Port:      &port,
+				},
+				CABundle: caBundle,
+			},
+			ConversionReviewVersions: []string{"v1", "v1beta1"},
+		},
+	}
+	if equality.Semantic.DeepEqual(crd.Spec.Conversion, conversion) {
+		return controllerutil.OperationResultNone, nil
+	}
+
+	klog.Infof("Updating the conversion of CRD %s", crdName)
+	crd.Spec.Conversion = conversion
+	if err := client.Update(ctx, crd); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return controllerutil.OperationResultUpdated, nil
+}
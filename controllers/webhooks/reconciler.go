@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog"
 	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -19,7 +20,9 @@ type WebhookReconciler interface {
 	SetWebhookName(webhookName string)
 	SetRule(rules []RuleWithOperations)
 	SetNsSelector(selector v1.LabelSelector)
-	Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error
+	SetPolicy(policy WebhookPolicy)
+	Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) (Changes, error)
+	Delete(ctx context.Context, client k8sclient.Client) error
 }
 
 type CompositeWebhookReconciler struct {
@@ -50,9 +53,28 @@ func (reconciler *CompositeWebhookReconciler) SetNsSelector(selector v1.LabelSel
 	}
 }
 
-func (reconciler *CompositeWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error {
+func (reconciler *CompositeWebhookReconciler) SetPolicy(policy WebhookPolicy) {
 	for _, innerReconciler := range reconciler.Reconcilers {
-		if err := innerReconciler.Reconcile(ctx, client, caBundle); err != nil {
+		innerReconciler.SetPolicy(policy)
+	}
+}
+
+func (reconciler *CompositeWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) (Changes, error) {
+	var changes Changes
+	for _, innerReconciler := range reconciler.Reconcilers {
+		innerChanges, err := innerReconciler.Reconcile(ctx, client, caBundle)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, innerChanges...)
+	}
+
+	return changes, nil
+}
+
+func (reconciler *CompositeWebhookReconciler) Delete(ctx context.Context, client k8sclient.Client) error {
+	for _, innerReconciler := range reconciler.Reconcilers {
+		if err := innerReconciler.Delete(ctx, client); err != nil {
 			return err
 		}
 	}
@@ -65,6 +87,7 @@ type ValidatingWebhookReconciler struct {
 	name              string
 	webhookName       string
 	rules             []RuleWithOperations
+	policy            WebhookPolicy
 	NameSpaceSelector v1.LabelSelector
 }
 
@@ -73,22 +96,27 @@ type MutatingWebhookReconciler struct {
 	name              string
 	webhookName       string
 	rules             []RuleWithOperations
+	policy            WebhookPolicy
 	NameSpaceSelector v1.LabelSelector
 }
 
 //Reconcile MutatingWebhookConfiguration
-func (reconciler *MutatingWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error {
+func (reconciler *MutatingWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) (Changes, error) {
 	var (
 		sideEffects    = admissionregistrationv1.SideEffectClassNone
 		port           = int32(servicePort)
-		matchPolicy    = admissionregistrationv1.Exact
-		ignorePolicy   = admissionregistrationv1.Ignore
-		timeoutSeconds = int32(10)
+		policy         = reconciler.policy.withDefaults()
+		matchPolicy    = policy.MatchPolicy
+		failurePolicy  = policy.FailurePolicy
+		timeoutSeconds = policy.TimeoutSeconds
+		// Set the defaults of the apiserver, so an unchanged configuration
+		// is not updated
+		reinvocationPolicy = admissionregistrationv1.NeverReinvocationPolicy
 	)
 
 	namespace, err := utils.GetOperatorNamespace()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cr := &admissionregistrationv1.MutatingWebhookConfiguration{
@@ -113,7 +141,7 @@ func (reconciler *MutatingWebhookReconciler) Reconcile(ctx context.Context, clie
 				Scope:       &scope,
 			}})
 	}
-	_, err = controllerutil.CreateOrUpdate(ctx, client, cr, func() error {
+	result, err := controllerutil.CreateOrUpdate(ctx, client, cr, func() error {
 		cr.Webhooks = []admissionregistrationv1.MutatingWebhook{
 			{
 				Name:        fmt.Sprintf("%s", reconciler.webhookName),
@@ -129,9 +157,11 @@ func (reconciler *MutatingWebhookReconciler) Reconcile(ctx context.Context, clie
 				},
 				Rules:                   webhokRules,
 				MatchPolicy:             &matchPolicy,
+				ObjectSelector:          &v1.LabelSelector{},
 				AdmissionReviewVersions: []string{"v1", "v1beta1"},
-				FailurePolicy:           &ignorePolicy,
+				FailurePolicy:           &failurePolicy,
 				TimeoutSeconds:          &timeoutSeconds,
+				ReinvocationPolicy:      &reinvocationPolicy,
 			},
 		}
 		for index := range cr.Webhooks {
@@ -141,23 +171,27 @@ func (reconciler *MutatingWebhookReconciler) Reconcile(ctx context.Context, clie
 	})
 	if err != nil {
 		klog.Error(err)
+		return nil, err
 	}
-	return err
+	var changes Changes
+	changes.add("MutatingWebhookConfiguration", reconciler.name, result)
+	return changes, nil
 }
 
 //Reconcile ValidatingWebhookConfiguration
-func (reconciler *ValidatingWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) error {
+func (reconciler *ValidatingWebhookReconciler) Reconcile(ctx context.Context, client k8sclient.Client, caBundle []byte) (Changes, error) {
 	var (
 		sideEffects    = admissionregistrationv1.SideEffectClassNone
 		port           = int32(servicePort)
-		matchPolicy    = admissionregistrationv1.Exact
-		failurePolicy  = admissionregistrationv1.Fail
-		timeoutSeconds = int32(10)
+		policy         = reconciler.policy.withDefaults()
+		matchPolicy    = policy.MatchPolicy
+		failurePolicy  = policy.FailurePolicy
+		timeoutSeconds = policy.TimeoutSeconds
 	)
 
 	namespace, err := utils.GetOperatorNamespace()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cr := &admissionregistrationv1.ValidatingWebhookConfiguration{
@@ -183,7 +217,7 @@ func (reconciler *ValidatingWebhookReconciler) Reconcile(ctx context.Context, cl
 	}
 
 	klog.Infof("Creating/Updating ValidatingWebhook %s", fmt.Sprintf("%s", reconciler.name))
-	_, err = controllerutil.CreateOrUpdate(ctx, client, cr, func() error {
+	result, err := controllerutil.CreateOrUpdate(ctx, client, cr, func() error {
 		cr.Webhooks = []admissionregistrationv1.ValidatingWebhook{
 			{
 				Name:        fmt.Sprintf("%s", reconciler.webhookName),
@@ -199,6 +233,7 @@ func (reconciler *ValidatingWebhookReconciler) Reconcile(ctx context.Context, cl
 				},
 				Rules:                   webhokRules,
 				MatchPolicy:             &matchPolicy,
+				ObjectSelector:          &v1.LabelSelector{},
 				AdmissionReviewVersions: []string{"v1", "v1beta1"},
 				FailurePolicy:           &failurePolicy,
 				TimeoutSeconds:          &timeoutSeconds,
@@ -211,8 +246,43 @@ func (reconciler *ValidatingWebhookReconciler) Reconcile(ctx context.Context, cl
 	})
 	if err != nil {
 		klog.Error(err)
+		return nil, err
 	}
-	return err
+	var changes Changes
+	changes.add("ValidatingWebhookConfiguration", reconciler.name, result)
+	return changes, nil
+}
+
+// Delete MutatingWebhookConfiguration
+func (reconciler *MutatingWebhookReconciler) Delete(ctx context.Context, client k8sclient.Client) error {
+	cr := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: v1.ObjectMeta{
+			Name: reconciler.name,
+		},
+	}
+
+	klog.Infof("Deleting MutatingWebhook %s", reconciler.name)
+	if err := client.Delete(ctx, cr); err != nil && !errors.IsNotFound(err) {
+		klog.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Delete ValidatingWebhookConfiguration
+func (reconciler *ValidatingWebhookReconciler) Delete(ctx context.Context, client k8sclient.Client) error {
+	cr := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: v1.ObjectMeta{
+			Name: reconciler.name,
+		},
+	}
+
+	klog.Infof("Deleting ValidatingWebhook %s", reconciler.name)
+	if err := client.Delete(ctx, cr); err != nil && !errors.IsNotFound(err) {
+		klog.Error(err)
+		return err
+	}
+	return nil
 }
 
 func (reconciler *ValidatingWebhookReconciler) SetName(name string) {
@@ -246,3 +316,11 @@ func (reconciler *MutatingWebhookReconciler) SetNsSelector(selector v1.LabelSele
 func (reconciler *ValidatingWebhookReconciler) SetNsSelector(selector v1.LabelSelector) {
 	reconciler.NameSpaceSelector = selector
 }
+
+func (reconciler *MutatingWebhookReconciler) SetPolicy(policy WebhookPolicy) {
+	reconciler.policy = policy
+}
+
+func (reconciler *ValidatingWebhookReconciler) SetPolicy(policy WebhookPolicy) {
+	reconciler.policy = policy
+}
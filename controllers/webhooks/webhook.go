@@ -1,13 +1,19 @@
 package webhooks
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/operator-framework/operator-lifecycle-manager/pkg/lib/ownerutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -18,6 +24,8 @@ import (
 	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
 
 	"github.com/horis233/k8s-deprecation-checker/controllers/utils"
 )
@@ -32,7 +40,13 @@ type CSWebhookConfig struct {
 	CertDir     string
 	CAConfigMap string
 
-	Webhooks []CSWebhook
+	// webhooks registered into the server, keyed by name. The registration
+	// is done once, while the rules and the policy of a webhook are updated
+	// on each reconciliation.
+	webhooks map[string]CSWebhook
+	// names of the CRDs converted by the server
+	conversions map[string]bool
+	lock        sync.RWMutex
 }
 
 // CSWebhook acts as a single source of truth for validating webhooks
@@ -53,6 +67,31 @@ type CSWebhook struct {
 	Register WebhookRegister
 
 	NsSelector v1.LabelSelector
+
+	// Policy for the apiserver calling the webhook
+	Policy WebhookPolicy
+}
+
+// WebhookPolicy configures how the apiserver calls a webhook. Empty values
+// are defaulted to a policy that doesn't block the cluster when the operator
+// is unavailable.
+type WebhookPolicy struct {
+	FailurePolicy  admissionregistrationv1.FailurePolicyType
+	MatchPolicy    admissionregistrationv1.MatchPolicyType
+	TimeoutSeconds int32
+}
+
+func (policy WebhookPolicy) withDefaults() WebhookPolicy {
+	if policy.FailurePolicy == "" {
+		policy.FailurePolicy = admissionregistrationv1.Ignore
+	}
+	if policy.MatchPolicy == "" {
+		policy.MatchPolicy = admissionregistrationv1.Exact
+	}
+	if policy.TimeoutSeconds == 0 {
+		policy.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	return policy
 }
 
 const (
@@ -63,6 +102,8 @@ const (
 	caConfigMap            = "deprecated-api-checker-webhook-ca"
 	caConfigMapAnnotation  = "service.beta.openshift.io/inject-cabundle"
 	caServiceAnnotation    = "service.beta.openshift.io/serving-cert-secret-name"
+	certSecretName         = "cs-webhook-cert"
+	defaultTimeoutSeconds  = 5
 )
 
 // Config is a global instance. The same instance is needed in order to use the
@@ -78,13 +119,27 @@ var Config *CSWebhookConfig = &CSWebhookConfig{
 	// Name of the config map where the CA certificate is injected
 	CAConfigMap: caConfigMap,
 
-	// List of webhooks to configure
-	Webhooks: []CSWebhook{},
+	// Webhooks to configure, keyed by name
+	webhooks: map[string]CSWebhook{},
+
+	// CRDs to point to the conversion webhook
+	conversions: map[string]bool{},
+}
+
+// Changes lists the resources created or updated by a reconciliation, as
+// "Kind/name"
+type Changes []string
+
+func (changes *Changes) add(kind, name string, result controllerutil.OperationResult) {
+	if result != controllerutil.OperationResultNone {
+		*changes = append(*changes, kind+"/"+name)
+	}
 }
 
 // SetupServer sets up the webhook server managed by mgr with the settings from
 // webhookConfig. It sets the port and cert dir based on the settings and
-// registers the Validator implementations from each webhook from webhookConfig.Webhooks
+// registers the Validator implementations from each webhook added to
+// webhookConfig. It must be called once, before starting the manager.
 func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager, namespace string) error {
 	// Create a new client to reconcile the Service. `mgr.GetClient()` can't
 	// be used as it relies on the cache that hasn't been initialized yet
@@ -96,7 +151,7 @@ func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager, namespace
 	}
 
 	// Create the service pointing to the operator pod
-	if err := webhookConfig.ReconcileService(context.TODO(), client, nil, namespace); err != nil {
+	if _, err := webhookConfig.ReconcileService(context.TODO(), client, nil, namespace); err != nil {
 		return err
 	}
 	// Get the secret with the certificates for the service
@@ -109,15 +164,48 @@ func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager, namespace
 	webhookServer.CertDir = webhookConfig.CertDir
 	webhookConfig.scheme = mgr.GetScheme()
 
-	bldr := builder.WebhookManagedBy(mgr)
+	if err := webhookConfig.registerToServer(webhookServer); err != nil {
+		return err
+	}
 
-	for _, webhook := range webhookConfig.Webhooks {
+	// The builder fails without an object, it's only completed when an
+	// ObjectWebhookRegister adds one
+	bldr := builder.WebhookManagedBy(mgr)
+	withObject := false
+	for _, webhook := range webhookConfig.list() {
 		bldr = webhook.Register.RegisterToBuilder(bldr)
-		webhook.Register.RegisterToServer(webhookConfig.scheme, webhookServer)
+		switch webhook.Register.(type) {
+		case ObjectWebhookRegister, *ObjectWebhookRegister:
+			withObject = true
+		}
+	}
+	if !withObject {
+		return nil
 	}
+	return bldr.Complete()
+}
 
-	bldr.Complete()
+// registerToServer registers the conversion webhook when CRDs are converted,
+// and the webhooks which aren't registered by the builder. The conversion
+// webhook is registered here rather than by the builder, which only does it
+// for the objects of the ObjectWebhookRegisters.
+func (webhookConfig *CSWebhookConfig) registerToServer(srv *webhook.Server) error {
+	webhookConfig.lock.RLock()
+	converted := len(webhookConfig.conversions) != 0
+	webhookConfig.lock.RUnlock()
+	if converted {
+		hook := &conversion.Webhook{}
+		if err := hook.InjectScheme(webhookConfig.scheme); err != nil {
+			return err
+		}
+		srv.Register(conversionPath, hook)
+	}
 
+	for _, webhook := range webhookConfig.list() {
+		if err := webhook.Register.RegisterToServer(webhookConfig.scheme, srv); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -127,16 +215,30 @@ func (webhookConfig *CSWebhookConfig) SetupServer(mgr manager.Manager, namespace
 // It reconciles a Service that exposes the webhook server
 // A ownerRef to the owner parameter is set on the reconciled resources. This
 // parameter is optional, if `nil` is passed, no ownerReference will be set
-func (webhookConfig *CSWebhookConfig) Reconcile(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner) error {
+// The resources that had to be created or updated, including the certificates
+// saved from the Secret, are returned.
+func (webhookConfig *CSWebhookConfig) Reconcile(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner) (Changes, error) {
+	var changes Changes
 
 	namespace, err := utils.GetOperatorNamespace()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Reconcile the Service
-	if err := webhookConfig.ReconcileService(ctx, client, owner, namespace); err != nil {
-		return err
+	result, err := webhookConfig.ReconcileService(ctx, client, owner, namespace)
+	if err != nil {
+		return nil, err
+	}
+	changes.add("Service", operatorPodServiceName, result)
+
+	// Save the certificates again if the Secret has been rotated
+	certsChanged, err := webhookConfig.syncCerts(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if certsChanged {
+		changes.add("Secret", certSecretName, controllerutil.OperationResultUpdated)
 	}
 
 	// Create (if it doesn't exist) the config map where the CA certificate is
@@ -145,48 +247,146 @@ func (webhookConfig *CSWebhookConfig) Reconcile(ctx context.Context, client k8sc
 		ObjectMeta: v1.ObjectMeta{
 			Name:      webhookConfig.CAConfigMap,
 			Namespace: namespace,
-			Annotations: map[string]string{
-				caConfigMapAnnotation: "true",
-			},
 		},
 	}
 
 	klog.Info("Creating deprcated api checker webhook CA ConfigMap")
-	err = client.Create(ctx, caConfigMap)
-	if err != nil && !errors.IsAlreadyExists(err) {
+	result, err = controllerutil.CreateOrUpdate(ctx, client, caConfigMap, func() error {
+		if owner := namespacedOwner(owner, namespace); owner != nil {
+			ownerutil.EnsureOwner(caConfigMap, owner)
+		}
+
+		if caConfigMap.Annotations == nil {
+			caConfigMap.Annotations = map[string]string{}
+		}
+		caConfigMap.Annotations[caConfigMapAnnotation] = "true"
+		return nil
+	})
+	if err != nil {
 		klog.Error(err)
-		return err
+		return nil, err
 	}
+	changes.add("ConfigMap", webhookConfig.CAConfigMap, result)
 
 	// Wait for the config map to be injected with the CA
 	caBundle, err := webhookConfig.waitForCAInConfigMap(ctx, client, namespace)
 	if err != nil {
 		klog.Error(err)
-		return err
+		return nil, err
 	}
 
 	// Reconcile the webhooks
-	for _, webhook := range webhookConfig.Webhooks {
+	for _, webhook := range webhookConfig.list() {
 		reconciler, err := webhook.Register.GetReconciler(webhookConfig.scheme)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		reconciler.SetName(webhook.Name)
 		reconciler.SetWebhookName(webhook.WebhookName)
 		reconciler.SetRule(webhook.Rules)
 		reconciler.SetNsSelector(webhook.NsSelector)
+		reconciler.SetPolicy(webhook.Policy)
 		klog.Infof("Reconciling webhook %s", webhook.Name)
-		if err := reconciler.Reconcile(ctx, client, caBundle); err != nil {
+		webhookChanges, err := reconciler.Reconcile(ctx, client, caBundle)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, webhookChanges...)
+	}
+
+	// Point the CRDs to the conversion webhook
+	for _, crdName := range webhookConfig.listConversions() {
+		result, err := reconcileConversion(ctx, client, crdName, namespace, caBundle)
+		if err != nil {
+			return nil, err
+		}
+		changes.add("CustomResourceDefinition", crdName, result)
+	}
+
+	return changes, nil
+}
+
+// IsManaged tells if obj is one of the resources reconciled by webhookConfig
+func (webhookConfig *CSWebhookConfig) IsManaged(obj k8sclient.Object) bool {
+	namespace, err := utils.GetOperatorNamespace()
+	if err != nil {
+		return false
+	}
+
+	switch obj.(type) {
+	case *admissionregistrationv1.ValidatingWebhookConfiguration, *admissionregistrationv1.MutatingWebhookConfiguration:
+		webhookConfig.lock.RLock()
+		defer webhookConfig.lock.RUnlock()
+		_, found := webhookConfig.webhooks[obj.GetName()]
+		return found
+	case *apiextensionsv1.CustomResourceDefinition:
+		webhookConfig.lock.RLock()
+		defer webhookConfig.lock.RUnlock()
+		return webhookConfig.conversions[obj.GetName()]
+	case *corev1.Service:
+		return obj.GetNamespace() == namespace && obj.GetName() == operatorPodServiceName
+	case *corev1.ConfigMap:
+		return obj.GetNamespace() == namespace && obj.GetName() == webhookConfig.CAConfigMap
+	case *corev1.Secret:
+		return obj.GetNamespace() == namespace && obj.GetName() == certSecretName
+	}
+	return false
+}
+
+// Cleanup deletes the webhook configurations of each webhook added to
+// webhookConfig, the Service exposing the webhook server and the config map of
+// the CA certificate
+func (webhookConfig *CSWebhookConfig) Cleanup(ctx context.Context, client k8sclient.Client, namespace string) error {
+	for _, webhook := range webhookConfig.list() {
+		reconciler, err := webhook.Register.GetReconciler(webhookConfig.scheme)
+		if err != nil {
+			return err
+		}
+
+		reconciler.SetName(webhook.Name)
+		klog.Infof("Cleaning up webhook %s", webhook.Name)
+		if err := reconciler.Delete(ctx, client); err != nil {
 			return err
 		}
 	}
 
+	klog.Info("Deleting deprcated api checker webhook service")
+	service := &corev1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      operatorPodServiceName,
+			Namespace: namespace,
+		},
+	}
+	if err := client.Delete(ctx, service); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	klog.Info("Deleting deprcated api checker webhook CA ConfigMap")
+	caConfigMap := &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      webhookConfig.CAConfigMap,
+			Namespace: namespace,
+		},
+	}
+	if err := client.Delete(ctx, caConfigMap); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
 	return nil
 }
 
+// namespacedOwner returns owner when it lives in namespace, nil otherwise, as
+// an ownerReference can't point to an object of another namespace
+func namespacedOwner(owner ownerutil.Owner, namespace string) ownerutil.Owner {
+	if owner == nil || owner.GetNamespace() != namespace {
+		return nil
+	}
+	return owner
+}
+
 // ReconcileService creates or updates the service that points to the Pod
-func (webhookConfig *CSWebhookConfig) ReconcileService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner, namespace string) error {
+func (webhookConfig *CSWebhookConfig) ReconcileService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner, namespace string) (controllerutil.OperationResult, error) {
 
 	klog.Info("Reconciling deprcated api checker webhook service")
 	// Get the service. If it's not found, create it
@@ -196,7 +396,7 @@ func (webhookConfig *CSWebhookConfig) ReconcileService(ctx context.Context, clie
 		Name:      operatorPodServiceName,
 	}, service); err != nil {
 		if !errors.IsNotFound(err) {
-			return err
+			return controllerutil.OperationResultNone, err
 		}
 
 		return createService(ctx, client, owner, namespace)
@@ -205,14 +405,14 @@ func (webhookConfig *CSWebhookConfig) ReconcileService(ctx context.Context, clie
 	// If the existing service has a different .spec.clusterIP value, delete it
 	if service.Spec.ClusterIP != "None" {
 		if err := client.Delete(ctx, service); err != nil {
-			return err
+			return controllerutil.OperationResultNone, err
 		}
 	}
 
 	return createService(ctx, client, owner, namespace)
 }
 
-func createService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner, namespace string) error {
+func createService(ctx context.Context, client k8sclient.Client, owner ownerutil.Owner, namespace string) (controllerutil.OperationResult, error) {
 	klog.Info("Creating deprcated api checker webhook service")
 
 	service := &corev1.Service{
@@ -221,15 +421,15 @@ func createService(ctx context.Context, client k8sclient.Client, owner ownerutil
 			Namespace: namespace,
 		},
 	}
-	_, err := controllerutil.CreateOrUpdate(ctx, client, service, func() error {
-		if owner != nil {
+	result, err := controllerutil.CreateOrUpdate(ctx, client, service, func() error {
+		if owner := namespacedOwner(owner, namespace); owner != nil {
 			ownerutil.EnsureOwner(service, owner)
 		}
 
 		if service.Annotations == nil {
 			service.Annotations = map[string]string{}
 		}
-		service.Annotations[caServiceAnnotation] = "cs-webhook-cert"
+		service.Annotations[caServiceAnnotation] = certSecretName
 		service.Spec.ClusterIP = "None"
 		service.Spec.Selector = map[string]string{
 			"name": "deprecated-api-checker",
@@ -247,7 +447,7 @@ func createService(ctx context.Context, client k8sclient.Client, owner ownerutil
 	if err != nil {
 		klog.Error(err)
 	}
-	return err
+	return result, err
 }
 
 // setupCerts waits for the secret created for the operator Service to exist, and
@@ -256,7 +456,7 @@ func (webhookConfig *CSWebhookConfig) setupCerts(ctx context.Context, client k8s
 	// Wait for the secret to te created
 	secret := &corev1.Secret{}
 	err := wait.PollImmediate(time.Second*1, time.Second*30, func() (bool, error) {
-		err := client.Get(ctx, k8sclient.ObjectKey{Namespace: namespace, Name: "cs-webhook-cert"}, secret)
+		err := client.Get(ctx, k8sclient.ObjectKey{Namespace: namespace, Name: certSecretName}, secret)
 		if err != nil {
 			if errors.IsNotFound(err) {
 				return false, nil
@@ -271,11 +471,37 @@ func (webhookConfig *CSWebhookConfig) setupCerts(ctx context.Context, client k8s
 	}
 
 	// Save the key
-	if err := webhookConfig.saveCertFromSecret(secret.Data, "tls.key"); err != nil {
+	if _, err := webhookConfig.saveCertFromSecret(secret.Data, "tls.key"); err != nil {
 		return err
 	}
 	// Save the cert
-	return webhookConfig.saveCertFromSecret(secret.Data, "tls.crt")
+	_, err = webhookConfig.saveCertFromSecret(secret.Data, "tls.crt")
+	return err
+}
+
+// syncCerts saves the certificates again when the secret created for the
+// operator Service doesn't match the ones in webhookConfig.CertDir, so a
+// rotated or recreated certificate is picked up by the webhook server
+func (webhookConfig *CSWebhookConfig) syncCerts(ctx context.Context, client k8sclient.Client, namespace string) (bool, error) {
+	secret := &corev1.Secret{}
+	if err := client.Get(ctx, k8sclient.ObjectKey{Namespace: namespace, Name: certSecretName}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			// The certificate is being regenerated, the Secret will be
+			// synced when it's created
+			return false, nil
+		}
+		return false, err
+	}
+
+	keyChanged, err := webhookConfig.saveCertFromSecret(secret.Data, "tls.key")
+	if err != nil {
+		return false, err
+	}
+	certChanged, err := webhookConfig.saveCertFromSecret(secret.Data, "tls.crt")
+	if err != nil {
+		return false, err
+	}
+	return keyChanged || certChanged, nil
 }
 
 func (webhookConfig *CSWebhookConfig) waitForCAInConfigMap(ctx context.Context, client k8sclient.Client, namespace string) ([]byte, error) {
@@ -310,24 +536,82 @@ func (webhookConfig *CSWebhookConfig) waitForCAInConfigMap(ctx context.Context,
 }
 
 // AddWebhook adds a webhook configuration to a webhookSettings. This must be done before
-// starting the server as it registers the endpoints for the validation
+// starting the server as it registers the endpoints for the validation. A
+// webhook with the same name is replaced.
 func (webhookConfig *CSWebhookConfig) AddWebhook(webhook CSWebhook) {
-	webhookConfig.Webhooks = append(webhookConfig.Webhooks, webhook)
+	webhookConfig.lock.Lock()
+	defer webhookConfig.lock.Unlock()
+
+	webhookConfig.webhooks[webhook.Name] = webhook
+}
+
+// ConfigureWebhook updates the rules, the namespace selector and the policy of
+// a webhook added to webhookConfig. The endpoint registered in the server is
+// kept, the changes are applied to the webhook configuration on the next
+// reconciliation.
+func (webhookConfig *CSWebhookConfig) ConfigureWebhook(name string, rules []RuleWithOperations, nsSelector v1.LabelSelector, policy WebhookPolicy) error {
+	webhookConfig.lock.Lock()
+	defer webhookConfig.lock.Unlock()
+
+	webhook, found := webhookConfig.webhooks[name]
+	if !found {
+		return fmt.Errorf("webhook %s is not registered", name)
+	}
+	webhook.Rules = rules
+	webhook.NsSelector = nsSelector
+	webhook.Policy = policy
+	webhookConfig.webhooks[name] = webhook
+	return nil
+}
+
+// list returns a copy of the webhooks sorted by name
+func (webhookConfig *CSWebhookConfig) list() []CSWebhook {
+	webhookConfig.lock.RLock()
+	defer webhookConfig.lock.RUnlock()
+
+	webhooks := make([]CSWebhook, 0, len(webhookConfig.webhooks))
+	for _, webhook := range webhookConfig.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].Name < webhooks[j].Name
+	})
+	return webhooks
 }
 
-func (webhookConfig *CSWebhookConfig) saveCertFromSecret(secretData map[string][]byte, fileName string) error {
+// listConversions returns the sorted names of the CRDs converted by the server
+func (webhookConfig *CSWebhookConfig) listConversions() []string {
+	webhookConfig.lock.RLock()
+	defer webhookConfig.lock.RUnlock()
+
+	crdNames := make([]string, 0, len(webhookConfig.conversions))
+	for crdName := range webhookConfig.conversions {
+		crdNames = append(crdNames, crdName)
+	}
+	sort.Strings(crdNames)
+	return crdNames
+}
+
+// saveCertFromSecret saves the file unless it already has the same content,
+// and tells if it has been written
+func (webhookConfig *CSWebhookConfig) saveCertFromSecret(secretData map[string][]byte, fileName string) (bool, error) {
 	value, ok := secretData[fileName]
 	if !ok {
-		return fmt.Errorf("Secret does not contain key %s", fileName)
+		return false, fmt.Errorf("Secret does not contain key %s", fileName)
+	}
+
+	path := fmt.Sprintf("%s/%s", webhookConfig.CertDir, fileName)
+	if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, value) {
+		return false, nil
 	}
 
 	// Save the key
-	f, err := os.Create(fmt.Sprintf("%s/%s", webhookConfig.CertDir, fileName))
+	f, err := os.Create(path)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer f.Close()
 
 	_, err = f.Write(value)
-	return err
+	return err == nil, err
 }
@@ -53,7 +53,9 @@ func (vwr ObjectWebhookRegister) RegisterToBuilder(bldr *builder.WebhookBuilder)
 }
 
 // RegisterToServer does nothing, as the register is done by the builder
-func (vwr ObjectWebhookRegister) RegisterToServer(_ *runtime.Scheme, _ *webhook.Server) {}
+func (vwr ObjectWebhookRegister) RegisterToServer(_ *runtime.Scheme, _ *webhook.Server) error {
+	return nil
+}
 
 // GetReconciler creates a reconciler according to the implementation of vwr.Object.
 // The object can implement the `Validator` or `Defaulter` interfaces, and if both
@@ -114,6 +116,82 @@ func generatePath(prefix string, gvk schema.GroupVersionKind) string {
 	return path
 }
 
+// HandlerWebhookRegister registers the handlers defaulting and validating an
+// object into the paths the WebhookBuilder would use for it. It is used when
+// the webhooks need more than the `Defaulter` and `Validator` interfaces of
+// the object, like a client.
+type HandlerWebhookRegister struct {
+	Object     runtime.Object
+	Defaulting admission.Handler
+	Validating admission.Handler
+}
+
+// RegisterToBuilder does not mutate the WebhookBuilder
+func (hwr HandlerWebhookRegister) RegisterToBuilder(bldr *builder.WebhookBuilder) *builder.WebhookBuilder {
+	return bldr
+}
+
+// RegisterToServer registers the handlers of `hwr` to their paths. The server
+// panics if a path is registered twice, so it must only be called once.
+func (hwr HandlerWebhookRegister) RegisterToServer(scheme *runtime.Scheme, srv *webhook.Server) error {
+	paths, err := hwr.getPaths(scheme)
+	if err != nil {
+		return err
+	}
+	for path, handler := range map[string]admission.Handler{paths.mutating: hwr.Defaulting, paths.validating: hwr.Validating} {
+		if path == "" {
+			continue
+		}
+		hook := &admission.Webhook{Handler: handler}
+		if err := hook.InjectScheme(scheme); err != nil {
+			return err
+		}
+		srv.Register(path, hook)
+	}
+	return nil
+}
+
+// GetReconciler creates a reconciler for each handler of hwr, like for an
+// ObjectWebhookRegister
+func (hwr HandlerWebhookRegister) GetReconciler(scheme *runtime.Scheme) (WebhookReconciler, error) {
+	paths, err := hwr.getPaths(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	reconcilers := []WebhookReconciler{}
+	if paths.mutating != "" {
+		reconcilers = append(reconcilers, &MutatingWebhookReconciler{
+			Path: paths.mutating,
+		})
+	}
+	if paths.validating != "" {
+		reconcilers = append(reconcilers, &ValidatingWebhookReconciler{
+			Path: paths.validating,
+		})
+	}
+
+	return &CompositeWebhookReconciler{
+		Reconcilers: reconcilers,
+	}, nil
+}
+
+func (hwr HandlerWebhookRegister) getPaths(scheme *runtime.Scheme) (*valueForType, error) {
+	gvk, err := apiutil.GVKForObject(hwr.Object, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &valueForType{}
+	if hwr.Defaulting != nil {
+		result.mutating = generatePath("mutate", gvk)
+	}
+	if hwr.Validating != nil {
+		result.validating = generatePath("validate", gvk)
+	}
+	return result, nil
+}
+
 // WebhookType represents the type of webhook configuration to reconcile. Can
 // be ValidatingType or MutatingType
 type WebhookType string
@@ -139,12 +217,9 @@ func (awr AdmissionWebhookRegister) RegisterToBuilder(bldr *builder.WebhookBuild
 	return bldr
 }
 
-// RegisterToServer regsiters the webhook to the path of `awr`
-func (awr AdmissionWebhookRegister) RegisterToServer(scheme *runtime.Scheme, srv *webhook.Server) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-		}
-	}()
+// RegisterToServer regsiters the webhook to the path of `awr`. The server
+// panics if a path is registered twice, so it must only be called once.
+func (awr AdmissionWebhookRegister) RegisterToServer(scheme *runtime.Scheme, srv *webhook.Server) error {
 	if err := awr.Hook.InjectScheme(scheme); err != nil {
 		return err
 	}
@@ -0,0 +1,113 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	operatorv1beta1 "github.com/horis233/k8s-deprecation-checker/api/v1beta1"
+)
+
+func TestRegisterToServer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(operatorv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1beta1.AddToScheme(scheme))
+
+	config := &CSWebhookConfig{
+		scheme:      scheme,
+		webhooks:    map[string]CSWebhook{},
+		conversions: map[string]bool{},
+	}
+	depremonWebhook := &operatorv1alpha1.DepremonWebhook{}
+	config.AddWebhook(CSWebhook{
+		Name: "depremon",
+		Register: HandlerWebhookRegister{
+			Object:     &operatorv1alpha1.Depremon{},
+			Defaulting: depremonWebhook.DefaultingHandler(),
+			Validating: depremonWebhook.ValidatingHandler(),
+		},
+	})
+	config.AddWebhook(CSWebhook{
+		Name: "record",
+		Register: AdmissionWebhookRegister{
+			Type: ValidatingType,
+			Path: "/deprecate-api-check",
+			Hook: &admission.Webhook{Handler: admission.HandlerFunc(func(context.Context, admission.Request) admission.Response {
+				return admission.Allowed("")
+			})},
+		},
+	})
+	config.AddConversion("depremons.operator.horis233.com")
+
+	srv := &webhook.Server{}
+	if err := config.registerToServer(srv); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		conversionPath,
+		"/mutate-operator-horis233-com-v1alpha1-depremon",
+		"/validate-operator-horis233-com-v1alpha1-depremon",
+		"/deprecate-api-check",
+	} {
+		if _, pattern := srv.WebhookMux.Handler(httptest.NewRequest(http.MethodPost, path, nil)); pattern != path {
+			t.Errorf("%s is not registered", path)
+		}
+	}
+
+	// a v1beta1 Depremon is served converted to v1alpha1
+	depremon := &operatorv1beta1.Depremon{
+		TypeMeta:   metav1.TypeMeta{APIVersion: operatorv1beta1.GroupVersion.String(), Kind: "Depremon"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "depremon", Name: "depremon-sample"},
+	}
+	depremon.Spec.Catalog.TargetVersion = "v1.22"
+	raw, err := json.Marshal(depremon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := apiextensionsv1.ConversionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "ConversionReview"},
+		Request: &apiextensionsv1.ConversionRequest{
+			UID:               types.UID("1"),
+			DesiredAPIVersion: operatorv1alpha1.GroupVersion.String(),
+			Objects:           []runtime.RawExtension{{Raw: raw}},
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, conversionPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	srv.WebhookMux.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("conversion returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	response := apiextensionsv1.ConversionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Response == nil || response.Response.Result.Status != metav1.StatusSuccess || len(response.Response.ConvertedObjects) != 1 {
+		t.Fatalf("unexpected conversion response %+v", response.Response)
+	}
+	converted := &operatorv1alpha1.Depremon{}
+	if err := json.Unmarshal(response.Response.ConvertedObjects[0].Raw, converted); err != nil {
+		t.Fatal(err)
+	}
+	if converted.APIVersion != operatorv1alpha1.GroupVersion.String() || converted.Spec.TargetVersion != "v1.22" {
+		t.Errorf("unexpected converted Depremon %+v", converted)
+	}
+}
@@ -0,0 +1,241 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// maxOwnerDepth bounds the walk up the owner references, e.g. Pod ->
+	// ReplicaSet -> Deployment, or Pod -> Job -> CronJob
+	maxOwnerDepth = 5
+
+	// labels set by OLM on the resources of an operator
+	olmOwnerLabel          = "olm.owner"
+	olmOwnerKindLabel      = "olm.owner.kind"
+	olmOwnerNamespaceLabel = "olm.owner.namespace"
+)
+
+// csvGVK is the kind of the OLM operators
+var csvGVK = schema.GroupVersionKind{Group: "operators.coreos.com", Version: "v1alpha1", Kind: "ClusterServiceVersion"}
+
+// Workload runs pods with the service account of a requester
+type Workload struct {
+	// Kind, Namespace and Name of the top controller of the pods, or of the
+	// pod itself when it has no controller
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Operator is the name of the ClusterServiceVersion installing the
+	// workload, and Version its version
+	Operator string `json:"operator,omitempty"`
+	Version  string `json:"version,omitempty"`
+	// Images of the containers of the pods
+	Images []string `json:"images,omitempty"`
+
+	// Object is the top controller, to record events on
+	Object client.Object `json:"-"`
+}
+
+// String describes the workload, e.g. "operator foo:v1.2.3 in ns bar"
+func (w Workload) String() string {
+	if w.Operator != "" {
+		name := w.Operator
+		if w.Version != "" {
+			name += ":" + w.Version
+		}
+		return fmt.Sprintf("operator %s in ns %s", name, w.Namespace)
+	}
+	description := fmt.Sprintf("%s %s", strings.ToLower(w.Kind), w.Name)
+	if len(w.Images) != 0 {
+		description += " (" + strings.Join(w.Images, ", ") + ")"
+	}
+	return description + " in ns " + w.Namespace
+}
+
+// ForServiceAccount returns the workloads running pods with a service
+// account
+func ForServiceAccount(ctx context.Context, reader client.Reader, namespace, name string) ([]Workload, error) {
+	pods := &corev1.PodList{}
+	if err := reader.List(ctx, pods, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var selected []*corev1.Pod
+	for i := range pods.Items {
+		if serviceAccountOf(&pods.Items[i]) == name {
+			selected = append(selected, &pods.Items[i])
+		}
+	}
+	return ForPods(ctx, reader, namespace, selected)
+}
+
+// ForService returns the workloads running the pods selected by a service
+func ForService(ctx context.Context, reader client.Reader, namespace, name string) ([]Workload, error) {
+	service := &corev1.Service{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, service); err != nil {
+		return nil, err
+	}
+	// A service without selector has no pods, e.g. an external name
+	if len(service.Spec.Selector) == 0 {
+		return nil, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := reader.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels(service.Spec.Selector)); err != nil {
+		return nil, err
+	}
+	var selected []*corev1.Pod
+	for i := range pods.Items {
+		selected = append(selected, &pods.Items[i])
+	}
+	return ForPods(ctx, reader, namespace, selected)
+}
+
+// ForPods returns the workloads running pods of a namespace, one per top
+// controller. The pods are grouped by controller first, so the owners are
+// read once per controller rather than once per pod.
+func ForPods(ctx context.Context, reader client.Reader, namespace string, pods []*corev1.Pod) ([]Workload, error) {
+	var groups [][]*corev1.Pod
+	groupIndex := make(map[string]int)
+	for _, pod := range pods {
+		key := "Pod/" + pod.Name
+		if ref := metav1.GetControllerOf(pod); ref != nil {
+			key = ref.Kind + "/" + ref.Name
+		}
+		if i, found := groupIndex[key]; found {
+			groups[i] = append(groups[i], pod)
+			continue
+		}
+		groupIndex[key] = len(groups)
+		groups = append(groups, []*corev1.Pod{pod})
+	}
+
+	var workloads []Workload
+	index := make(map[string]int)
+	for _, group := range groups {
+		owner, err := TopOwner(ctx, reader, group[0])
+		if err != nil {
+			return nil, err
+		}
+
+		kind := owner.GetObjectKind().GroupVersionKind().Kind
+		key := kind + "/" + owner.GetName()
+		if i, found := index[key]; found {
+			for _, pod := range group {
+				workloads[i].Images = addImages(workloads[i].Images, pod)
+			}
+			continue
+		}
+
+		w := Workload{
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      owner.GetName(),
+			Object:    owner,
+		}
+		for _, pod := range group {
+			w.Images = addImages(w.Images, pod)
+		}
+		if err := setOperator(ctx, reader, &w, owner); err != nil {
+			return nil, err
+		}
+		index[key] = len(workloads)
+		workloads = append(workloads, w)
+	}
+	return workloads, nil
+}
+
+// TopOwner follows the controller references of obj, and returns the last
+// owner that could be read
+func TopOwner(ctx context.Context, reader client.Reader, obj client.Object) (client.Object, error) {
+	if obj.GetObjectKind().GroupVersionKind().Kind == "" {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			pod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+		}
+	}
+
+	current := obj
+	for i := 0; i < maxOwnerDepth; i++ {
+		ref := metav1.GetControllerOf(current)
+		if ref == nil {
+			break
+		}
+		owner := &unstructured.Unstructured{}
+		owner.SetAPIVersion(ref.APIVersion)
+		owner.SetKind(ref.Kind)
+		if err := reader.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: ref.Name}, owner); err != nil {
+			if errors.IsNotFound(err) || errors.IsForbidden(err) {
+				klog.Infof("Owner %s/%s of %s is not readable: %v", ref.Kind, ref.Name, current.GetName(), err)
+				break
+			}
+			return nil, err
+		}
+		current = owner
+	}
+	return current, nil
+}
+
+// setOperator sets the ClusterServiceVersion installing the workload, found
+// from the labels OLM sets on the resources of an operator
+func setOperator(ctx context.Context, reader client.Reader, w *Workload, owner client.Object) error {
+	labels := owner.GetLabels()
+	if labels[olmOwnerKindLabel] != csvGVK.Kind || labels[olmOwnerLabel] == "" {
+		return nil
+	}
+	namespace := labels[olmOwnerNamespaceLabel]
+	if namespace == "" {
+		namespace = owner.GetNamespace()
+	}
+
+	csv := &unstructured.Unstructured{}
+	csv.SetGroupVersionKind(csvGVK)
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: labels[olmOwnerLabel]}, csv); err != nil {
+		if errors.IsNotFound(err) || errors.IsForbidden(err) {
+			klog.Infof("ClusterServiceVersion %s is not readable: %v", labels[olmOwnerLabel], err)
+			w.Operator = labels[olmOwnerLabel]
+			return nil
+		}
+		return err
+	}
+
+	version, _, _ := unstructured.NestedString(csv.Object, "spec", "version")
+	w.Operator = strings.TrimSuffix(csv.GetName(), ".v"+version)
+	if version != "" {
+		w.Version = "v" + strings.TrimPrefix(version, "v")
+	}
+	return nil
+}
+
+// addImages adds the images of the containers of pod to images, sorted and
+// without duplicates
+func addImages(images []string, pod *corev1.Pod) []string {
+	seen := make(map[string]bool)
+	for _, image := range images {
+		seen[image] = true
+	}
+	for _, container := range pod.Spec.Containers {
+		if !seen[container.Image] {
+			seen[container.Image] = true
+			images = append(images, container.Image)
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+func serviceAccountOf(pod *corev1.Pod) string {
+	if pod.Spec.ServiceAccountName != "" {
+		return pod.Spec.ServiceAccountName
+	}
+	return "default"
+}
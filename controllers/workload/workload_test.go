@@ -0,0 +1,251 @@
+package workload
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// countingReader counts the objects read
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (r *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	r.gets++
+	return r.Reader.Get(ctx, key, obj)
+}
+
+func controlledBy(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: name, Controller: &controller}}
+}
+
+func pod(name, image string, owners []metav1.OwnerReference) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, OwnerReferences: owners},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: image}}},
+	}
+}
+
+func TestForPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	reader := &countingReader{Reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart"}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart-1", OwnerReferences: controlledBy("Deployment", "cart")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart-2", OwnerReferences: controlledBy("Deployment", "cart")}},
+	).Build()}
+
+	pods := []*corev1.Pod{
+		pod("cart-1-a", "cart:v1", controlledBy("ReplicaSet", "cart-1")),
+		pod("cart-1-b", "cart:v1", controlledBy("ReplicaSet", "cart-1")),
+		pod("cart-1-c", "cart:v1", controlledBy("ReplicaSet", "cart-1")),
+		pod("cart-2-a", "cart:v2", controlledBy("ReplicaSet", "cart-2")),
+		pod("debug", "busybox", nil),
+	}
+	workloads, err := ForPods(context.Background(), reader, "shop", pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads) != 2 {
+		t.Fatalf("unexpected workloads %v", workloads)
+	}
+	if w := workloads[0]; w.Kind != "Deployment" || w.Name != "cart" || len(w.Images) != 2 {
+		t.Errorf("unexpected workload %v", w)
+	}
+	if w := workloads[1]; w.Kind != "Pod" || w.Name != "debug" {
+		t.Errorf("unexpected workload %v", w)
+	}
+	// a replica set and a deployment per replica set, whatever the number of
+	// pods
+	if reader.gets != 4 {
+		t.Errorf("%d objects read, expected 4", reader.gets)
+	}
+}
+
+func TestForServiceAccount(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	builder := pod("builder", "kaniko", nil)
+	builder.Spec.ServiceAccountName = "ci"
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		builder,
+		pod("debug", "busybox", nil),
+	).Build()
+
+	tests := []struct {
+		name           string
+		serviceAccount string
+		expected       string
+	}{
+		{name: "named service account", serviceAccount: "ci", expected: "builder"},
+		{name: "default service account", serviceAccount: "default", expected: "debug"},
+	}
+	for _, test := range tests {
+		workloads, err := ForServiceAccount(context.Background(), reader, "shop", test.serviceAccount)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(workloads) != 1 || workloads[0].Name != test.expected {
+			t.Errorf("%s: unexpected workloads %v", test.name, workloads)
+		}
+	}
+}
+
+func TestForService(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	web := pod("web", "nginx", nil)
+	web.Labels = map[string]string{"app": "web"}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		web,
+		pod("debug", "busybox", nil),
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "external"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "example.com"},
+		},
+	).Build()
+
+	workloads, err := ForService(context.Background(), reader, "shop", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads) != 1 || workloads[0].Name != "web" {
+		t.Errorf("unexpected workloads %v", workloads)
+	}
+
+	workloads, err = ForService(context.Background(), reader, "shop", "external")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads) != 0 {
+		t.Errorf("unexpected workloads %v for a service without selector", workloads)
+	}
+}
+
+func TestTopOwner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart-1", OwnerReferences: controlledBy("Deployment", "cart")}},
+	).Build()
+
+	// the deployment was deleted, the replica set is the last readable owner
+	owner, err := TopOwner(context.Background(), reader, pod("cart-1-a", "cart:v1", controlledBy("ReplicaSet", "cart-1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind := owner.GetObjectKind().GroupVersionKind().Kind; kind != "ReplicaSet" || owner.GetName() != "cart-1" {
+		t.Errorf("unexpected owner %s %s", kind, owner.GetName())
+	}
+
+	owner, err = TopOwner(context.Background(), reader, pod("debug", "busybox", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind := owner.GetObjectKind().GroupVersionKind().Kind; kind != "Pod" || owner.GetName() != "debug" {
+		t.Errorf("unexpected owner %s %s", kind, owner.GetName())
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name     string
+		workload Workload
+		expected string
+	}{
+		{
+			name:     "operator",
+			workload: Workload{Kind: "Deployment", Namespace: "operators", Name: "foo-controller", Operator: "foo", Version: "v1.2.3"},
+			expected: "operator foo:v1.2.3 in ns operators",
+		},
+		{
+			name:     "operator without version",
+			workload: Workload{Kind: "Deployment", Namespace: "operators", Name: "foo-controller", Operator: "foo"},
+			expected: "operator foo in ns operators",
+		},
+		{
+			name:     "images",
+			workload: Workload{Kind: "Deployment", Namespace: "shop", Name: "cart", Images: []string{"cart:v1", "cart:v2"}},
+			expected: "deployment cart (cart:v1, cart:v2) in ns shop",
+		},
+		{
+			name:     "no images",
+			workload: Workload{Kind: "Pod", Namespace: "shop", Name: "debug"},
+			expected: "pod debug in ns shop",
+		},
+	}
+	for _, test := range tests {
+		if s := test.workload.String(); s != test.expected {
+			t.Errorf("%s: got %q, expected %q", test.name, s, test.expected)
+		}
+	}
+}
+
+func TestSetOperator(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	csv := &unstructured.Unstructured{}
+	csv.SetGroupVersionKind(csvGVK)
+	csv.SetNamespace("operators")
+	csv.SetName("foo.v1.2.3")
+	if err := unstructured.SetNestedField(csv.Object, "1.2.3", "spec", "version"); err != nil {
+		t.Fatal(err)
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(csv).Build()
+
+	olmLabels := func(name string) map[string]string {
+		return map[string]string{olmOwnerLabel: name, olmOwnerKindLabel: csvGVK.Kind, olmOwnerNamespaceLabel: "operators"}
+	}
+	tests := []struct {
+		name             string
+		labels           map[string]string
+		expectedOperator string
+		expectedVersion  string
+	}{
+		{name: "installed by OLM", labels: olmLabels("foo.v1.2.3"), expectedOperator: "foo", expectedVersion: "v1.2.3"},
+		{name: "unreadable ClusterServiceVersion", labels: olmLabels("bar.v0.1.0"), expectedOperator: "bar.v0.1.0"},
+		{name: "not an operator", labels: map[string]string{"app": "cart"}},
+	}
+	for _, test := range tests {
+		owner := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "controller", Labels: test.labels}}
+		w := Workload{}
+		if err := setOperator(context.Background(), reader, &w, owner); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if w.Operator != test.expectedOperator || w.Version != test.expectedVersion {
+			t.Errorf("%s: got operator %q version %q, expected %q %q", test.name, w.Operator, w.Version, test.expectedOperator, test.expectedVersion)
+		}
+	}
+}
@@ -4,10 +4,13 @@ go 1.16
 
 require (
 	github.com/ghodss/yaml v1.0.1-0.20190212211648-25d852aebe32
+	github.com/google/cel-go v0.7.3
+	github.com/google/gofuzz v1.1.0
 	github.com/onsi/ginkgo v1.16.1
 	github.com/onsi/gomega v1.11.0
 	github.com/operator-framework/operator-lifecycle-manager v0.18.1
 	k8s.io/api v0.20.6
+	k8s.io/apiextensions-apiserver v0.20.6
 	k8s.io/apimachinery v0.20.6
 	k8s.io/client-go v0.20.6
 	k8s.io/klog v1.0.0
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -24,16 +25,24 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	operatorv1alpha1 "github.com/horis233/k8s-deprecation-checker/api/v1alpha1"
+	operatorv1beta1 "github.com/horis233/k8s-deprecation-checker/api/v1beta1"
 	"github.com/horis233/k8s-deprecation-checker/controllers"
-	"github.com/horis233/k8s-deprecation-checker/controllers/checker"
+	"github.com/horis233/k8s-deprecation-checker/controllers/migration"
+	"github.com/horis233/k8s-deprecation-checker/controllers/notifier"
+	"github.com/horis233/k8s-deprecation-checker/controllers/policy"
+	"github.com/horis233/k8s-deprecation-checker/controllers/probe"
 	"github.com/horis233/k8s-deprecation-checker/controllers/utils"
 	//+kubebuilder:scaffold:imports
 )
@@ -46,7 +55,9 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	utilruntime.Must(operatorv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -87,14 +98,60 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.DepremonReconciler{
-		Client:  mgr.GetClient(),
-		Scheme:  mgr.GetScheme(),
-		Manager: &mgr,
-	}).SetupWithManager(mgr); err != nil {
+	depremonNotifier := notifier.New(mgr.GetClient(), namespace)
+	if err := mgr.Add(depremonNotifier); err != nil {
+		setupLog.Error(err, "unable to set up notifier")
+		os.Exit(1)
+	}
+
+	// The manager only caches the operator namespace, the webhook reads the
+	// Depremon objects of the other namespaces from their own cache
+	depremonCache, err := cache.New(mgr.GetConfig(), cache.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		setupLog.Error(err, "unable to create Depremon cache")
+		os.Exit(1)
+	}
+	if _, err := depremonCache.GetInformer(context.Background(), &operatorv1alpha1.Depremon{}); err != nil {
+		setupLog.Error(err, "unable to create Depremon informer")
+		os.Exit(1)
+	}
+	if err := mgr.Add(depremonCache); err != nil {
+		setupLog.Error(err, "unable to set up Depremon cache")
+		os.Exit(1)
+	}
+
+	depremonReconciler := &controllers.DepremonReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Config:   mgr.GetConfig(),
+		Recorder: mgr.GetEventRecorderFor("depremon"),
+		Notifier: depremonNotifier,
+		Reader:   mgr.GetAPIReader(),
+		Migrator: &migration.Migrator{
+			Client: mgr.GetClient(),
+			Reader: mgr.GetAPIReader(),
+		},
+		Discovery: memory.NewMemCacheClient(discovery.NewDiscoveryClientForConfigOrDie(mgr.GetConfig())),
+		Prober:    probe.NewProber(mgr.GetConfig()),
+		Policy:    &policy.Shared{},
+		Depremons: depremonCache,
+	}
+	if err = depremonReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Depremon")
 		os.Exit(1)
 	}
+	if err = depremonReconciler.SetupWebhookServer(mgr, namespace); err != nil {
+		setupLog.Error(err, "unable to set up webhook server")
+		os.Exit(1)
+	}
+	if err = (&controllers.ReportReconciler{
+		Client: mgr.GetClient(),
+		Reader: mgr.GetAPIReader(),
+		Policy: depremonReconciler.Policy,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Report")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -106,35 +163,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	setupLog.Info("checking webhook configuration apiversion")
-	quit := make(chan bool)
-	errc := make(chan error)
-	done := make(chan error)
-	go func() {
-		err := checker.WebhookConfigurationChecks(mgr.GetClient(), mgr.GetConfig())
-		ch := done
-		if err != nil {
-			ch = errc
-		}
-		select {
-		case ch <- err:
-			return
-		case <-quit:
-			return
-		}
-	}()
-
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
-
-	select {
-	case err := <-errc:
-		close(quit)
-		setupLog.Error(err, "failed to check webhook configuration")
-		os.Exit(1)
-	case <-done:
-	}
 }